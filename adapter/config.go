@@ -0,0 +1,714 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	yamlv3 "go.yaml.in/yaml/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	signozprov "github.com/brainpodnl/signoz-metrics-adapter/adapter/provider"
+)
+
+const configAPIVersion = "signozadapter/v1alpha1"
+
+// AdapterConfig is the file format accepted by --config. Flags given on the
+// command line take precedence over the file.
+type AdapterConfig struct {
+	APIVersion      string                    `json:"apiVersion"`
+	Signoz          SignozConfig              `json:"signoz"`
+	DNS             DNSConfig                 `json:"dns"`
+	Poll            PollConfig                `json:"poll"`
+	Listener        ListenerConfig            `json:"listener"`
+	Pods            PodsConfig                `json:"pods"`
+	RateLimit       RateLimitConfig           `json:"rateLimit"`
+	Concurrency     ConcurrencyConfig         `json:"concurrency"`
+	Shadow          ShadowConfig              `json:"shadow"`
+	ExportConfigMap string                    `json:"exportConfigMap,omitempty"`
+	PrometheusProxy bool                      `json:"prometheusProxy,omitempty"`
+	MetricCRD       bool                      `json:"metricCRD,omitempty"`
+	ReloadInterval  *metav1.Duration          `json:"reloadInterval,omitempty"`
+	VPA             VPAConfig                 `json:"vpa"`
+	APIServices     APIServicesConfig         `json:"apiServices"`
+	Presets         []string                  `json:"presets,omitempty"`
+	Metrics         []signozprov.MetricConfig `json:"metrics,omitempty"`
+	SLOs            []signozprov.SLOConfig    `json:"slos,omitempty"`
+
+	// node is the parsed document, used to report positions.
+	node *yamlv3.Node
+}
+
+// SignozConfig holds the connection and query settings for SigNoz.
+type SignozConfig struct {
+	Endpoints            []string                 `json:"endpoints,omitempty"`
+	EndpointFile         string                   `json:"endpointFile,omitempty"`
+	APIPath              string                   `json:"apiPath,omitempty"`
+	Flavor               string                   `json:"flavor,omitempty"`
+	TokenExchange        TokenExchangeConfig      `json:"tokenExchange"`
+	Exec                 ExecConfig               `json:"exec"`
+	APIKey               string                   `json:"apiKey,omitempty"`
+	APIKeyFile           string                   `json:"apiKeyFile,omitempty"`
+	APIKeySecret         APIKeySecretConfig       `json:"apiKeySecret"`
+	AuthMode             string                   `json:"authMode,omitempty"`
+	OAuth2               OAuth2Config             `json:"oauth2"`
+	EndpointIPs          []string                 `json:"endpointIPs,omitempty"`
+	EndpointAllowlist    []string                 `json:"endpointAllowlist,omitempty"`
+	ClusterName          string                   `json:"clusterName,omitempty"`
+	UserAgent            string                   `json:"userAgent,omitempty"`
+	Headers              map[string]string        `json:"headers,omitempty"`
+	ProxyURL             string                   `json:"proxyURL,omitempty"`
+	NamespaceLabelKey    string                   `json:"namespaceLabelKey,omitempty"`
+	TLS                  TLSConfig                `json:"tls"`
+	Signing              SigningConfig            `json:"signing"`
+	Retry                RetryConfig              `json:"retry"`
+	CircuitBreaker       CircuitBreakerConfig     `json:"circuitBreaker"`
+	PartialResponse      string                   `json:"partialResponse,omitempty"`
+	TimeRangeMinutes     int64                    `json:"timeRangeMinutes,omitempty"`
+	Window               string                   `json:"window,omitempty"`
+	HPASyncPeriod        *metav1.Duration         `json:"hpaSyncPeriod,omitempty"`
+	AutoWindowMultiplier int                      `json:"autoWindowMultiplier,omitempty"`
+	StepSeconds          int64                    `json:"stepSeconds,omitempty"`
+	QueryTimeout         *metav1.Duration         `json:"queryTimeout,omitempty"`
+	MetricTimeout        *metav1.Duration         `json:"metricTimeout,omitempty"`
+	QueryCacheTTL        *metav1.Duration         `json:"queryCacheTTL,omitempty"`
+	QueryBatchWindow     *metav1.Duration         `json:"queryBatchWindow,omitempty"`
+	MaxStaleAge          *metav1.Duration         `json:"maxStaleAge,omitempty"`
+	External             ExternalConfig           `json:"external"`
+	FilterExpression     string                   `json:"filterExpression,omitempty"`
+	LabelFilters         []signozprov.LabelFilter `json:"labelFilters,omitempty"`
+}
+
+// ExternalConfig overrides the query range for external metrics.
+type ExternalConfig struct {
+	Window         *metav1.Duration `json:"window,omitempty"`
+	StepSeconds    int64            `json:"stepSeconds,omitempty"`
+	DenyNamespaces []string         `json:"denyNamespaces,omitempty"`
+}
+
+// APIKeySecretConfig names a watched Secret holding the API key.
+type APIKeySecretConfig struct {
+	// Name is namespace/name of the Secret.
+	Name string `json:"name,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// ClientCertificate also reads the client certificate from the tls.crt
+	// and tls.key keys of the Secret.
+	ClientCertificate bool `json:"clientCertificate,omitempty"`
+}
+
+// TokenExchangeConfig configures authentication with an exchanged
+// ServiceAccount token instead of an API key.
+type TokenExchangeConfig struct {
+	URL       string `json:"url,omitempty"`
+	Audience  string `json:"audience,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+// ExecConfig configures a credential plugin providing the API key.
+type ExecConfig struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// SigningConfig configures HMAC signing of SigNoz requests.
+type SigningConfig struct {
+	KeyFile   string   `json:"keyFile,omitempty"`
+	Algorithm string   `json:"algorithm,omitempty"`
+	Headers   []string `json:"headers,omitempty"`
+	Header    string   `json:"header,omitempty"`
+}
+
+// OAuth2Config configures the oauth2 auth mode.
+type OAuth2Config struct {
+	TokenURL         string   `json:"tokenURL,omitempty"`
+	ClientID         string   `json:"clientID,omitempty"`
+	ClientSecret     string   `json:"clientSecret,omitempty"`
+	ClientSecretFile string   `json:"clientSecretFile,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+}
+
+// TLSConfig configures the TLS connections to SigNoz.
+type TLSConfig struct {
+	CAFile             string `json:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// RetryConfig configures retries of failed SigNoz requests.
+type RetryConfig struct {
+	MaxAttempts int              `json:"maxAttempts,omitempty"`
+	BaseDelay   *metav1.Duration `json:"baseDelay,omitempty"`
+	StatusCodes []int            `json:"statusCodes,omitempty"`
+}
+
+// CircuitBreakerConfig configures failing fast while SigNoz is down.
+type CircuitBreakerConfig struct {
+	Failures     int              `json:"failures,omitempty"`
+	OpenDuration *metav1.Duration `json:"openDuration,omitempty"`
+	ServeStale   bool             `json:"serveStale,omitempty"`
+}
+
+// DNSConfig configures the caching resolver for the SigNoz hosts.
+type DNSConfig struct {
+	CacheTTL    *metav1.Duration `json:"cacheTTL,omitempty"`
+	NegativeTTL *metav1.Duration `json:"negativeTTL,omitempty"`
+	Servers     []string         `json:"servers,omitempty"`
+	HostAliases []HostAlias      `json:"hostAliases,omitempty"`
+}
+
+// HostAlias pins hostnames to an address, like the hostAliases of a pod.
+type HostAlias struct {
+	IP        string   `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+}
+
+// PollConfig configures background polling.
+type PollConfig struct {
+	Interval    *metav1.Duration `json:"interval,omitempty"`
+	Workers     int              `json:"workers,omitempty"`
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+	Jitter      *float64         `json:"jitter,omitempty"`
+}
+
+// ListenerConfig configures the secure port the adapter serves on.
+type ListenerConfig struct {
+	BindAddress       string `json:"bindAddress,omitempty"`
+	SecurePort        int    `json:"securePort,omitempty"`
+	CertDir           string `json:"certDir,omitempty"`
+	TLSCertFile       string `json:"tlsCertFile,omitempty"`
+	TLSPrivateKeyFile string `json:"tlsPrivateKeyFile,omitempty"`
+}
+
+// PodsConfig configures which pods metrics are served for.
+type PodsConfig struct {
+	RequireRunning bool     `json:"requireRunning,omitempty"`
+	ExcludeUnready bool     `json:"excludeUnready,omitempty"`
+	LabelKeys      []string `json:"labelKeys,omitempty"`
+}
+
+// RateLimitConfig configures inbound rate limiting.
+type RateLimitConfig struct {
+	QPS   float64 `json:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+	By    string  `json:"by,omitempty"`
+}
+
+// ConcurrencyConfig configures the inbound concurrency limit.
+type ConcurrencyConfig struct {
+	MaxInflight   int              `json:"maxInflight,omitempty"`
+	MaxQueued     int              `json:"maxQueued,omitempty"`
+	QueueTimeout  *metav1.Duration `json:"queueTimeout,omitempty"`
+	PriorityUsers []string         `json:"priorityUsers,omitempty"`
+}
+
+// ShadowConfig configures shadow comparisons.
+type ShadowConfig struct {
+	SampleRate float64 `json:"sampleRate,omitempty"`
+	Tolerance  float64 `json:"tolerance,omitempty"`
+}
+
+// VPAConfig configures the VPA recommender feed.
+type VPAConfig struct {
+	Enabled      bool   `json:"enabled,omitempty"`
+	CPUMetric    string `json:"cpuMetric,omitempty"`
+	MemoryMetric string `json:"memoryMetric,omitempty"`
+}
+
+// APIServicesConfig configures registration of the adapter's APIServices.
+type APIServicesConfig struct {
+	Manage bool `json:"manage,omitempty"`
+	// Service is namespace/name of the Service the APIServices point at.
+	Service string `json:"service,omitempty"`
+	// CertSecret is namespace/name of the Secret holding the serving
+	// certificate.
+	CertSecret string `json:"certSecret,omitempty"`
+	// Owner is the ClusterRole owning the APIServices.
+	Owner string `json:"owner,omitempty"`
+}
+
+// loadAdapterConfig reads and validates the --config file. Errors are
+// reported with the line and column of the offending value. References to
+// environment variables in values are expanded, see expandConfigEnv.
+func loadAdapterConfig(path string) (*AdapterConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s: config is empty", path)
+	}
+	doc := root.Content[0]
+
+	if errs := expandConfigEnv(doc); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+	if errs := checkConfigNode(doc, reflect.TypeFor[AdapterConfig](), ""); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+
+	expanded, err := yamlv3.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var config AdapterConfig
+	if err := yaml.Unmarshal(expanded, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var errs []error
+	if config.APIVersion != configAPIVersion {
+		errs = append(errs, fmt.Errorf("%s: apiVersion: must be %q, got %q", nodePosition(doc, "apiVersion"), configAPIVersion, config.APIVersion))
+	}
+	if a := config.Listener.BindAddress; a != "" && net.ParseIP(a) == nil {
+		errs = append(errs, fmt.Errorf("%s: listener.bindAddress: invalid IP address %q", nodePosition(doc, "listener.bindAddress"), a))
+	}
+	slos, err := signozprov.ExpandSLOs(config.SLOs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	config.Metrics = append(config.Metrics, slos...)
+	if err := signozprov.ValidateMetricConfigs(config.Metrics); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+
+	config.node = doc
+	return &config, nil
+}
+
+var jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// checkConfigNode walks a YAML node alongside the Go type it is decoded into
+// and reports unknown fields and mismatched types with their position. The
+// JSON decoder used afterwards would report neither with a position.
+func checkConfigNode(node *yamlv3.Node, t reflect.Type, path string) []error {
+	if node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	tag := node.ShortTag()
+	if tag == "!!null" {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	fail := func(format string, args ...any) []error {
+		return []error{fmt.Errorf("line %d, column %d: %s: %s", node.Line, node.Column, path, fmt.Sprintf(format, args...))}
+	}
+
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		if node.Kind != yamlv3.ScalarNode {
+			return fail("expected a string")
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yamlv3.MappingNode {
+			return fail("expected a mapping")
+		}
+		fields := map[string]reflect.StructField{}
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				fields[name] = f
+			}
+		}
+		var errs []error
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			f, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, fmt.Errorf("line %d, column %d: %s: unknown field", key.Line, key.Column, joinConfigPath(path, key.Value)))
+				continue
+			}
+			errs = append(errs, checkConfigNode(value, f.Type, joinConfigPath(path, key.Value))...)
+		}
+		return errs
+	case reflect.Slice:
+		if node.Kind != yamlv3.SequenceNode {
+			return fail("expected a list")
+		}
+		var errs []error
+		for i, item := range node.Content {
+			errs = append(errs, checkConfigNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+	case reflect.Map:
+		if node.Kind != yamlv3.MappingNode {
+			return fail("expected a mapping")
+		}
+		var errs []error
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			errs = append(errs, checkConfigNode(node.Content[i+1], t.Elem(), joinConfigPath(path, node.Content[i].Value))...)
+		}
+		return errs
+	case reflect.String:
+		if node.Kind != yamlv3.ScalarNode {
+			return fail("expected a string")
+		}
+	case reflect.Bool:
+		if tag != "!!bool" {
+			return fail("expected a boolean, got %q", node.Value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if tag != "!!int" {
+			return fail("expected an integer, got %q", node.Value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if tag != "!!int" && tag != "!!float" {
+			return fail("expected a number, got %q", node.Value)
+		}
+	}
+	return nil
+}
+
+// expandConfigEnv replaces ${NAME} in scalar values with the value of the
+// environment variable NAME, so secrets can be injected from the environment
+// while the rest of the file lives in a ConfigMap. $$ escapes a literal $.
+// Expanded values are typed by their content, so ${PORT} can fill an integer.
+func expandConfigEnv(node *yamlv3.Node) []error {
+	switch node.Kind {
+	case yamlv3.DocumentNode, yamlv3.SequenceNode:
+		var errs []error
+		for _, n := range node.Content {
+			errs = append(errs, expandConfigEnv(n)...)
+		}
+		return errs
+	case yamlv3.MappingNode:
+		var errs []error
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, expandConfigEnv(node.Content[i])...)
+		}
+		return errs
+	case yamlv3.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		value, err := expandEnv(node.Value)
+		if err != nil {
+			return []error{fmt.Errorf("line %d, column %d: %w", node.Line, node.Column, err)}
+		}
+		node.Value = value
+		node.Tag = ""
+		node.Style = 0
+	}
+	return nil
+}
+
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", s)
+			}
+			name := s[i+2 : i+2+end]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			b.WriteString(value)
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// nodePosition returns the position of the value at the dotted path, or of
+// the closest parent that exists.
+func nodePosition(node *yamlv3.Node, path string) string {
+	for _, key := range strings.Split(path, ".") {
+		if node.Kind != yamlv3.MappingNode {
+			break
+		}
+		var next *yamlv3.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return fmt.Sprintf("line %d, column %d", node.Line, node.Column)
+}
+
+// configSetter applies settings of the config file whose flag was not set on
+// the command line.
+type configSetter struct {
+	flags *pflag.FlagSet
+}
+
+func (c configSetter) set(flag string, apply func()) {
+	if !c.flags.Changed(flag) {
+		apply()
+	}
+}
+
+func (c configSetter) setString(flag string, dst *string, value string) {
+	if value != "" {
+		c.set(flag, func() { *dst = value })
+	}
+}
+
+func (c configSetter) setDuration(flag string, dst *time.Duration, value *metav1.Duration) {
+	if value != nil {
+		c.set(flag, func() { *dst = value.Duration })
+	}
+}
+
+// applyConfig copies the settings of the config file to the adapter, except
+// for those whose flag was set on the command line.
+func (a *SignozAdapter) applyConfig(config *AdapterConfig) {
+	setter := configSetter{flags: a.Flags()}
+	set, setString, setDuration := setter.set, setter.setString, setter.setDuration
+	a.applyQueryConfig(config)
+
+	s := config.Signoz
+	setString("signoz-endpoint", &a.SignozEndpoint, strings.Join(s.Endpoints, ","))
+	setString("signoz-endpoint-file", &a.SignozEndpointFile, s.EndpointFile)
+	setString("signoz-api-path", &a.SignozAPIPath, s.APIPath)
+	setString("signoz-flavor", &a.SignozFlavor, s.Flavor)
+	setString("signoz-token-exchange-url", &a.TokenExchangeURL, s.TokenExchange.URL)
+	setString("signoz-token-exchange-audience", &a.TokenExchangeAudience, s.TokenExchange.Audience)
+	setString("signoz-token-file", &a.ServiceAccountTokenFile, s.TokenExchange.TokenFile)
+	setString("signoz-exec-command", &a.ExecCommand, s.Exec.Command)
+	if len(s.Exec.Args) > 0 {
+		set("signoz-exec-arg", func() { a.ExecArgs = s.Exec.Args })
+	}
+	a.execEnv = s.Exec.Env
+	setString("signoz-api-key", &a.SignozAPIKey, s.APIKey)
+	setString("signoz-api-key-file", &a.SignozAPIKeyFile, s.APIKeyFile)
+	setString("signoz-auth-mode", &a.AuthMode, s.AuthMode)
+	setString("signoz-oauth2-token-url", &a.OAuth2TokenURL, s.OAuth2.TokenURL)
+	setString("signoz-oauth2-client-id", &a.OAuth2ClientID, s.OAuth2.ClientID)
+	setString("signoz-oauth2-client-secret", &a.OAuth2ClientSecret, s.OAuth2.ClientSecret)
+	setString("signoz-oauth2-client-secret-file", &a.OAuth2ClientSecretFile, s.OAuth2.ClientSecretFile)
+	if len(s.OAuth2.Scopes) > 0 {
+		set("signoz-oauth2-scopes", func() { a.OAuth2Scopes = s.OAuth2.Scopes })
+	}
+	setString("signoz-ca-file", &a.SignozCAFile, s.TLS.CAFile)
+	setString("signoz-cert-file", &a.SignozCertFile, s.TLS.CertFile)
+	setString("signoz-key-file", &a.SignozKeyFile, s.TLS.KeyFile)
+	if s.TLS.InsecureSkipVerify {
+		set("signoz-insecure-skip-verify", func() { a.SignozInsecure = true })
+	}
+	setString("signoz-api-key-secret", &a.APIKeySecret, s.APIKeySecret.Name)
+	setString("signoz-api-key-secret-key", &a.APIKeySecretKey, s.APIKeySecret.Key)
+	if s.APIKeySecret.ClientCertificate {
+		set("signoz-api-key-secret-cert", func() { a.APIKeySecretCert = true })
+	}
+	setString("signoz-endpoint-ips", &a.SignozEndpointIPs, strings.Join(s.EndpointIPs, ","))
+	setString("cluster-name", &a.ClusterName, s.ClusterName)
+	setString("signoz-user-agent", &a.UserAgent, s.UserAgent)
+	if len(s.Headers) > 0 {
+		set("signoz-header", func() {
+			a.SignozHeaders = nil
+			for name, value := range s.Headers {
+				a.SignozHeaders = append(a.SignozHeaders, name+": "+value)
+			}
+			slices.Sort(a.SignozHeaders)
+		})
+	}
+	setString("signoz-proxy-url", &a.ProxyURL, s.ProxyURL)
+	setString("namespace-label-key", &a.NamespaceLabelKey, s.NamespaceLabelKey)
+	setString("signoz-signing-key-file", &a.SigningKeyFile, s.Signing.KeyFile)
+	setString("signoz-signing-algorithm", &a.SigningAlgorithm, s.Signing.Algorithm)
+	if len(s.Signing.Headers) > 0 {
+		set("signoz-signing-headers", func() { a.SigningHeaders = s.Signing.Headers })
+	}
+	setString("signoz-signature-header", &a.SignatureHeader, s.Signing.Header)
+	if len(s.EndpointAllowlist) > 0 {
+		set("signoz-endpoint-allowlist", func() { a.EndpointAllowlist = s.EndpointAllowlist })
+	}
+	setString("partial-response", &a.PartialResponse, s.PartialResponse)
+	setDuration("signoz-query-timeout", &a.QueryTimeout, s.QueryTimeout)
+	setDuration("signoz-metric-timeout", &a.MetricTimeout, s.MetricTimeout)
+	setDuration("query-cache-ttl", &a.QueryCacheTTL, s.QueryCacheTTL)
+	setDuration("query-batch-window", &a.QueryBatchWindow, s.QueryBatchWindow)
+	setDuration("max-stale-age", &a.MaxStaleAge, s.MaxStaleAge)
+	if s.Retry.MaxAttempts != 0 {
+		set("signoz-retry-max-attempts", func() { a.RetryMaxAttempts = s.Retry.MaxAttempts })
+	}
+	setDuration("signoz-retry-base-delay", &a.RetryBaseDelay, s.Retry.BaseDelay)
+	if len(s.Retry.StatusCodes) > 0 {
+		set("signoz-retry-status-codes", func() { a.RetryStatusCodes = s.Retry.StatusCodes })
+	}
+	if s.CircuitBreaker.Failures != 0 {
+		set("circuit-breaker-failures", func() { a.BreakerFailures = s.CircuitBreaker.Failures })
+	}
+	setDuration("circuit-breaker-open-duration", &a.BreakerOpenDuration, s.CircuitBreaker.OpenDuration)
+	if s.CircuitBreaker.ServeStale {
+		set("circuit-breaker-serve-stale", func() { a.BreakerServeStale = true })
+	}
+	if len(s.External.DenyNamespaces) > 0 {
+		set("external-metrics-deny-namespaces", func() { a.ExternalDenyNamespaces = s.External.DenyNamespaces })
+	}
+
+	setDuration("signoz-dns-cache-ttl", &a.SignozDNSCacheTTL, config.DNS.CacheTTL)
+	setDuration("signoz-dns-negative-ttl", &a.SignozDNSNegativeTTL, config.DNS.NegativeTTL)
+	if len(config.DNS.Servers) > 0 {
+		set("signoz-dns-servers", func() { a.SignozDNSServers = config.DNS.Servers })
+	}
+	if len(config.DNS.HostAliases) > 0 {
+		set("signoz-host-alias", func() {
+			a.SignozHostAliases = nil
+			for _, alias := range config.DNS.HostAliases {
+				for _, host := range alias.Hostnames {
+					a.SignozHostAliases = append(a.SignozHostAliases, host+"="+alias.IP)
+				}
+			}
+		})
+	}
+	setDuration("signoz-poll-interval", &a.SignozPollInterval, config.Poll.Interval)
+	setDuration("signoz-poll-idle-timeout", &a.SignozPollIdleTimeout, config.Poll.IdleTimeout)
+	if config.Poll.Jitter != nil {
+		set("signoz-poll-jitter", func() { a.SignozPollJitter = *config.Poll.Jitter })
+	}
+	if config.Poll.Workers != 0 {
+		set("signoz-poll-workers", func() { a.SignozPollWorkers = config.Poll.Workers })
+	}
+
+	l := config.Listener
+	serving := a.SecureServing
+	if l.BindAddress != "" {
+		set("bind-address", func() { serving.BindAddress = net.ParseIP(l.BindAddress) })
+	}
+	if l.SecurePort != 0 {
+		set("secure-port", func() { serving.BindPort = l.SecurePort })
+	}
+	setString("cert-dir", &serving.ServerCert.CertDirectory, l.CertDir)
+	setString("tls-cert-file", &serving.ServerCert.CertKey.CertFile, l.TLSCertFile)
+	setString("tls-private-key-file", &serving.ServerCert.CertKey.KeyFile, l.TLSPrivateKeyFile)
+
+	if config.Pods.RequireRunning {
+		set("require-running-pods", func() { a.RequireRunningPods = true })
+	}
+	if config.Pods.ExcludeUnready {
+		set("exclude-unready-pods", func() { a.ExcludeUnreadyPods = true })
+	}
+	if len(config.Pods.LabelKeys) > 0 {
+		set("pod-label-keys", func() { a.PodLabelKeys = config.Pods.LabelKeys })
+	}
+
+	if config.RateLimit.QPS != 0 {
+		set("rate-limit-qps", func() { a.RateLimitQPS = config.RateLimit.QPS })
+	}
+	if config.RateLimit.Burst != 0 {
+		set("rate-limit-burst", func() { a.RateLimitBurst = config.RateLimit.Burst })
+	}
+	setString("rate-limit-by", &a.RateLimitBy, config.RateLimit.By)
+
+	c := config.Concurrency
+	if c.MaxInflight != 0 {
+		set("max-inflight-requests", func() { a.MaxInflight = c.MaxInflight })
+	}
+	if c.MaxQueued != 0 {
+		set("max-queued-requests", func() { a.MaxQueued = c.MaxQueued })
+	}
+	setDuration("inflight-queue-timeout", &a.QueueTimeout, c.QueueTimeout)
+	if len(c.PriorityUsers) > 0 {
+		set("inflight-priority-users", func() { a.PriorityUsers = c.PriorityUsers })
+	}
+
+	if config.Shadow.SampleRate != 0 {
+		set("shadow-sample-rate", func() { a.ShadowSampleRate = config.Shadow.SampleRate })
+	}
+	if config.Shadow.Tolerance != 0 {
+		set("shadow-tolerance", func() { a.ShadowTolerance = config.Shadow.Tolerance })
+	}
+
+	setString("export-configmap", &a.ExportConfigMap, config.ExportConfigMap)
+	if config.PrometheusProxy {
+		set("enable-prometheus-proxy", func() { a.PrometheusProxy = true })
+	}
+	if config.VPA.Enabled {
+		set("enable-vpa-feed", func() { a.VPAFeed = true })
+	}
+	setString("vpa-cpu-metric", &a.VPACPUMetric, config.VPA.CPUMetric)
+	setString("vpa-memory-metric", &a.VPAMemoryMetric, config.VPA.MemoryMetric)
+
+	if config.APIServices.Manage {
+		set("manage-apiservices", func() { a.ManageAPIServices = true })
+	}
+	setString("apiservice-service", &a.APIServiceService, config.APIServices.Service)
+	setString("apiservice-cert-secret", &a.APIServiceCertSecret, config.APIServices.CertSecret)
+	setString("apiservice-owner", &a.APIServiceOwner, config.APIServices.Owner)
+
+	if config.MetricCRD {
+		set("enable-metric-crd", func() { a.MetricCRD = true })
+	}
+	setDuration("config-reload-interval", &a.ConfigReloadInterval, config.ReloadInterval)
+}
+
+// applyQueryConfig copies the settings of the queries that are reloaded with
+// the config file, see configReloader.
+func (a *SignozAdapter) applyQueryConfig(config *AdapterConfig) {
+	c := configSetter{flags: a.Flags()}
+	s := config.Signoz
+	c.setString("signoz-filter-expression", &a.SignozFilterExpression, s.FilterExpression)
+	if s.TimeRangeMinutes != 0 {
+		c.set("signoz-timerange-minutes", func() { a.SignozTimerangeMinutes = s.TimeRangeMinutes })
+	}
+	c.setString("signoz-window", &a.SignozWindow, s.Window)
+	c.setDuration("hpa-sync-period", &a.HPASyncPeriod, s.HPASyncPeriod)
+	if s.AutoWindowMultiplier != 0 {
+		c.set("auto-window-multiplier", func() { a.AutoWindowMultiplier = s.AutoWindowMultiplier })
+	}
+	if s.StepSeconds != 0 {
+		c.set("signoz-step-seconds", func() { a.SignozStepSeconds = s.StepSeconds })
+	}
+	c.setDuration("signoz-external-window", &a.ExternalWindow, s.External.Window)
+	if s.External.StepSeconds != 0 {
+		c.set("signoz-external-step-seconds", func() { a.ExternalStepSeconds = s.External.StepSeconds })
+	}
+	if len(s.LabelFilters) > 0 {
+		c.set("signoz-label-filters", func() { a.labelFilters = s.LabelFilters })
+	}
+	if len(config.Presets) > 0 {
+		c.set("preset", func() { a.Presets = config.Presets })
+	}
+}
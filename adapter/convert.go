@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+
+	signozprov "github.com/brainpodnl/signoz-metrics-adapter/adapter/provider"
+)
+
+// prometheusAdapterConfig is the subset of the prometheus-adapter rules file
+// that can be converted.
+type prometheusAdapterConfig struct {
+	Rules         []prometheusAdapterRule `json:"rules"`
+	ExternalRules []prometheusAdapterRule `json:"externalRules"`
+}
+
+type prometheusAdapterRule struct {
+	SeriesQuery   string                       `json:"seriesQuery"`
+	SeriesFilters []map[string]string          `json:"seriesFilters"`
+	Resources     prometheusAdapterResources   `json:"resources"`
+	Name          prometheusAdapterNameMapping `json:"name"`
+	MetricsQuery  string                       `json:"metricsQuery"`
+}
+
+type prometheusAdapterResources struct {
+	Template  string                       `json:"template"`
+	Overrides map[string]map[string]string `json:"overrides"`
+}
+
+type prometheusAdapterNameMapping struct {
+	Matches string `json:"matches"`
+	As      string `json:"as"`
+}
+
+// runConvertConfig implements the convert-config subcommand. The converted
+// config is written to stdout, everything that could not be mapped to
+// stderr.
+func runConvertConfig(args []string, stdout, stderr io.Writer) error {
+	flags := pflag.NewFlagSet("convert-config", pflag.ContinueOnError)
+	from := flags.String("from", "prometheus-adapter", "Format of the input file (prometheus-adapter)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from != "prometheus-adapter" {
+		return fmt.Errorf("unsupported input format %q", *from)
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: convert-config --from=prometheus-adapter <rules.yaml>")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var input prometheusAdapterConfig
+	if err := yaml.Unmarshal(data, &input); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", flags.Arg(0), err)
+	}
+
+	var output signozprov.MetricsConfig
+	report := func(rule string, format string, args ...any) {
+		fmt.Fprintf(stderr, "%s: %s\n", rule, fmt.Sprintf(format, args...))
+	}
+
+	seen := map[string]bool{}
+	rules := append(input.Rules, input.ExternalRules...)
+	for i, rule := range rules {
+		ruleName := fmt.Sprintf("rules[%d]", i)
+		if i >= len(input.Rules) {
+			ruleName = fmt.Sprintf("externalRules[%d]", i-len(input.Rules))
+		}
+
+		metric, err := convertPrometheusAdapterRule(rule, func(format string, args ...any) {
+			report(ruleName, format, args...)
+		})
+		if err != nil {
+			report(ruleName, "skipped: %v", err)
+			continue
+		}
+		if seen[metric.Name] {
+			report(ruleName, "skipped: metric %q is already defined by an earlier rule", metric.Name)
+			continue
+		}
+		seen[metric.Name] = true
+		output.Metrics = append(output.Metrics, metric)
+	}
+
+	out, err := yaml.Marshal(&output)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(out)
+	return err
+}
+
+func convertPrometheusAdapterRule(rule prometheusAdapterRule, report func(format string, args ...any)) (signozprov.MetricConfig, error) {
+	name, matchers, err := parsePromSelector(rule.SeriesQuery)
+	if err != nil {
+		return signozprov.MetricConfig{}, err
+	}
+	if name == "" {
+		return signozprov.MetricConfig{}, fmt.Errorf("seriesQuery %q does not select a single metric name", rule.SeriesQuery)
+	}
+
+	metric := signozprov.MetricConfig{Name: name}
+	for _, m := range matchers {
+		// `label!=""` only asserts the label exists, which grouping by the
+		// pod attribute already implies.
+		if m.Operator == "!=" && m.Value == "" {
+			continue
+		}
+		metric.LabelFilters = append(metric.LabelFilters, m)
+	}
+
+	if len(rule.SeriesFilters) > 0 {
+		report("seriesFilters are not supported and were dropped")
+	}
+	if rule.Name.As != "" {
+		report("metric is renamed to %q in prometheus-adapter but is exposed as %q", rule.Name.As, name)
+	}
+	for label, override := range rule.Resources.Overrides {
+		if override["resource"] == "pod" && label != "k8s.pod.name" {
+			report("pods are identified by label %q instead of k8s.pod.name", label)
+		}
+	}
+	if rule.Resources.Template != "" {
+		report("resource template %q is not supported", rule.Resources.Template)
+	}
+	if rule.MetricsQuery != "" && rule.MetricsQuery != "sum(<<.Series>>{<<.LabelMatchers>>}) by (<<.GroupBy>>)" {
+		report("metricsQuery %q was not translated, review the aggregation", rule.MetricsQuery)
+	}
+
+	return metric, nil
+}
+
+var promMatcherRegex = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_.]*)\s*(=~|!~|!=|=)\s*("(?:[^"\\]|\\.)*")\s*$`)
+
+// parsePromSelector parses a PromQL series selector like
+// `metric{label="value",other!=""}` into its name and label matchers.
+func parsePromSelector(s string) (string, []signozprov.LabelFilter, error) {
+	s = strings.TrimSpace(s)
+	open := strings.Index(s, "{")
+	if open < 0 {
+		return s, nil, nil
+	}
+	if !strings.HasSuffix(s, "}") {
+		return "", nil, fmt.Errorf("invalid series selector %q", s)
+	}
+
+	name := strings.TrimSpace(s[:open])
+	var matchers []signozprov.LabelFilter
+	for _, part := range splitMatchers(s[open+1 : len(s)-1]) {
+		m := promMatcherRegex.FindStringSubmatch(part)
+		if m == nil {
+			return "", nil, fmt.Errorf("invalid label matcher %q", part)
+		}
+		value, err := strconv.Unquote(m[3])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid label matcher %q: %w", part, err)
+		}
+		if m[1] == "__name__" {
+			if m[2] != "=" {
+				return "", nil, fmt.Errorf("metric name matcher %q is not supported", part)
+			}
+			name = value
+			continue
+		}
+		matchers = append(matchers, signozprov.LabelFilter{Key: m[1], Operator: m[2], Value: value})
+	}
+	return name, matchers, nil
+}
+
+// splitMatchers splits a matcher list on commas outside of quoted values.
+func splitMatchers(s string) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	signozprov "github.com/brainpodnl/signoz-metrics-adapter/adapter/provider"
+)
+
+// doctorTimeout bounds each check that talks to the cluster or SigNoz.
+const doctorTimeout = 30 * time.Second
+
+var apiServiceResource = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+
+// doctorAPIServices are the APIServices the adapter serves.
+var doctorAPIServices = []string{"v1beta1.custom.metrics.k8s.io", "v1beta1.external.metrics.k8s.io"}
+
+// doctor runs the self-checks of the doctor subcommand.
+type doctor struct {
+	out    io.Writer
+	failed bool
+}
+
+func (d *doctor) report(status, check, format string, args ...any) {
+	fmt.Fprintf(d.out, "%-4s  %s: %s\n", status, check, fmt.Sprintf(format, args...))
+	if status == "FAIL" {
+		d.failed = true
+	}
+}
+
+func (d *doctor) check(check string, err error, format string, args ...any) bool {
+	if err != nil {
+		d.report("FAIL", check, "%v", err)
+		return false
+	}
+	d.report("PASS", check, format, args...)
+	return true
+}
+
+// runDoctor verifies, in order, the configuration, access to the mapped
+// resources, the APIService registrations, SigNoz reachability and
+// authentication, and one query per configured metric. configErrs are the
+// errors of loading the configuration. It returns false if any check
+// failed.
+func (a *SignozAdapter) runDoctor(out io.Writer, configErrs []error) bool {
+	d := &doctor{out: out}
+	if !d.check("configuration", errors.Join(configErrs...), "%d metrics", len(a.metricConfigs)) {
+		return false
+	}
+
+	clientConfig, err := a.ClientConfig()
+	if err != nil {
+		d.report("FAIL", "kubeconfig", "%v", err)
+		return false
+	}
+	d.report("PASS", "kubeconfig", "connecting to %s", clientConfig.Host)
+	client, err := kubernetes.NewForConfig(clientConfig)
+	if !d.check("kubernetes client", err, "ok") {
+		return false
+	}
+	dynClient, err := a.DynamicClient()
+	if !d.check("dynamic client", err, "ok") {
+		return false
+	}
+	mapper, err := a.RESTMapper()
+	if !d.check("REST mapper", err, "ok") {
+		return false
+	}
+
+	signoz, err := a.signozQuerier()
+	if !d.check("SigNoz client", err, "%d endpoints", len(a.endpoints)) {
+		return false
+	}
+	opts := a.providerOptions()
+	opts.Poll = signozprov.PollOptions{}
+	provider := signozprov.NewSignozProvider(signoz, opts, dynClient, mapper)
+
+	var resources []schema.GroupResource
+	for _, info := range provider.ListAllMetrics() {
+		if !slices.Contains(resources, info.GroupResource) {
+			resources = append(resources, info.GroupResource)
+		}
+	}
+	for _, gr := range resources {
+		d.checkList(client, gr)
+	}
+
+	for _, name := range doctorAPIServices {
+		d.checkAPIService(dynClient.Resource(apiServiceResource), name)
+	}
+
+	if !d.checkSigNoz(signoz) {
+		return false
+	}
+
+	checker, ok := provider.(signozprov.MetricChecker)
+	if !ok {
+		return !d.failed
+	}
+	for _, m := range a.metricConfigs {
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		series, err := checker.CheckMetric(ctx, m.Name)
+		cancel()
+		switch {
+		case err != nil:
+			d.report("FAIL", "metric "+m.Name, "%v", err)
+		case series == 0:
+			d.report("WARN", "metric "+m.Name, "no series in the window")
+		default:
+			d.report("PASS", "metric "+m.Name, "%d series", series)
+		}
+	}
+	return !d.failed
+}
+
+// checkList verifies that the adapter may list the resource cluster-wide.
+func (d *doctor) checkList(client kubernetes.Interface, gr schema.GroupResource) {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:     "list",
+				Group:    gr.Group,
+				Resource: gr.Resource,
+			},
+		},
+	}, metav1.CreateOptions{})
+	check := "list " + gr.String()
+	switch {
+	case err != nil:
+		d.report("FAIL", check, "%v", err)
+	case !review.Status.Allowed:
+		d.report("FAIL", check, "not allowed: %s", review.Status.Reason)
+	default:
+		d.report("PASS", check, "allowed")
+	}
+}
+
+// checkAPIService verifies that the APIService is registered and available.
+func (d *doctor) checkAPIService(apiServices dynamic.ResourceInterface, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	check := "APIService " + name
+	obj, err := apiServices.Get(ctx, name, metav1.GetOptions{})
+	if apierr.IsNotFound(err) {
+		d.report("FAIL", check, "not registered")
+		return
+	}
+	if err != nil {
+		d.report("FAIL", check, "%v", err)
+		return
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if !ok || condition["type"] != "Available" {
+			continue
+		}
+		if condition["status"] == "True" {
+			d.report("PASS", check, "available")
+		} else {
+			d.report("FAIL", check, "not available: %v: %v", condition["reason"], condition["message"])
+		}
+		return
+	}
+	d.report("FAIL", check, "no Available condition")
+}
+
+// checkSigNoz sends a minimal query to verify that SigNoz is reachable and
+// accepts the credentials. A rejected or rate limited query, e.g. for an
+// unknown metric, still proves both; any other error fails the check.
+func (d *doctor) checkSigNoz(signoz signozprov.Querier) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	end := time.Now()
+	_, err := signoz.Query(ctx, signozprov.SignozQueryRangeOptions{
+		RequestType: "time_series",
+		Start:       end.Add(-time.Minute).UnixMilli(),
+		End:         end.UnixMilli(),
+		CompositeQuery: signozprov.SignozCompositeQuery{
+			Queries: []signozprov.SignozQuery{{
+				Type: "builder_query",
+				Spec: signozprov.SignozQuerySpec{
+					Name:         "A",
+					Signal:       "metrics",
+					StepInterval: 60,
+					Aggregations: []signozprov.SignozMetricAggregation{{
+						MetricName:       "signoz_adapter_doctor",
+						TimeAggregation:  "latest",
+						SpaceAggregation: "sum",
+					}},
+				},
+			}},
+		},
+	})
+
+	var unavailable *signozprov.UnavailableError
+	var auth *signozprov.AuthError
+	var invalid *signozprov.QueryInvalidError
+	var rateLimited *signozprov.RateLimitedError
+	switch {
+	case err == nil, errors.As(err, &invalid), errors.As(err, &rateLimited):
+		d.report("PASS", "SigNoz reachability", "reachable")
+		d.report("PASS", "SigNoz authentication", "credentials accepted")
+		return true
+	case errors.As(err, &unavailable):
+		d.report("FAIL", "SigNoz reachability", "%v", err)
+	case errors.As(err, &auth):
+		d.report("PASS", "SigNoz reachability", "reachable")
+		d.report("FAIL", "SigNoz authentication", "%v", err)
+	default:
+		// E.g. the credentials could not be obtained or the response not
+		// decoded.
+		d.report("FAIL", "SigNoz authentication", "%v", err)
+	}
+	return false
+}
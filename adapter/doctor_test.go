@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	signozprov "github.com/brainpodnl/signoz-metrics-adapter/adapter/provider"
+)
+
+// failingAuthenticator fails to obtain credentials, like an exec credential
+// plugin that exits with an error.
+type failingAuthenticator struct{}
+
+func (failingAuthenticator) Authenticate(ctx context.Context, request *http.Request) error {
+	return fmt.Errorf("credential command failed: exit status 1")
+}
+
+type errQuerier struct{ err error }
+
+func (q errQuerier) Query(ctx context.Context, query signozprov.SignozQueryRangeOptions) (*signozprov.SignozQueryRangeResponse, error) {
+	return &signozprov.SignozQueryRangeResponse{}, q.err
+}
+
+func TestCheckSigNozFailingAuthenticator(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	client := signozprov.NewSignozClient(server.URL, "", nil)
+	client.Auth = failingAuthenticator{}
+	var out bytes.Buffer
+	d := &doctor{out: &out}
+	if d.checkSigNoz(client) {
+		t.Fatalf("check passed without credentials:\n%s", out.String())
+	}
+	if !d.failed || !strings.Contains(out.String(), "FAIL  SigNoz authentication: credential command failed") {
+		t.Fatalf("got output\n%s, want a failed authentication check", out.String())
+	}
+	if requests.Load() != 0 {
+		t.Fatalf("sent %d requests, want none", requests.Load())
+	}
+}
+
+func TestCheckSigNoz(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		pass bool
+	}{
+		{name: "success", pass: true},
+		{name: "rejected query", err: &signozprov.QueryInvalidError{StatusCode: http.StatusBadRequest}, pass: true},
+		{name: "rate limited", err: &signozprov.RateLimitedError{}, pass: true},
+		{name: "unreachable", err: &signozprov.UnavailableError{Err: errors.New("connection refused")}},
+		{name: "rejected key", err: &signozprov.AuthError{StatusCode: http.StatusUnauthorized}},
+		{name: "undecodable response", err: &signozprov.DecodeError{Err: errors.New("unexpected EOF")}},
+		{name: "other error", err: errors.New("token endpoint returned no token")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			d := &doctor{out: &out}
+			if got := d.checkSigNoz(errQuerier{tt.err}); got != tt.pass || d.failed == tt.pass {
+				t.Fatalf("got %v, want %v; output:\n%s", got, tt.pass, out.String())
+			}
+		})
+	}
+}
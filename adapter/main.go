@@ -18,10 +18,21 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/component-base/logs"
 	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
@@ -33,67 +44,725 @@ import (
 
 type SignozAdapter struct {
 	basecmd.AdapterBase
-	SignozEndpoint         string
-	SignozAPIKey           string
-	SignozTimerangeMinutes int64
-	SignozMetrics          string
-	SignozFilterExpression string
+	Config                  string
+	ConfigReloadInterval    time.Duration
+	SignozEndpoint          string
+	SignozEndpointFile      string
+	SignozAPIPath           string
+	SignozFlavor            string
+	SignozAPIKey            string
+	SignozAPIKeyFile        string
+	AuthMode                string
+	OAuth2TokenURL          string
+	OAuth2ClientID          string
+	OAuth2ClientSecret      string
+	OAuth2ClientSecretFile  string
+	OAuth2Scopes            []string
+	SignozCAFile            string
+	SignozCertFile          string
+	SignozKeyFile           string
+	SignozInsecure          bool
+	APIKeySecret            string
+	APIKeySecretKey         string
+	APIKeySecretCert        bool
+	TokenExchangeURL        string
+	TokenExchangeAudience   string
+	ServiceAccountTokenFile string
+	ExecCommand             string
+	ExecArgs                []string
+	SignozTimerangeMinutes  int64
+	SignozWindow            string
+	HPASyncPeriod           time.Duration
+	AutoWindowMultiplier    int
+	SignozStepSeconds       int64
+	ExternalWindow          time.Duration
+	ExternalStepSeconds     int64
+	SignozMetrics           string
+	SignozMetricsConfig     string
+	Presets                 []string
+	SignozFilterExpression  string
+	SignozLabelFilters      string
+	SignozPollInterval      time.Duration
+	SignozPollWorkers       int
+	SignozPollIdleTimeout   time.Duration
+	SignozPollJitter        float64
+	MetricTimeout           time.Duration
+	QueryCacheTTL           time.Duration
+	QueryBatchWindow        time.Duration
+	RetryMaxAttempts        int
+	RetryBaseDelay          time.Duration
+	RetryStatusCodes        []int
+	BreakerFailures         int
+	BreakerOpenDuration     time.Duration
+	BreakerServeStale       bool
+	MaxStaleAge             time.Duration
+	QueryTimeout            time.Duration
+	SignozDNSCacheTTL       time.Duration
+	SignozDNSNegativeTTL    time.Duration
+	SignozEndpointIPs       string
+	SignozDNSServers        []string
+	SignozHostAliases       []string
+	PartialResponse         string
+	RequireRunningPods      bool
+	ExternalDenyNamespaces  []string
+	EndpointAllowlist       []string
+	UserAgent               string
+	ClusterName             string
+	SignozHeaders           []string
+	ProxyURL                string
+	SigningKeyFile          string
+	SigningAlgorithm        string
+	SigningHeaders          []string
+	SignatureHeader         string
+	RateLimitQPS            float64
+	RateLimitBurst          int
+	RateLimitBy             string
+	MaxInflight             int
+	MaxQueued               int
+	QueueTimeout            time.Duration
+	PriorityUsers           []string
+	ShadowSampleRate        float64
+	ShadowTolerance         float64
+	ExcludeUnreadyPods      bool
+	PodLabelKeys            []string
+	NamespaceLabelKey       string
+	ExportConfigMap         string
+	PrometheusProxy         bool
+	VPAFeed                 bool
+	VPACPUMetric            string
+	VPAMemoryMetric         string
+	ManageAPIServices       bool
+	APIServiceService       string
+	APIServiceCertSecret    string
+	APIServiceOwner         string
+	MetricCRD               bool
+
+	config *AdapterConfig
+
+	// Derived by complete.
+	endpoints  []string
+	window     time.Duration
+	apiKeyFile *signozprov.SecretFile
+	// oauth2ClientSecret is set when the client secret is read from a file.
+	oauth2ClientSecret *signozprov.SecretFile
+	tlsFiles           *signozprov.TLSFiles
+	// serviceAccountToken is set when the API key is replaced by a token
+	// exchange.
+	serviceAccountToken *signozprov.SecretFile
+	allowlist           *signozprov.EndpointAllowlist
+	headers             http.Header
+	proxyURL            *url.URL
+	signer              *signozprov.RequestSigner
+	// execEnv is the environment of the credential plugin, only settable in
+	// the config file.
+	execEnv       map[string]string
+	staticIPs     map[string][]string
+	dnsServers    []string
+	labelFilters  []signozprov.LabelFilter
+	metricConfigs []signozprov.MetricConfig
+	queryFlags    queryFlags
+}
+
+// signozTransport returns the HTTP transport used to reach SigNoz, resolving
+// the endpoint hosts through a caching resolver.
+func (a *SignozAdapter) signozTransport() *http.Transport {
+	resolver := signozprov.NewCachingResolver(a.SignozDNSCacheTTL, a.SignozDNSNegativeTTL, a.staticIPs)
+	if len(a.dnsServers) > 0 {
+		resolver.UseServers(a.dnsServers)
+	}
+	if a.allowlist != nil {
+		resolver.Restrict(a.allowlist)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = resolver.DialContext(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	if a.tlsFiles != nil {
+		transport.TLSClientConfig = a.tlsFiles.Config(a.SignozInsecure)
+	}
+	if a.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(a.proxyURL)
+	}
+	return transport
+}
+
+// mappingExporter returns an exporter writing to the ConfigMap named by
+// --export-configmap.
+func (a *SignozAdapter) mappingExporter() (*signozprov.MappingExporter, error) {
+	namespace, name, _ := strings.Cut(a.ExportConfigMap, "/")
+
+	clientConfig, err := a.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	return signozprov.NewMappingExporter(client, namespace, name), nil
+}
+
+// apiServiceRegistrar returns a registrar for the APIServices of the Service
+// named by --apiservice-service.
+func (a *SignozAdapter) apiServiceRegistrar() (*signozprov.APIServiceRegistrar, error) {
+	serviceNamespace, serviceName, _ := strings.Cut(a.APIServiceService, "/")
+	secretNamespace, secretName, _ := strings.Cut(a.APIServiceCertSecret, "/")
+
+	clientConfig, err := a.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynClient, err := a.DynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	return signozprov.NewAPIServiceRegistrar(client, dynClient,
+		types.NamespacedName{Namespace: serviceNamespace, Name: serviceName},
+		types.NamespacedName{Namespace: secretNamespace, Name: secretName},
+		a.APIServiceOwner), nil
+}
+
+// secretWatcher returns a watcher of the Secret named by
+// --signoz-api-key-secret.
+func (a *SignozAdapter) secretWatcher() (*signozprov.SecretWatcher, error) {
+	namespace, name, _ := strings.Cut(a.APIKeySecret, "/")
+
+	clientConfig, err := a.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	return signozprov.NewSecretWatcher(client, namespace, name, a.APIKeySecretKey), nil
+}
+
+// signozQuerier returns the client for the configured SigNoz endpoints.
+func (a *SignozAdapter) signozQuerier() (signozprov.Querier, error) {
+	transport := a.signozTransport()
+	var auth signozprov.Authenticator
+	switch {
+	case a.serviceAccountToken != nil:
+		auth = signozprov.NewTokenExchange(a.TokenExchangeURL, a.TokenExchangeAudience, a.serviceAccountToken, transport)
+	case a.ExecCommand != "":
+		auth = signozprov.NewExecCredential(a.ExecCommand, a.ExecArgs, a.execEnv)
+	case a.AuthMode == signozprov.AuthModeOAuth2:
+		secret := func() string { return a.OAuth2ClientSecret }
+		if a.oauth2ClientSecret != nil {
+			secret = a.oauth2ClientSecret.Value
+		}
+		auth = signozprov.NewOAuth2ClientCredentials(a.OAuth2TokenURL, a.OAuth2ClientID, secret, a.OAuth2Scopes, transport)
+	case a.APIKeySecret != "":
+		watcher, err := a.secretWatcher()
+		if err != nil {
+			return nil, err
+		}
+		watcher.ClientCertificate = a.APIKeySecretCert
+		if err := watcher.Start(wait.NeverStop); err != nil {
+			return nil, err
+		}
+		if a.APIKeySecretCert {
+			if transport.TLSClientConfig == nil {
+				transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			}
+			transport.TLSClientConfig.GetClientCertificate = watcher.GetClientCertificate
+		}
+		auth = watcher
+		if a.AuthMode == signozprov.AuthModeBearer {
+			auth = signozprov.NewBearerToken(watcher.APIKey)
+		}
+	case a.AuthMode == signozprov.AuthModeBearer:
+		auth = signozprov.NewBearerToken(func() (string, error) {
+			if a.apiKeyFile != nil {
+				return a.apiKeyFile.Value(), nil
+			}
+			return a.SignozAPIKey, nil
+		})
+	}
+	newClient := func(endpoint string) *signozprov.SignozClient {
+		client := signozprov.NewSignozClient(endpoint, a.SignozAPIKey, transport)
+		client.ApiKeyFile = a.apiKeyFile
+		if auth != nil {
+			client.Auth = auth
+		}
+		client.QueryPath = a.SignozAPIPath
+		client.UserAgent = a.UserAgent
+		client.Headers = a.headers
+		client.Signer = a.signer
+		client.Flavor = signozprov.ResolveFlavor(signozprov.Flavor(a.SignozFlavor), endpoint)
+		client.Timeout = a.QueryTimeout
+		client.Retry = signozprov.RetryPolicy{
+			MaxAttempts: a.RetryMaxAttempts,
+			BaseDelay:   a.RetryBaseDelay,
+			StatusCodes: a.RetryStatusCodes,
+		}
+		if a.BreakerFailures > 0 {
+			client.Breaker = signozprov.NewCircuitBreaker(endpoint, a.BreakerFailures, a.BreakerOpenDuration)
+		}
+		klog.Infof("using %s flavor for endpoint %s", client.Flavor, endpoint)
+		return client
+	}
+	if len(a.endpoints) == 1 {
+		return newClient(a.endpoints[0]), nil
+	}
+	clients := make([]*signozprov.SignozClient, len(a.endpoints))
+	for i, e := range a.endpoints {
+		clients[i] = newClient(e)
+	}
+	return signozprov.NewFederatedClient(clients, a.PartialResponse == "allow"), nil
+}
+
+// replicaName identifies this replica for spreading polls, by the hostname,
+// which is the pod name.
+func replicaName() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// providerOptions returns the provider options for the configured settings,
+// without the mapping exporter.
+func (a *SignozAdapter) providerOptions() signozprov.Options {
+	return signozprov.Options{
+		Custom: signozprov.QueryRange{
+			Window:      a.window,
+			StepSeconds: a.SignozStepSeconds,
+		},
+		External: signozprov.QueryRange{
+			Window:      a.ExternalWindow,
+			StepSeconds: a.ExternalStepSeconds,
+		},
+		Metrics:          a.metricConfigs,
+		MetricTimeout:    a.MetricTimeout,
+		QueryCacheTTL:    a.QueryCacheTTL,
+		ServeStale:       a.BreakerServeStale,
+		MaxStaleAge:      a.MaxStaleAge,
+		FilterExpression: a.SignozFilterExpression,
+		LabelFilters:     a.labelFilters,
+		Poll: signozprov.PollOptions{
+			Interval:    a.SignozPollInterval,
+			Workers:     a.SignozPollWorkers,
+			IdleTimeout: a.SignozPollIdleTimeout,
+			Jitter:      a.SignozPollJitter,
+			Replica:     replicaName(),
+		},
+		ExternalDenyNamespaces: a.ExternalDenyNamespaces,
+		RateLimit: signozprov.RateLimitOptions{
+			QPS:   a.RateLimitQPS,
+			Burst: a.RateLimitBurst,
+			By:    a.RateLimitBy,
+		},
+		Concurrency: signozprov.ConcurrencyOptions{
+			MaxInflight:   a.MaxInflight,
+			MaxQueued:     a.MaxQueued,
+			QueueTimeout:  a.QueueTimeout,
+			PriorityUsers: a.PriorityUsers,
+		},
+		Shadow: signozprov.ShadowOptions{
+			SampleRate: a.ShadowSampleRate,
+			Tolerance:  a.ShadowTolerance,
+		},
+		Pods: signozprov.PodFilter{
+			RequireRunning: a.RequireRunningPods,
+			ExcludeUnready: a.ExcludeUnreadyPods,
+		},
+		PodLabelKeys:      a.PodLabelKeys,
+		NamespaceLabelKey: a.NamespaceLabelKey,
+	}
+}
+
+// applyEnv fills settings that were not set by flags from the SIGNOZ_*
+// environment variables. They are only read without --config.
+func (a *SignozAdapter) applyEnv() []error {
+	var errs []error
+	// unset reports whether a flag with a non-empty default was not set on
+	// the command line; the others are unset while empty.
+	unset := func(flag string) bool { return !a.Flags().Changed(flag) }
+
+	if a.SignozEndpoint == "" {
+		a.SignozEndpoint = os.Getenv("SIGNOZ_URL")
+	}
+
+	if a.SignozAPIKey == "" {
+		a.SignozAPIKey = os.Getenv("SIGNOZ_API_KEY")
+	}
+
+	if a.SignozEndpointFile == "" {
+		a.SignozEndpointFile = os.Getenv("SIGNOZ_URL_FILE")
+	}
+
+	if a.SignozAPIKeyFile == "" {
+		a.SignozAPIKeyFile = os.Getenv("SIGNOZ_API_KEY_FILE")
+	}
+
+	if unset("signoz-auth-mode") && os.Getenv("SIGNOZ_AUTH_MODE") != "" {
+		a.AuthMode = os.Getenv("SIGNOZ_AUTH_MODE")
+	}
+
+	if a.OAuth2TokenURL == "" {
+		a.OAuth2TokenURL = os.Getenv("SIGNOZ_OAUTH2_TOKEN_URL")
+	}
+
+	if a.OAuth2ClientID == "" {
+		a.OAuth2ClientID = os.Getenv("SIGNOZ_OAUTH2_CLIENT_ID")
+	}
+
+	if a.OAuth2ClientSecret == "" {
+		a.OAuth2ClientSecret = os.Getenv("SIGNOZ_OAUTH2_CLIENT_SECRET")
+	}
+
+	if a.OAuth2ClientSecretFile == "" {
+		a.OAuth2ClientSecretFile = os.Getenv("SIGNOZ_OAUTH2_CLIENT_SECRET_FILE")
+	}
+
+	if len(a.OAuth2Scopes) == 0 && os.Getenv("SIGNOZ_OAUTH2_SCOPES") != "" {
+		a.OAuth2Scopes = strings.Split(os.Getenv("SIGNOZ_OAUTH2_SCOPES"), ",")
+	}
+
+	if a.SignozCAFile == "" {
+		a.SignozCAFile = os.Getenv("SIGNOZ_CA_FILE")
+	}
+
+	if a.SignozCertFile == "" {
+		a.SignozCertFile = os.Getenv("SIGNOZ_CERT_FILE")
+	}
+
+	if a.SignozKeyFile == "" {
+		a.SignozKeyFile = os.Getenv("SIGNOZ_KEY_FILE")
+	}
+
+	if a.APIKeySecret == "" {
+		a.APIKeySecret = os.Getenv("SIGNOZ_API_KEY_SECRET")
+	}
+
+	if unset("signoz-timerange-minutes") && os.Getenv("SIGNOZ_TIMERANGE_MINUTES") != "" {
+		val, err := strconv.ParseInt(os.Getenv("SIGNOZ_TIMERANGE_MINUTES"), 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_TIMERANGE_MINUTES: invalid integer %q", os.Getenv("SIGNOZ_TIMERANGE_MINUTES")))
+		} else {
+			a.SignozTimerangeMinutes = val
+		}
+	}
+
+	if unset("signoz-step-seconds") && os.Getenv("SIGNOZ_STEP_SECONDS") != "" {
+		val, err := strconv.ParseInt(os.Getenv("SIGNOZ_STEP_SECONDS"), 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_STEP_SECONDS: invalid integer %q", os.Getenv("SIGNOZ_STEP_SECONDS")))
+		} else {
+			a.SignozStepSeconds = val
+		}
+	}
+
+	if a.SignozWindow == "" {
+		a.SignozWindow = os.Getenv("SIGNOZ_WINDOW")
+	}
+
+	if unset("signoz-external-window") && os.Getenv("SIGNOZ_EXTERNAL_WINDOW") != "" {
+		val, err := time.ParseDuration(os.Getenv("SIGNOZ_EXTERNAL_WINDOW"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_EXTERNAL_WINDOW: invalid duration %q", os.Getenv("SIGNOZ_EXTERNAL_WINDOW")))
+		} else {
+			a.ExternalWindow = val
+		}
+	}
+
+	if unset("signoz-external-step-seconds") && os.Getenv("SIGNOZ_EXTERNAL_STEP_SECONDS") != "" {
+		val, err := strconv.ParseInt(os.Getenv("SIGNOZ_EXTERNAL_STEP_SECONDS"), 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_EXTERNAL_STEP_SECONDS: invalid integer %q", os.Getenv("SIGNOZ_EXTERNAL_STEP_SECONDS")))
+		} else {
+			a.ExternalStepSeconds = val
+		}
+	}
+
+	if a.SignozMetrics == "" {
+		a.SignozMetrics = os.Getenv("SIGNOZ_METRICS")
+	}
+
+	if a.SignozMetricsConfig == "" {
+		a.SignozMetricsConfig = os.Getenv("SIGNOZ_METRICS_CONFIG")
+	}
+
+	if len(a.Presets) == 0 && os.Getenv("SIGNOZ_PRESETS") != "" {
+		a.Presets = strings.Split(os.Getenv("SIGNOZ_PRESETS"), ",")
+	}
+
+	if a.SigningKeyFile == "" {
+		a.SigningKeyFile = os.Getenv("SIGNOZ_SIGNING_KEY_FILE")
+	}
+
+	if a.ClusterName == "" {
+		a.ClusterName = os.Getenv("SIGNOZ_CLUSTER_NAME")
+	}
+
+	if len(a.SignozHeaders) == 0 && os.Getenv("SIGNOZ_HEADERS") != "" {
+		a.SignozHeaders = strings.Split(os.Getenv("SIGNOZ_HEADERS"), ",")
+	}
+
+	if a.ProxyURL == "" {
+		a.ProxyURL = os.Getenv("SIGNOZ_PROXY_URL")
+	}
+
+	if unset("namespace-label-key") && os.Getenv("SIGNOZ_NAMESPACE_LABEL_KEY") != "" {
+		a.NamespaceLabelKey = os.Getenv("SIGNOZ_NAMESPACE_LABEL_KEY")
+	}
+
+	if len(a.EndpointAllowlist) == 0 && os.Getenv("SIGNOZ_ENDPOINT_ALLOWLIST") != "" {
+		a.EndpointAllowlist = strings.Split(os.Getenv("SIGNOZ_ENDPOINT_ALLOWLIST"), ",")
+	}
+
+	if a.SignozEndpointIPs == "" {
+		a.SignozEndpointIPs = os.Getenv("SIGNOZ_ENDPOINT_IPS")
+	}
+
+	if len(a.SignozDNSServers) == 0 && os.Getenv("SIGNOZ_DNS_SERVERS") != "" {
+		a.SignozDNSServers = strings.Split(os.Getenv("SIGNOZ_DNS_SERVERS"), ",")
+	}
+
+	if len(a.SignozHostAliases) == 0 && os.Getenv("SIGNOZ_HOST_ALIASES") != "" {
+		a.SignozHostAliases = strings.Split(os.Getenv("SIGNOZ_HOST_ALIASES"), ",")
+	}
+
+	if a.SignozFilterExpression == "" {
+		a.SignozFilterExpression = os.Getenv("SIGNOZ_FILTER_EXPRESSION")
+	}
+
+	if a.SignozLabelFilters == "" {
+		a.SignozLabelFilters = os.Getenv("SIGNOZ_LABEL_FILTERS")
+	}
+
+	if a.TokenExchangeURL == "" {
+		a.TokenExchangeURL = os.Getenv("SIGNOZ_TOKEN_EXCHANGE_URL")
+	}
+
+	if a.TokenExchangeAudience == "" {
+		a.TokenExchangeAudience = os.Getenv("SIGNOZ_TOKEN_EXCHANGE_AUDIENCE")
+	}
+
+	if unset("signoz-token-file") && os.Getenv("SIGNOZ_TOKEN_FILE") != "" {
+		a.ServiceAccountTokenFile = os.Getenv("SIGNOZ_TOKEN_FILE")
+	}
+
+	if a.ExecCommand == "" {
+		a.ExecCommand = os.Getenv("SIGNOZ_EXEC_COMMAND")
+	}
+
+	if len(a.ExecArgs) == 0 && os.Getenv("SIGNOZ_EXEC_ARGS") != "" {
+		a.ExecArgs = strings.Split(os.Getenv("SIGNOZ_EXEC_ARGS"), ",")
+	}
+
+	if unset("signoz-flavor") && os.Getenv("SIGNOZ_FLAVOR") != "" {
+		a.SignozFlavor = os.Getenv("SIGNOZ_FLAVOR")
+	}
+
+	if unset("signoz-api-path") && os.Getenv("SIGNOZ_API_PATH") != "" {
+		a.SignozAPIPath = os.Getenv("SIGNOZ_API_PATH")
+	}
+
+	if unset("partial-response") && os.Getenv("SIGNOZ_PARTIAL_RESPONSE") != "" {
+		a.PartialResponse = os.Getenv("SIGNOZ_PARTIAL_RESPONSE")
+	}
+
+	if unset("signoz-poll-interval") && os.Getenv("SIGNOZ_POLL_INTERVAL") != "" {
+		val, err := time.ParseDuration(os.Getenv("SIGNOZ_POLL_INTERVAL"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_POLL_INTERVAL: invalid duration %q", os.Getenv("SIGNOZ_POLL_INTERVAL")))
+		} else {
+			a.SignozPollInterval = val
+		}
+	}
+
+	if unset("query-batch-window") && os.Getenv("SIGNOZ_QUERY_BATCH_WINDOW") != "" {
+		val, err := time.ParseDuration(os.Getenv("SIGNOZ_QUERY_BATCH_WINDOW"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_QUERY_BATCH_WINDOW: invalid duration %q", os.Getenv("SIGNOZ_QUERY_BATCH_WINDOW")))
+		} else {
+			a.QueryBatchWindow = val
+		}
+	}
+
+	if unset("signoz-query-timeout") && os.Getenv("SIGNOZ_QUERY_TIMEOUT") != "" {
+		val, err := time.ParseDuration(os.Getenv("SIGNOZ_QUERY_TIMEOUT"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_QUERY_TIMEOUT: invalid duration %q", os.Getenv("SIGNOZ_QUERY_TIMEOUT")))
+		} else {
+			a.QueryTimeout = val
+		}
+	}
+
+	if unset("query-cache-ttl") && os.Getenv("SIGNOZ_QUERY_CACHE_TTL") != "" {
+		val, err := time.ParseDuration(os.Getenv("SIGNOZ_QUERY_CACHE_TTL"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SIGNOZ_QUERY_CACHE_TTL: invalid duration %q", os.Getenv("SIGNOZ_QUERY_CACHE_TTL")))
+		} else {
+			a.QueryCacheTTL = val
+		}
+	}
+	return errs
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "convert-config" {
+		if err := runConvertConfig(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "convert-config: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// doctor takes the same flags as the adapter itself.
+	args := os.Args
+	doctor := len(args) > 1 && args[1] == "doctor"
+	if doctor {
+		args = append([]string{args[0]}, args[2:]...)
+	}
+
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
 	cmd := &SignozAdapter{}
 	cmd.Name = "signoz-metrics-adapter"
 
-	cmd.Flags().StringVar(&cmd.SignozEndpoint, "signoz-endpoint", "", "SigNoz query endpoint (e.g. https://signoz.example.com)")
+	cmd.Flags().StringVar(&cmd.Config, "config", "", "Path to a YAML config file (apiVersion "+configAPIVersion+") with all adapter settings; flags override it")
+	cmd.Flags().DurationVar(&cmd.ConfigReloadInterval, "config-reload-interval", 30*time.Second, "How often --config and --signoz-metrics-config are checked for changes to the metrics, filters and query ranges (0 disables reloading)")
+	cmd.Flags().StringVar(&cmd.SignozEndpoint, "signoz-endpoint", "", "SigNoz query endpoint (e.g. https://signoz.example.com), comma-separated to federate several endpoints")
+	cmd.Flags().StringVar(&cmd.SignozEndpointFile, "signoz-endpoint-file", "", "File containing the SigNoz endpoint, e.g. from a mounted Secret")
+	cmd.Flags().StringVar(&cmd.SignozAPIPath, "signoz-api-path", signozprov.DefaultQueryPath, "Path of the SigNoz query_range API, appended to the path of the endpoint")
+	cmd.Flags().StringVar(&cmd.SignozFlavor, "signoz-flavor", string(signozprov.FlavorAuto), "SigNoz deployment kind: auto (detect SigNoz Cloud by its domain), cloud or self-hosted")
 	cmd.Flags().StringVar(&cmd.SignozAPIKey, "signoz-api-key", "", "SigNoz API key for authentication")
+	cmd.Flags().StringVar(&cmd.TokenExchangeURL, "signoz-token-exchange-url", "", "Token exchange endpoint (RFC 8693) that trades the ServiceAccount token for a SigNoz bearer token, instead of an API key")
+	cmd.Flags().StringVar(&cmd.TokenExchangeAudience, "signoz-token-exchange-audience", "", "Audience requested from the token exchange endpoint")
+	cmd.Flags().StringVar(&cmd.ServiceAccountTokenFile, "signoz-token-file", "/var/run/secrets/tokens/signoz-token", "Projected ServiceAccount token exchanged at --signoz-token-exchange-url")
+	cmd.Flags().StringVar(&cmd.ExecCommand, "signoz-exec-command", "", "Credential plugin printing an ExecCredential with the SigNoz API key, instead of a static API key")
+	cmd.Flags().StringArrayVar(&cmd.ExecArgs, "signoz-exec-arg", nil, "Argument passed to --signoz-exec-command, may be repeated")
+	cmd.Flags().StringVar(&cmd.SignozAPIKeyFile, "signoz-api-key-file", "", "File containing the SigNoz API key, re-read when it changes")
+	cmd.Flags().StringVar(&cmd.AuthMode, "signoz-auth-mode", signozprov.AuthModeAPIKey, "How requests to SigNoz are authenticated: api-key (SigNoz-Api-Key header), bearer (the API key as bearer token) or oauth2 (client credentials grant)")
+	cmd.Flags().StringVar(&cmd.OAuth2TokenURL, "signoz-oauth2-token-url", "", "Token endpoint of the oauth2 auth mode")
+	cmd.Flags().StringVar(&cmd.OAuth2ClientID, "signoz-oauth2-client-id", "", "Client ID of the oauth2 auth mode")
+	cmd.Flags().StringVar(&cmd.OAuth2ClientSecret, "signoz-oauth2-client-secret", "", "Client secret of the oauth2 auth mode")
+	cmd.Flags().StringVar(&cmd.OAuth2ClientSecretFile, "signoz-oauth2-client-secret-file", "", "File containing the client secret of the oauth2 auth mode, re-read when it changes")
+	cmd.Flags().StringSliceVar(&cmd.OAuth2Scopes, "signoz-oauth2-scopes", nil, "Scopes requested in the oauth2 auth mode")
+	cmd.Flags().StringVar(&cmd.SignozCAFile, "signoz-ca-file", "", "PEM bundle of the CAs SigNoz is verified against instead of the system roots, re-read when it changes")
+	cmd.Flags().StringVar(&cmd.SignozCertFile, "signoz-cert-file", "", "PEM client certificate presented to SigNoz, re-read when it changes")
+	cmd.Flags().StringVar(&cmd.SignozKeyFile, "signoz-key-file", "", "PEM private key of --signoz-cert-file")
+	cmd.Flags().BoolVar(&cmd.SignozInsecure, "signoz-insecure-skip-verify", false, "Do not verify the certificate of SigNoz (insecure, for testing only)")
+	cmd.Flags().StringVar(&cmd.APIKeySecret, "signoz-api-key-secret", "", "Secret (namespace/name) holding the SigNoz API key, watched for rotation")
+	cmd.Flags().StringVar(&cmd.APIKeySecretKey, "signoz-api-key-secret-key", "token", "Key of the API key in --signoz-api-key-secret")
+	cmd.Flags().BoolVar(&cmd.APIKeySecretCert, "signoz-api-key-secret-cert", false, "Also present the client certificate in the tls.crt and tls.key keys of --signoz-api-key-secret, reloaded when it changes")
 	cmd.Flags().Int64Var(&cmd.SignozTimerangeMinutes, "signoz-timerange-minutes", 5, "Time range in minutes to use for signoz queries")
+	cmd.Flags().StringVar(&cmd.SignozWindow, "signoz-window", "", "Query time range as a duration, or auto to derive it from --hpa-sync-period; overrides --signoz-timerange-minutes")
+	cmd.Flags().DurationVar(&cmd.HPASyncPeriod, "hpa-sync-period", 15*time.Second, "Sync period of the HPA controller (--horizontal-pod-autoscaler-sync-period), used by --signoz-window=auto")
+	cmd.Flags().IntVar(&cmd.AutoWindowMultiplier, "auto-window-multiplier", 4, "Number of HPA sync periods covered by --signoz-window=auto")
+	cmd.Flags().Int64Var(&cmd.SignozStepSeconds, "signoz-step-seconds", 0, "Query step in seconds (0 derives it from the time range)")
+	cmd.Flags().DurationVar(&cmd.ExternalWindow, "signoz-external-window", 0, "Query time range for external metrics (0 uses the custom metrics window)")
+	cmd.Flags().Int64Var(&cmd.ExternalStepSeconds, "signoz-external-step-seconds", 0, "Query step in seconds for external metrics (0 uses --signoz-step-seconds)")
 	cmd.Flags().StringVar(&cmd.SignozMetrics, "signoz-metrics", "", "Comma-separated list of metric names to expose")
+	cmd.Flags().StringVar(&cmd.SignozMetricsConfig, "signoz-metrics-config", "", "Path to a YAML file with per-metric configuration")
+	cmd.Flags().StringSliceVar(&cmd.Presets, "preset", nil, "Built-in metric sets to expose ("+strings.Join(signozprov.PresetNames(), ", ")+"), may be repeated")
 	cmd.Flags().StringVar(&cmd.SignozFilterExpression, "signoz-filter-expression", "", "Signoz filter expression e.g. `deployment.environment = 'dev'`")
 
-	logs.AddFlags(cmd.Flags())
-	if err := cmd.Flags().Parse(os.Args); err != nil {
-		klog.Fatalf("unable to parse flags: %v", err)
-	}
+	cmd.Flags().StringVar(&cmd.SignozLabelFilters, "signoz-label-filters", "", "Comma-separated label filters e.g. `service.name=~checkout-.*,k8s.namespace.name=shop`")
 
-	if cmd.SignozEndpoint == "" {
-		cmd.SignozEndpoint = os.Getenv("SIGNOZ_URL")
-		if cmd.SignozEndpoint == "" {
-			klog.Fatal("--signoz-endpoint or SIGNOZ_URL is required")
-		}
-	}
+	cmd.Flags().DurationVar(&cmd.SignozPollInterval, "signoz-poll-interval", 0, "Interval at which all metrics are queried in the background and served from memory (0 disables polling)")
 
-	if cmd.SignozAPIKey == "" {
-		cmd.SignozAPIKey = os.Getenv("SIGNOZ_API_KEY")
-		if cmd.SignozAPIKey == "" {
-			klog.Fatal("--signoz-api-key or SIGNOZ_API_KEY is required")
-		}
+	cmd.Flags().IntVar(&cmd.SignozPollWorkers, "signoz-poll-workers", 4, "Number of metrics refreshed concurrently in polling mode")
+	cmd.Flags().DurationVar(&cmd.SignozPollIdleTimeout, "signoz-poll-idle-timeout", 10*time.Minute, "Stop polling metrics that were not requested for this long (0 polls all metrics)")
+	cmd.Flags().Float64Var(&cmd.SignozPollJitter, "signoz-poll-jitter", 0.1, "Fraction of the poll interval each metric is randomly delayed by, spreading queries of a round")
+	cmd.Flags().DurationVar(&cmd.QueryTimeout, "signoz-query-timeout", signozprov.DefaultQueryTimeout, "Timeout of each SigNoz request not bounded by the time budget of a metric")
+	cmd.Flags().DurationVar(&cmd.MetricTimeout, "signoz-metric-timeout", 0, "Time budget of each query of a metric, overridden by its timeoutSeconds (0 only applies the client timeout)")
+	cmd.Flags().DurationVar(&cmd.QueryCacheTTL, "query-cache-ttl", 0, "How long SigNoz responses are reused for identical queries, overridden by cacheTTLSeconds of a metric (0 disables the cache)")
+	cmd.Flags().DurationVar(&cmd.QueryBatchWindow, "query-batch-window", 0, "How long queries are collected to be sent to SigNoz as one composite query (0 disables batching)")
+	cmd.Flags().IntVar(&cmd.RetryMaxAttempts, "signoz-retry-max-attempts", 1, fmt.Sprintf("Attempts of each SigNoz request including the first, retrying transport errors, timeouts and --signoz-retry-status-codes (1 disables retries, at most %d)", signozprov.MaxRetryAttempts))
+	cmd.Flags().DurationVar(&cmd.RetryBaseDelay, "signoz-retry-base-delay", 200*time.Millisecond, "Backoff before the first retry, doubled for every further retry with jitter")
+	cmd.Flags().IntSliceVar(&cmd.RetryStatusCodes, "signoz-retry-status-codes", []int{502, 503, 504}, "HTTP status codes of SigNoz responses that are retried")
+	cmd.Flags().IntVar(&cmd.BreakerFailures, "circuit-breaker-failures", 0, "Consecutive failed requests after which requests to a SigNoz endpoint fail fast (0 disables the circuit breaker)")
+	cmd.Flags().DurationVar(&cmd.BreakerOpenDuration, "circuit-breaker-open-duration", 30*time.Second, "How long requests fail fast before the endpoint is probed again")
+	cmd.Flags().BoolVar(&cmd.BreakerServeStale, "circuit-breaker-serve-stale", false, fmt.Sprintf("Answer queries failed fast by the circuit breaker with the last successful response of up to %s ago", signozprov.BreakerStaleAge))
+	cmd.Flags().DurationVar(&cmd.MaxStaleAge, "max-stale-age", 0, "How long the value last served for an object answers requests whose query fails or returns no series for it (0 disables the fallback)")
+	cmd.Flags().DurationVar(&cmd.SignozDNSCacheTTL, "signoz-dns-cache-ttl", 30*time.Second, "How long resolved addresses of the SigNoz host are cached")
+	cmd.Flags().DurationVar(&cmd.SignozDNSNegativeTTL, "signoz-dns-negative-ttl", 5*time.Second, "How long failed lookups of the SigNoz host are cached")
+	cmd.Flags().StringVar(&cmd.ClusterName, "cluster-name", "", "Name of the cluster, included in the default User-Agent of SigNoz requests")
+	cmd.Flags().StringVar(&cmd.UserAgent, "signoz-user-agent", "", "User-Agent of SigNoz requests (default signoz-metrics-adapter/<version>, with --cluster-name)")
+	cmd.Flags().StringArrayVar(&cmd.SignozHeaders, "signoz-header", nil, "Static header added to SigNoz requests as 'Name: value', may be repeated")
+	cmd.Flags().StringVar(&cmd.ProxyURL, "signoz-proxy-url", "", "HTTP, HTTPS or SOCKS5 proxy for SigNoz requests, with optional user:password; empty uses HTTPS_PROXY and NO_PROXY")
+	cmd.Flags().StringVar(&cmd.SigningKeyFile, "signoz-signing-key-file", "", "File with the HMAC key SigNoz requests are signed with, for signing gateways (empty disables signing)")
+	cmd.Flags().StringVar(&cmd.SigningAlgorithm, "signoz-signing-algorithm", signozprov.SigningHMACSHA256, "Request signing algorithm: "+strings.Join(signozprov.SigningAlgorithms, " or "))
+	cmd.Flags().StringSliceVar(&cmd.SigningHeaders, "signoz-signing-headers", []string{"host", "content-type"}, "Request headers included in the signature")
+	cmd.Flags().StringVar(&cmd.SignatureHeader, "signoz-signature-header", "X-Signature", "Header the request signature is sent in")
+	cmd.Flags().StringSliceVar(&cmd.EndpointAllowlist, "signoz-endpoint-allowlist", nil, "Hosts, *.domain wildcards or CIDRs the SigNoz endpoints must match; empty allows any host")
+	cmd.Flags().StringVar(&cmd.SignozEndpointIPs, "signoz-endpoint-ips", "", "Comma-separated IP addresses to pin the SigNoz host to, bypassing DNS")
+	cmd.Flags().StringSliceVar(&cmd.SignozDNSServers, "signoz-dns-servers", nil, "DNS servers (IP or IP:port) the SigNoz host is resolved at instead of the cluster DNS")
+	cmd.Flags().StringArrayVar(&cmd.SignozHostAliases, "signoz-host-alias", nil, "Static address for a host as 'host=IP', bypassing DNS, may be repeated")
+	cmd.Flags().StringVar(&cmd.PartialResponse, "partial-response", "deny", "What to do when some federated endpoints fail: allow (serve the remaining series) or deny (fail the query)")
+
+	cmd.Flags().StringSliceVar(&cmd.ExternalDenyNamespaces, "external-metrics-deny-namespaces", nil, "Namespaces, or glob patterns such as tenant-*, that may not read external metrics")
+	cmd.Flags().Float64Var(&cmd.RateLimitQPS, "rate-limit-qps", 0, "Metrics API requests per second allowed per namespace or user (0 disables rate limiting)")
+	cmd.Flags().IntVar(&cmd.RateLimitBurst, "rate-limit-burst", 20, "Metrics API requests allowed at once per namespace or user")
+	cmd.Flags().StringVar(&cmd.RateLimitBy, "rate-limit-by", "namespace", "What requests are rate limited by: namespace or user")
+	cmd.Flags().IntVar(&cmd.MaxInflight, "max-inflight-requests", 0, "Metrics API requests served at once, the rest is queued (0 disables the limit)")
+	cmd.Flags().IntVar(&cmd.MaxQueued, "max-queued-requests", 100, "Metrics API requests waiting for --max-inflight-requests per priority before requests are shed")
+	cmd.Flags().DurationVar(&cmd.QueueTimeout, "inflight-queue-timeout", 5*time.Second, "How long a queued metrics API request waits before it is shed")
+	cmd.Flags().StringSliceVar(&cmd.PriorityUsers, "inflight-priority-users", signozprov.DefaultPriorityUsers, "Users whose requests are admitted ahead of other queued requests")
+	cmd.Flags().Float64Var(&cmd.ShadowSampleRate, "shadow-sample-rate", 0, "Fraction of queries of metrics with a shadowQuery that are compared against it (0 disables shadow comparisons)")
+	cmd.Flags().Float64Var(&cmd.ShadowTolerance, "shadow-tolerance", 0.01, "Relative divergence up to which shadow query values match")
+	cmd.Flags().BoolVar(&cmd.RequireRunningPods, "require-running-pods", false, "Only serve metrics for pods in the Running phase")
+	cmd.Flags().BoolVar(&cmd.ExcludeUnreadyPods, "exclude-unready-pods", false, "Leave out pods that are terminating or not Ready")
+	cmd.Flags().StringVar(&cmd.NamespaceLabelKey, "namespace-label-key", "k8s.namespace.name", "Series attribute holding the namespace; custom metrics queries are restricted to the namespace of the request, empty matches objects by name only")
+	cmd.Flags().StringSliceVar(&cmd.PodLabelKeys, "pod-label-keys", []string{"k8s.pod.name"}, "Series attributes naming the pod in priority order, for metrics without objectLabel")
+	cmd.Flags().StringVar(&cmd.ExportConfigMap, "export-configmap", "", "ConfigMap (namespace/name) to write the effective metric queries to")
+
+	cmd.Flags().BoolVar(&cmd.PrometheusProxy, "enable-prometheus-proxy", false, "Serve a read-only Prometheus query API (/api/v1/query, /api/v1/query_range) backed by SigNoz")
+
+	cmd.Flags().BoolVar(&cmd.VPAFeed, "enable-vpa-feed", false, "Serve per-container usage for VPA custom recommenders at /vpa/v1/namespaces/<namespace>/pods")
+	cmd.Flags().StringVar(&cmd.VPACPUMetric, "vpa-cpu-metric", "container.cpu.usage", "SigNoz metric with container CPU usage in cores")
+	cmd.Flags().StringVar(&cmd.VPAMemoryMetric, "vpa-memory-metric", "container.memory.working_set", "SigNoz metric with container memory usage in bytes")
+
+	cmd.Flags().BoolVar(&cmd.ManageAPIServices, "manage-apiservices", false, "Register the custom and external metrics APIServices with the CA of a generated serving certificate")
+	cmd.Flags().StringVar(&cmd.APIServiceService, "apiservice-service", "", "Service (namespace/name) the managed APIServices point at")
+	cmd.Flags().StringVar(&cmd.APIServiceCertSecret, "apiservice-cert-secret", "", "Secret (namespace/name) the generated serving certificate is shared through")
+	cmd.Flags().StringVar(&cmd.APIServiceOwner, "apiservice-owner", "", "ClusterRole owning the managed APIServices, so they are garbage collected with it")
+
+	cmd.Flags().BoolVar(&cmd.MetricCRD, "enable-metric-crd", false, "Also serve the metrics declared by SignozMetric objects, reloaded as they change")
+
+	logs.AddFlags(cmd.Flags())
+	if err := cmd.Flags().Parse(args); err != nil {
+		klog.Fatalf("unable to parse flags: %v", err)
 	}
 
-	if os.Getenv("SIGNOZ_TIMERANGE_MINUTES") != "" {
-		val, err := strconv.ParseInt(os.Getenv("SIGNOZ_TIMERANGE_MINUTES"), 10, 64)
+	var errs []error
+	if cmd.Config != "" {
+		config, err := loadAdapterConfig(cmd.Config)
 		if err != nil {
-			klog.Fatal("invalid value for SIGNOZ_TIMERANGE_MINUTES")
+			errs = append(errs, fmt.Errorf("unable to load config: %w", err))
+		} else {
+			cmd.config = config
+			cmd.saveQueryFlags()
+			cmd.applyConfig(config)
 		}
-		cmd.SignozTimerangeMinutes = val
+	} else {
+		errs = cmd.applyEnv()
+		cmd.saveQueryFlags()
 	}
-
-	if cmd.SignozMetrics == "" {
-		cmd.SignozMetrics = os.Getenv("SIGNOZ_METRICS")
-		if cmd.SignozMetrics == "" {
-			klog.Fatal("--signoz-metrics or SIGNOZ_METRICS is required")
-		}
+	if err := cmd.complete(); err != nil {
+		errs = append(errs, err)
 	}
-
-	if cmd.SignozFilterExpression == "" {
-		cmd.SignozFilterExpression = os.Getenv("SIGNOZ_FILTER_EXPRESSION")
+	if doctor {
+		if !cmd.runDoctor(os.Stdout, errs) {
+			logs.FlushLogs()
+			os.Exit(1)
+		}
+		return
 	}
-
-	metricsSlice := strings.Split(cmd.SignozMetrics, ",")
-	for i := range metricsSlice {
-		metricsSlice[i] = strings.TrimSpace(metricsSlice[i])
+	if len(errs) > 0 {
+		klog.Fatalf("invalid configuration:\n%v", errors.Join(errs...))
 	}
 
 	dynClient, err := cmd.DynamicClient()
@@ -105,15 +774,91 @@ func main() {
 		klog.Fatalf("unable to construct REST mapper: %v", err)
 	}
 
-	provider := signozprov.NewSignozProvider(cmd.SignozEndpoint, cmd.SignozAPIKey, cmd.SignozTimerangeMinutes, metricsSlice, cmd.SignozFilterExpression, dynClient, mapper)
+	signoz, err := cmd.signozQuerier()
+	if err != nil {
+		klog.Fatalf("unable to construct SigNoz client: %v", err)
+	}
+	if cmd.QueryBatchWindow > 0 {
+		signoz = signozprov.NewBatchingQuerier(signoz, cmd.QueryBatchWindow)
+	}
+	opts := cmd.providerOptions()
+
+	if cmd.ExportConfigMap != "" {
+		exporter, err := cmd.mappingExporter()
+		if err != nil {
+			klog.Fatalf("unable to construct mapping exporter: %v", err)
+		}
+		opts.MappingExporter = exporter
+	}
+
+	provider := signozprov.NewSignozProvider(signoz, opts, dynClient, mapper)
 	cmd.WithCustomMetrics(provider)
 	cmd.WithExternalMetrics(provider)
 
 	if err := metrics.RegisterMetrics(legacyregistry.Register); err != nil {
 		klog.Fatalf("unable to register metrics: %v", err)
 	}
+	if err := signozprov.RegisterMetrics(legacyregistry.Register); err != nil {
+		klog.Fatalf("unable to register signoz metrics: %v", err)
+	}
+
+	var registrar *signozprov.APIServiceRegistrar
+	if cmd.ManageAPIServices {
+		registrar, err = cmd.apiServiceRegistrar()
+		if err != nil {
+			klog.Fatalf("unable to construct APIService registrar: %v", err)
+		}
+		cert := cmd.SecureServing.ServerCert
+		if err := registrar.EnsureServingCert(context.Background(), cert.CertDirectory, cert.PairName); err != nil {
+			klog.Fatalf("unable to set up serving certificate: %v", err)
+		}
+	}
+
+	metricNames := make([]string, len(cmd.metricConfigs))
+	for i, m := range cmd.metricConfigs {
+		metricNames[i] = m.Name
+	}
+	server, err := cmd.Server()
+	if err != nil {
+		klog.Fatalf("unable to construct server: %v", err)
+	}
+	if reporter, ok := provider.(signozprov.SyncReporter); ok {
+		check := healthz.NamedCheck("informer-sync", func(*http.Request) error { return reporter.InformersSynced() })
+		if err := server.GenericAPIServer.AddReadyzChecks(check); err != nil {
+			klog.Fatalf("unable to add readiness check: %v", err)
+		}
+	}
+	mux := server.GenericAPIServer.Handler.NonGoRestfulMux
+	if reporter, ok := provider.(signozprov.StatusReporter); ok {
+		signozprov.NewStatusHandler(reporter).Install(mux)
+	}
+	if cmd.PrometheusProxy {
+		signozprov.NewPrometheusProxy(signoz).Install(mux)
+	}
+	if cmd.VPAFeed {
+		signozprov.NewVPAFeed(signoz, cmd.VPACPUMetric, cmd.VPAMemoryMetric, cmd.window, cmd.PodLabelKeys).Install(mux)
+	}
+
+	if registrar != nil {
+		go registrar.Run(context.Background())
+	}
+	if cmd.MetricCRD || cmd.ConfigReloadInterval > 0 {
+		updater, ok := provider.(signozprov.MetricUpdater)
+		if !ok {
+			klog.Fatalf("provider does not support updating metrics")
+		}
+		setMetrics := updater.SetMetrics
+		if cmd.MetricCRD {
+			controller := signozprov.NewMetricController(dynClient, mapper, updater, opts.Metrics)
+			setMetrics = controller.SetStatic
+			go controller.Run(context.Background())
+		}
+		if cmd.ConfigReloadInterval > 0 {
+			go newConfigReloader(cmd, updater, setMetrics).Run(context.Background())
+		}
+	}
 
-	klog.Infof("starting signoz metrics adapter, endpoint=%s, metrics=%v", cmd.SignozEndpoint, metricsSlice)
+	klog.Infof("starting signoz metrics adapter, endpoints=%v, window=%s, metrics=%v", cmd.endpoints, cmd.window, metricNames)
 
 	if err := cmd.Run(context.Background()); err != nil {
 		klog.Fatalf("unable to run custom metrics adapter: %v", err)
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestApplyEnvFillsUnsetFlags(t *testing.T) {
+	t.Setenv("SIGNOZ_AUTH_MODE", "oauth2")
+	t.Setenv("SIGNOZ_NAMESPACE_LABEL_KEY", "namespace")
+
+	a := &SignozAdapter{}
+	a.Flags().StringVar(&a.AuthMode, "signoz-auth-mode", "api-key", "")
+	a.Flags().StringVar(&a.NamespaceLabelKey, "namespace-label-key", "k8s.namespace.name", "")
+	if err := a.Flags().Parse([]string{"--signoz-auth-mode=api-key"}); err != nil {
+		t.Fatal(err)
+	}
+	if errs := a.applyEnv(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if a.AuthMode != "api-key" {
+		t.Errorf("auth mode = %q, want the flag to win over SIGNOZ_AUTH_MODE", a.AuthMode)
+	}
+	if a.NamespaceLabelKey != "namespace" {
+		t.Errorf("namespace label key = %q, want SIGNOZ_NAMESPACE_LABEL_KEY to replace the default", a.NamespaceLabelKey)
+	}
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// EndpointAllowlist restricts the hosts the SigNoz client may connect to, so
+// a tampered configuration cannot point the adapter, with its credentials,
+// at arbitrary in-cluster services. Entries are hostnames, wildcard domains
+// such as *.signoz.cloud, or CIDRs.
+type EndpointAllowlist struct {
+	hosts   []string
+	domains []string
+	nets    []*net.IPNet
+}
+
+// ParseEndpointAllowlist parses the allowlist entries.
+func ParseEndpointAllowlist(entries []string) (*EndpointAllowlist, error) {
+	l := &EndpointAllowlist{}
+	var errs []error
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		switch {
+		case e == "":
+		case strings.Contains(e, "/"):
+			_, ipNet, err := net.ParseCIDR(e)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid CIDR %q", e))
+				continue
+			}
+			l.nets = append(l.nets, ipNet)
+		case strings.HasPrefix(e, "*."):
+			l.domains = append(l.domains, e[1:])
+		case strings.Contains(e, "*"):
+			errs = append(errs, fmt.Errorf("invalid entry %q, wildcards are only allowed as *.domain", e))
+		default:
+			l.hosts = append(l.hosts, e)
+		}
+	}
+	return l, errors.Join(errs...)
+}
+
+// allowsName reports whether host is allowed by a hostname or domain entry.
+func (l *EndpointAllowlist) allowsName(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range l.hosts {
+		if host == h {
+			return true
+		}
+	}
+	for _, d := range l.domains {
+		if strings.HasSuffix(host, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsIP reports whether ip is in one of the CIDRs.
+func (l *EndpointAllowlist) allowsIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	parsed := net.IP(addr.WithZone("").AsSlice())
+	for _, n := range l.nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHost reports whether an endpoint with the given host is allowed: by
+// name, or for IP addresses by CIDR. Hosts only covered by CIDRs are checked
+// again when connecting, see allowsAddress.
+func (l *EndpointAllowlist) AllowsHost(host string) bool {
+	return l.allowsName(host) || l.allowsIP(host) || (len(l.nets) > 0 && net.ParseIP(host) == nil)
+}
+
+// allowsAddress reports whether the client may connect to addr, one of the
+// resolved addresses of host. Hosts allowed by name may resolve to any
+// address, all others must resolve into an allowed CIDR.
+func (l *EndpointAllowlist) allowsAddress(host, addr string) bool {
+	return l.allowsName(host) || l.allowsIP(addr)
+}
+
+// errRedirectHost is returned for redirects to a host other than the one of
+// the original request.
+var errRedirectHost = errors.New("refusing redirect to another host")
+
+// sameHostRedirect is an http.Client CheckRedirect function that only follows
+// redirects within the host of the original request, so credentials are never
+// sent to a host that was not configured.
+func sameHostRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%w: %s", errRedirectHost, req.URL.Host)
+	}
+	return nil
+}
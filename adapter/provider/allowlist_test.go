@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestEndpointAllowlistAllowsHost(t *testing.T) {
+	tests := []struct {
+		entries []string
+		host    string
+		want    bool
+	}{
+		{entries: []string{"signoz.internal"}, host: "signoz.internal", want: true},
+		{entries: []string{"signoz.internal"}, host: "SIGNOZ.internal", want: true},
+		{entries: []string{"signoz.internal"}, host: "other.internal"},
+		{entries: []string{" *.Signoz.Cloud ", ""}, host: "eu.signoz.cloud", want: true},
+		{entries: []string{"*.signoz.cloud"}, host: "signoz.cloud"},
+		{entries: []string{"*.signoz.cloud"}, host: "evilsignoz.cloud"},
+		{entries: []string{"10.0.0.0/8"}, host: "10.1.2.3", want: true},
+		{entries: []string{"10.0.0.0/8"}, host: "192.168.0.1"},
+		{entries: []string{"fd00::/8"}, host: "fd00::1", want: true},
+		{entries: []string{"fd00::/8"}, host: "fe80::1"},
+		// Names may still resolve into a CIDR, which is checked when
+		// connecting.
+		{entries: []string{"10.0.0.0/8"}, host: "other.internal", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			allowlist, err := ParseEndpointAllowlist(tt.entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := allowlist.AllowsHost(tt.host); got != tt.want {
+				t.Fatalf("%q: got %v, want %v", tt.entries, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointAllowlistAllowsAddress(t *testing.T) {
+	allowlist, err := ParseEndpointAllowlist([]string{"signoz.internal", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host, addr string
+		want       bool
+	}{
+		{host: "signoz.internal", addr: "192.168.0.1", want: true},
+		{host: "other.internal", addr: "10.1.2.3", want: true},
+		{host: "other.internal", addr: "192.168.0.1"},
+		{host: "other.internal", addr: "fe80::1%eth0"},
+	}
+	for _, tt := range tests {
+		if got := allowlist.allowsAddress(tt.host, tt.addr); got != tt.want {
+			t.Errorf("allowsAddress(%s, %s) = %v, want %v", tt.host, tt.addr, got, tt.want)
+		}
+	}
+
+	// Zones of link-local addresses are ignored when matching CIDRs.
+	linkLocal, err := ParseEndpointAllowlist([]string{"fe80::/10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = []struct {
+		host, addr string
+		want       bool
+	}{
+		{host: "signoz.internal", addr: "fe80::1%eth0", want: true},
+		{host: "signoz.internal", addr: "fd00::1"},
+	}
+	for _, tt := range tests {
+		if got := linkLocal.allowsAddress(tt.host, tt.addr); got != tt.want {
+			t.Errorf("allowsAddress(%s, %s) = %v, want %v", tt.host, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestParseEndpointAllowlistInvalid(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "signoz.*.cloud", "*signoz.cloud"} {
+		if _, err := ParseEndpointAllowlist([]string{entry}); err == nil {
+			t.Errorf("%q: got no error", entry)
+		}
+	}
+}
+
+func TestCachingResolverRestrict(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	tests := []struct {
+		entry string
+		want  bool
+	}{
+		{entry: "127.0.0.0/8", want: true},
+		{entry: "signoz.test", want: true},
+		{entry: "10.0.0.0/8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			allowlist, err := ParseEndpointAllowlist([]string{tt.entry})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := NewCachingResolver(0, 0, map[string][]string{"signoz.test": {"127.0.0.1"}})
+			r.Restrict(allowlist)
+			conn, err := r.DialContext(&net.Dialer{})(context.Background(), "tcp", net.JoinHostPort("signoz.test", port))
+			if err == nil {
+				conn.Close()
+			}
+			if got := err == nil; got != tt.want {
+				t.Fatalf("connected = %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameHostRedirect(t *testing.T) {
+	request := func(rawURL string) *http.Request {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Request{URL: u}
+	}
+	via := []*http.Request{request("https://signoz.internal/api/v5/query_range")}
+	if err := sameHostRedirect(request("https://signoz.internal/other"), via); err != nil {
+		t.Fatalf("same host redirect refused: %v", err)
+	}
+	if err := sameHostRedirect(request("https://attacker.example/"), via); !errors.Is(err, errRedirectHost) {
+		t.Fatalf("got %v, want the redirect refused", err)
+	}
+}
@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// defaultBucketLabel is the attribute holding the upper bound of histogram
+// buckets.
+const defaultBucketLabel = "le"
+
+// ApdexConfig computes the Apdex score of a latency histogram instead of
+// querying the metric of the same name: the requests within Satisfied count
+// fully, those within Tolerating count half, relative to all requests in the
+// window. Scores range from 0 to 1 and are computed per label set, e.g. per
+// service with groupBy: [service.name].
+type ApdexConfig struct {
+	// Histogram is the SigNoz metric holding the cumulative bucket counts,
+	// e.g. signoz_latency.bucket.
+	Histogram string `json:"histogram"`
+	// Satisfied is the latency threshold of satisfied requests, in the unit
+	// of the histogram. It should be a bucket boundary; otherwise the
+	// largest boundary below it is used.
+	Satisfied float64 `json:"satisfied"`
+	// Tolerating is the latency threshold of tolerated requests. Defaults
+	// to four times Satisfied.
+	Tolerating float64 `json:"tolerating,omitempty"`
+	// BucketLabel is the attribute holding the upper bound of a bucket.
+	// Defaults to le.
+	BucketLabel string `json:"bucketLabel,omitempty"`
+}
+
+func (a *ApdexConfig) validate() error {
+	if a.Histogram == "" {
+		return fmt.Errorf("histogram is required")
+	}
+	if a.Satisfied <= 0 {
+		return fmt.Errorf("satisfied must be positive")
+	}
+	if a.Tolerating != 0 && a.Tolerating < a.Satisfied {
+		return fmt.Errorf("tolerating must not be less than satisfied")
+	}
+	return nil
+}
+
+func (a *ApdexConfig) tolerating() float64 {
+	if a.Tolerating == 0 {
+		return 4 * a.Satisfied
+	}
+	return a.Tolerating
+}
+
+func (a *ApdexConfig) bucketLabel() string {
+	if a.BucketLabel == "" {
+		return defaultBucketLabel
+	}
+	return a.BucketLabel
+}
+
+// apdexQuery turns base, the builder query of the metric, into a query of
+// the increase of every bucket, which is summed over the window.
+func (a *ApdexConfig) apdexQuery(base SignozQuery) SignozQuery {
+	query := base
+	query.Spec.Aggregations = []SignozMetricAggregation{{
+		MetricName:       a.Histogram,
+		TimeAggregation:  "increase",
+		SpaceAggregation: "sum",
+	}}
+	query.Spec.GroupBy = append(query.Spec.GroupBy, SignozQueryGroupBy{
+		Name:          a.bucketLabel(),
+		FieldDataType: "string",
+	})
+	return query
+}
+
+// apdexSeries computes the score per label set from the bucket series.
+// Label sets without requests in the window are left out.
+func (a *ApdexConfig) apdexSeries(series []seriesValue) []seriesValue {
+	type counts struct {
+		labels                    map[string]string
+		satisfied, tolerating     float64
+		satisfiedLe, toleratingLe float64
+		total                     float64
+	}
+	var keys []string
+	byKey := map[string]*counts{}
+	for _, s := range series {
+		le, err := strconv.ParseFloat(s.Labels[a.bucketLabel()], 64)
+		if err != nil {
+			continue
+		}
+		l := maps.Clone(s.Labels)
+		delete(l, a.bucketLabel())
+		key := labels.Set(l).String()
+		c, ok := byKey[key]
+		if !ok {
+			c = &counts{labels: l, satisfiedLe: math.Inf(-1), toleratingLe: math.Inf(-1)}
+			byKey[key] = c
+			keys = append(keys, key)
+		}
+
+		// Buckets are cumulative, so the count of the largest bound within
+		// a threshold is the number of requests within it.
+		if le <= a.Satisfied && le > c.satisfiedLe {
+			c.satisfied, c.satisfiedLe = s.Value, le
+		}
+		if le <= a.tolerating() && le > c.toleratingLe {
+			c.tolerating, c.toleratingLe = s.Value, le
+		}
+		if math.IsInf(le, 1) {
+			c.total = s.Value
+		}
+	}
+
+	var result []seriesValue
+	for _, key := range keys {
+		c := byKey[key]
+		if c.total <= 0 {
+			continue
+		}
+		score := (c.satisfied + (c.tolerating-c.satisfied)/2) / c.total
+		result = append(result, seriesValue{Labels: c.labels, Value: min(max(score, 0), 1)})
+	}
+	return result
+}
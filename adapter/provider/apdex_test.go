@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"testing"
+)
+
+func bucket(service, le string, value float64) seriesValue {
+	return seriesValue{Labels: map[string]string{"service.name": service, "le": le}, Value: value}
+}
+
+func TestApdexSeries(t *testing.T) {
+	tests := []struct {
+		name   string
+		apdex  ApdexConfig
+		series []seriesValue
+		want   map[string]float64
+	}{
+		{
+			name:  "thresholds on bucket boundaries",
+			apdex: ApdexConfig{Satisfied: 100, Tolerating: 400},
+			series: []seriesValue{
+				bucket("api", "50", 40),
+				bucket("api", "100", 60),
+				bucket("api", "400", 80),
+				bucket("api", "1000", 95),
+				bucket("api", "+Inf", 100),
+			},
+			// (60 + (80-60)/2) / 100
+			want: map[string]float64{"api": 0.7},
+		},
+		{
+			name:  "thresholds between boundaries use the largest bound below",
+			apdex: ApdexConfig{Satisfied: 150},
+			series: []seriesValue{
+				bucket("api", "100", 50),
+				bucket("api", "250", 70),
+				bucket("api", "500", 90),
+				bucket("api", "+Inf", 100),
+			},
+			// Satisfied within 100, tolerating (600) within 500.
+			want: map[string]float64{"api": 0.7},
+		},
+		{
+			name:  "label sets are scored separately",
+			apdex: ApdexConfig{Satisfied: 100},
+			series: []seriesValue{
+				bucket("api", "100", 10),
+				bucket("api", "+Inf", 10),
+				bucket("web", "100", 0),
+				bucket("web", "400", 0),
+				bucket("web", "+Inf", 10),
+			},
+			want: map[string]float64{"api": 1, "web": 0},
+		},
+		{
+			name:  "label sets without requests are left out",
+			apdex: ApdexConfig{Satisfied: 100},
+			series: []seriesValue{
+				bucket("api", "100", 0),
+				bucket("api", "+Inf", 0),
+				bucket("web", "100", 5),
+			},
+			want: map[string]float64{},
+		},
+		{
+			name:  "series without a numeric bound are skipped",
+			apdex: ApdexConfig{Satisfied: 1, BucketLabel: "bound"},
+			series: []seriesValue{
+				{Labels: map[string]string{"service.name": "api", "bound": "1"}, Value: 5},
+				{Labels: map[string]string{"service.name": "api", "bound": "+Inf"}, Value: 10},
+				{Labels: map[string]string{"service.name": "api", "bound": "x"}, Value: 100},
+			},
+			want: map[string]float64{"api": 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.apdex.apdexSeries(tt.series)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, s := range got {
+				want, ok := tt.want[s.Labels["service.name"]]
+				if !ok {
+					t.Fatalf("unexpected series %v", s.Labels)
+				}
+				if _, ok := s.Labels[tt.apdex.bucketLabel()]; ok {
+					t.Errorf("series %v keeps the bucket label", s.Labels)
+				}
+				if diff := s.Value - want; diff > 1e-9 || diff < -1e-9 {
+					t.Errorf("%v: got %v, want %v", s.Labels, s.Value, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+)
+
+// apiServiceResyncInterval is how often the APIServices are re-applied, which
+// undoes manual edits and restores deleted registrations.
+const apiServiceResyncInterval = time.Minute
+
+// servingCertRenewBefore is how long before expiry the serving certificate is
+// replaced on startup.
+const servingCertRenewBefore = 30 * 24 * time.Hour
+
+var apiServiceResource = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+
+// managedAPIServices are the APIServices registered by the adapter.
+var managedAPIServices = []struct {
+	group, version                        string
+	groupPriorityMinimum, versionPriority int64
+}{
+	{"custom.metrics.k8s.io", "v1beta1", 100, 100},
+	{"custom.metrics.k8s.io", "v1beta2", 100, 200},
+	{"external.metrics.k8s.io", "v1beta1", 100, 100},
+}
+
+// APIServiceRegistrar registers the custom and external metrics APIServices
+// pointing at the adapter's Service, with the CA of its serving certificate
+// as caBundle instead of insecureSkipTLSVerify.
+//
+// The serving certificate is kept in a Secret, so all replicas serve the same
+// certificate and agree on the CA. If an owner ClusterRole is set, the
+// APIServices are owned by it, so the garbage collector removes them when the
+// chart is uninstalled.
+type APIServiceRegistrar struct {
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+	service types.NamespacedName
+	secret  types.NamespacedName
+	owner   string
+
+	caBundle []byte
+}
+
+func NewAPIServiceRegistrar(client kubernetes.Interface, dyn dynamic.Interface, service, secret types.NamespacedName, owner string) *APIServiceRegistrar {
+	return &APIServiceRegistrar{client: client, dynamic: dyn, service: service, secret: secret, owner: owner}
+}
+
+// EnsureServingCert loads the serving certificate from the Secret, generating
+// it when the Secret does not exist or the certificate expires soon, and
+// writes it to <certDir>/<pairName>.crt and .key where the server picks it
+// up.
+func (r *APIServiceRegistrar) EnsureServingCert(ctx context.Context, certDir, pairName string) error {
+	certPEM, keyPEM, err := r.servingCert(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The generated certificate is followed by the CA that signed it.
+	var ca []byte
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		ca = pem.EncodeToMemory(block)
+	}
+	r.caBundle = ca
+
+	if err := os.MkdirAll(certDir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(certDir, pairName+".crt"), certPEM, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(certDir, pairName+".key"), keyPEM, 0o600)
+}
+
+func (r *APIServiceRegistrar) servingCert(ctx context.Context) ([]byte, []byte, error) {
+	secrets := r.client.CoreV1().Secrets(r.secret.Namespace)
+	existing, err := secrets.Get(ctx, r.secret.Name, metav1.GetOptions{})
+	found := err == nil
+	if err != nil && !apierr.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("failed to get serving certificate secret %s: %w", r.secret, err)
+	}
+	if found && certValid(existing.Data[corev1.TLSCertKey], existing.Data[corev1.TLSPrivateKeyKey]) {
+		return existing.Data[corev1.TLSCertKey], existing.Data[corev1.TLSPrivateKeyKey], nil
+	}
+
+	host := fmt.Sprintf("%s.%s.svc", r.service.Name, r.service.Namespace)
+	certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey(host, nil, []string{
+		r.service.Name,
+		r.service.Name + "." + r.service.Namespace,
+		host + ".cluster.local",
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serving certificate: %w", err)
+	}
+	data := map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}
+
+	if !found {
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: r.secret.Name, Namespace: r.secret.Namespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}, metav1.CreateOptions{})
+	} else {
+		existing.Data = data
+		_, err = secrets.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if apierr.IsAlreadyExists(err) || apierr.IsConflict(err) {
+		// Another replica got there first, serve its certificate.
+		klog.V(2).Infof("serving certificate secret %s was written concurrently, reloading", r.secret)
+		return r.servingCert(ctx)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to store serving certificate in secret %s: %w", r.secret, err)
+	}
+	klog.Infof("generated serving certificate for %s in secret %s", host, r.secret)
+	return certPEM, keyPEM, nil
+}
+
+// certValid reports whether the key pair parses and the certificate does not
+// expire within servingCertRenewBefore.
+func certValid(certPEM, keyPEM []byte) bool {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+	return time.Until(cert.NotAfter) > servingCertRenewBefore
+}
+
+// Run registers the APIServices and re-applies them every
+// apiServiceResyncInterval until ctx is done.
+func (r *APIServiceRegistrar) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.register(ctx); err != nil {
+			klog.Errorf("failed to register APIServices: %v", err)
+		}
+	}, apiServiceResyncInterval)
+}
+
+func (r *APIServiceRegistrar) register(ctx context.Context) error {
+	var owners []any
+	if r.owner != "" {
+		role, err := r.client.RbacV1().ClusterRoles().Get(ctx, r.owner, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get owner ClusterRole %s: %w", r.owner, err)
+		}
+		owners = []any{map[string]any{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"name":       role.Name,
+			"uid":        string(role.UID),
+		}}
+	}
+
+	apiServices := r.dynamic.Resource(apiServiceResource)
+	for _, s := range managedAPIServices {
+		name := s.version + "." + s.group
+		spec := map[string]any{
+			"service": map[string]any{
+				"name":      r.service.Name,
+				"namespace": r.service.Namespace,
+			},
+			"group":                 s.group,
+			"version":               s.version,
+			"caBundle":              base64.StdEncoding.EncodeToString(r.caBundle),
+			"insecureSkipTLSVerify": false,
+			"groupPriorityMinimum":  s.groupPriorityMinimum,
+			"versionPriority":       s.versionPriority,
+		}
+
+		existing, err := apiServices.Get(ctx, name, metav1.GetOptions{})
+		if apierr.IsNotFound(err) {
+			obj := &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "apiregistration.k8s.io/v1",
+				"kind":       "APIService",
+				"metadata":   map[string]any{"name": name},
+				"spec":       spec,
+			}}
+			if owners != nil {
+				_ = unstructured.SetNestedSlice(obj.Object, owners, "metadata", "ownerReferences")
+			}
+			if _, err := apiServices.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("failed to create APIService %s: %w", name, err)
+			}
+			klog.Infof("registered APIService %s", name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get APIService %s: %w", name, err)
+		}
+
+		current, _, _ := unstructured.NestedMap(existing.Object, "spec")
+		if specEqual(current, spec) && (owners == nil || len(existing.GetOwnerReferences()) > 0) {
+			continue
+		}
+		existing.Object["spec"] = spec
+		if owners != nil {
+			_ = unstructured.SetNestedSlice(existing.Object, owners, "metadata", "ownerReferences")
+		}
+		if _, err := apiServices.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update APIService %s: %w", name, err)
+		}
+		klog.Infof("updated APIService %s", name)
+	}
+	return nil
+}
+
+// specEqual reports whether the APIService spec read from the cluster matches
+// the desired one.
+func specEqual(current, desired map[string]any) bool {
+	for key, want := range desired {
+		got := current[key]
+		switch want := want.(type) {
+		case map[string]any:
+			m, _ := got.(map[string]any)
+			if !specEqual(m, want) {
+				return false
+			}
+		case bool:
+			// false is omitted from the stored spec.
+			b, _ := got.(bool)
+			if b != want {
+				return false
+			}
+		default:
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				return false
+			}
+		}
+	}
+	return true
+}
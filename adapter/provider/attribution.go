@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"context"
+
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/klog/v2"
+)
+
+// unknownUser labels requests without an authenticated user, e.g. from
+// callers that bypass the apiserver handler chain.
+const unknownUser = "unknown"
+
+// requester returns the name of the authenticated user or ServiceAccount of
+// the request in ctx.
+func requester(ctx context.Context) string {
+	if user, ok := request.UserFrom(ctx); ok && user.GetName() != "" {
+		return user.GetName()
+	}
+	return unknownUser
+}
+
+// attribute counts a metrics API request against the user making it and logs
+// it, so query load can be traced back to the HPA controller, operator or
+// human behind it.
+func attribute(ctx context.Context, api, metric, namespace string) {
+	user := requester(ctx)
+	apiRequests.WithLabelValues(api, user).Inc()
+	klog.V(2).Infof("%s metrics request for %s in namespace %q by %s", api, metric, namespace, user)
+}
@@ -0,0 +1,206 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBatchQueries is the number of queries after which a batch is sent
+// without waiting for the rest of the batch window.
+const maxBatchQueries = 20
+
+var _ Querier = &BatchingQuerier{}
+
+// BatchingQuerier collects the queries arriving within a short window and
+// sends them to SigNoz as one composite query, so refreshing many metrics
+// takes one round-trip instead of one per metric. The queries of each caller
+// are renamed with a prefix in the combined query and the results are handed
+// back by query name with the prefix removed.
+//
+// Queries are only batched with queries of the same request type and window
+// length. Queries with formulas, whose expressions refer to query names, are
+// sent on their own. A batch SigNoz rejects as invalid is sent again one
+// caller at a time, so the rejection only fails the queries that caused it;
+// other failures fail all queries in the batch.
+type BatchingQuerier struct {
+	querier Querier
+	window  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*queryBatch
+}
+
+type queryBatch struct {
+	key     string
+	calls   []*batchCall
+	queries int
+	sent    bool
+}
+
+type batchCall struct {
+	ctx      context.Context
+	query    SignozQueryRangeOptions
+	done     chan struct{}
+	response *SignozQueryRangeResponse
+	err      error
+}
+
+// NewBatchingQuerier returns a querier batching the queries sent to querier
+// within window.
+func NewBatchingQuerier(querier Querier, window time.Duration) *BatchingQuerier {
+	return &BatchingQuerier{querier: querier, window: window, pending: map[string]*queryBatch{}}
+}
+
+func (b *BatchingQuerier) Query(ctx context.Context, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error) {
+	if !batchable(query) {
+		return b.querier.Query(ctx, query)
+	}
+
+	call := &batchCall{ctx: ctx, query: query, done: make(chan struct{})}
+	key := query.RequestType + "/" + strconv.FormatInt(query.End-query.Start, 10)
+
+	b.mu.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &queryBatch{key: key}
+		b.pending[key] = batch
+		time.AfterFunc(b.window, func() { b.send(batch) })
+	}
+	batch.calls = append(batch.calls, call)
+	batch.queries += len(query.CompositeQuery.Queries)
+	full := batch.queries >= maxBatchQueries
+	b.mu.Unlock()
+	if full {
+		go b.send(batch)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.response, call.err
+	}
+}
+
+// batchable reports whether the query can be combined with others.
+func batchable(query SignozQueryRangeOptions) bool {
+	for _, q := range query.CompositeQuery.Queries {
+		if q.Type == "builder_formula" {
+			return false
+		}
+	}
+	return len(query.CompositeQuery.Queries) > 0
+}
+
+// batchPrefix is the prefix of the query names of the i-th call of a batch.
+func batchPrefix(i int) string {
+	return fmt.Sprintf("b%d_", i)
+}
+
+// send sends the batch once, either when its window ends or when it is full.
+func (b *BatchingQuerier) send(batch *queryBatch) {
+	b.mu.Lock()
+	if batch.sent {
+		b.mu.Unlock()
+		return
+	}
+	batch.sent = true
+	if b.pending[batch.key] == batch {
+		delete(b.pending, batch.key)
+	}
+	calls := batch.calls
+	b.mu.Unlock()
+
+	// The batch outlives the callers that gave up waiting, as the others
+	// still wait for it, but is bounded by the latest of their deadlines.
+	ctx := context.WithoutCancel(calls[0].ctx)
+	if deadline, ok := batchDeadline(calls); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	if len(calls) == 1 {
+		call := calls[0]
+		call.response, call.err = b.querier.Query(ctx, call.query)
+		close(call.done)
+		return
+	}
+
+	last := calls[len(calls)-1].query
+	combined := SignozQueryRangeOptions{
+		Start:       last.Start,
+		End:         last.End,
+		RequestType: last.RequestType,
+	}
+	for i, call := range calls {
+		for _, q := range call.query.CompositeQuery.Queries {
+			q.Spec.Name = batchPrefix(i) + q.Spec.Name
+			combined.CompositeQuery.Queries = append(combined.CompositeQuery.Queries, q)
+		}
+	}
+
+	response, err := b.querier.Query(ctx, combined)
+	var invalid *QueryInvalidError
+	if errors.As(err, &invalid) {
+		b.sendEach(calls)
+		return
+	}
+	for i, call := range calls {
+		if err != nil {
+			call.err = err
+		} else {
+			call.response = demultiplex(response, batchPrefix(i))
+		}
+		close(call.done)
+	}
+}
+
+// sendEach sends the queries of each call on their own and concurrently,
+// bounded by the context of the call.
+func (b *BatchingQuerier) sendEach(calls []*batchCall) {
+	var wg sync.WaitGroup
+	for _, call := range calls {
+		wg.Go(func() {
+			call.response, call.err = b.querier.Query(call.ctx, call.query)
+			close(call.done)
+		})
+	}
+	wg.Wait()
+}
+
+// batchDeadline returns the latest deadline of the calls, false if one of
+// them has none.
+func batchDeadline(calls []*batchCall) (time.Time, bool) {
+	var latest time.Time
+	for _, call := range calls {
+		deadline, ok := call.ctx.Deadline()
+		if !ok {
+			return time.Time{}, false
+		}
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	return latest, true
+}
+
+// demultiplex returns the part of a batch response belonging to the queries
+// named with prefix, under their original names.
+func demultiplex(response *SignozQueryRangeResponse, prefix string) *SignozQueryRangeResponse {
+	part := *response
+	part.Data.Data.Results = nil
+	for _, result := range response.Data.Data.Results {
+		name, ok := strings.CutPrefix(result.QueryName, prefix)
+		if !ok {
+			continue
+		}
+		result.QueryName = name
+		part.Data.Data.Results = append(part.Data.Data.Results, result)
+	}
+	return &part
+}
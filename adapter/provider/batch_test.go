@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeQuerier answers each query with one result per query name and
+// rejects queries with a filter containing "invalid".
+type fakeQuerier struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeQuerier) Query(ctx context.Context, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+
+	var response SignozQueryRangeResponse
+	for _, q := range query.CompositeQuery.Queries {
+		if q.Spec.Filter != nil && strings.Contains(q.Spec.Filter.Expression, "invalid") {
+			return nil, &QueryInvalidError{StatusCode: http.StatusBadRequest, Body: "invalid filter"}
+		}
+		response.Data.Data.Results = append(response.Data.Data.Results, SignozQueryResult{QueryName: q.Spec.Name})
+	}
+	return &response, nil
+}
+
+func batchQuery(filter string) SignozQueryRangeOptions {
+	return SignozQueryRangeOptions{
+		End:         60_000,
+		RequestType: "time_series",
+		CompositeQuery: SignozCompositeQuery{Queries: []SignozQuery{{
+			Type: "builder_query",
+			Spec: SignozQuerySpec{Name: "A", Filter: &SignozQueryFilter{Expression: filter}},
+		}}},
+	}
+}
+
+// queryAll sends the queries concurrently through one batch.
+func queryAll(b *BatchingQuerier, queries []SignozQueryRangeOptions) ([]*SignozQueryRangeResponse, []error) {
+	responses := make([]*SignozQueryRangeResponse, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Go(func() {
+			responses[i], errs[i] = b.Query(context.Background(), query)
+		})
+	}
+	wg.Wait()
+	return responses, errs
+}
+
+func TestBatchingQuerierDemultiplexes(t *testing.T) {
+	querier := &fakeQuerier{}
+	b := NewBatchingQuerier(querier, 50*time.Millisecond)
+	responses, errs := queryAll(b, []SignozQueryRangeOptions{batchQuery("a"), batchQuery("b"), batchQuery("c")})
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		results := responses[i].Data.Data.Results
+		if len(results) != 1 || results[0].QueryName != "A" {
+			t.Fatalf("query %d: got results %+v, want one named A", i, results)
+		}
+	}
+	if querier.calls != 1 {
+		t.Fatalf("sent %d queries, want 1", querier.calls)
+	}
+}
+
+func TestBatchingQuerierIsolatesInvalidQueries(t *testing.T) {
+	querier := &fakeQuerier{}
+	b := NewBatchingQuerier(querier, 50*time.Millisecond)
+	responses, errs := queryAll(b, []SignozQueryRangeOptions{batchQuery("a"), batchQuery("invalid"), batchQuery("c")})
+
+	var invalid *QueryInvalidError
+	if !errors.As(errs[1], &invalid) {
+		t.Fatalf("invalid query: got error %v, want QueryInvalidError", errs[1])
+	}
+	for _, i := range []int{0, 2} {
+		if errs[i] != nil {
+			t.Fatalf("query %d failed with the invalid query: %v", i, errs[i])
+		}
+		if len(responses[i].Data.Data.Results) != 1 {
+			t.Fatalf("query %d: got %d results, want 1", i, len(responses[i].Data.Data.Results))
+		}
+	}
+	if querier.calls != 4 {
+		t.Fatalf("sent %d queries, want the batch and one per caller", querier.calls)
+	}
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// ErrCircuitOpen is wrapped by the errors of requests failed fast by an open
+// circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+// States of a circuit breaker, as exposed by the state gauge.
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker fails requests to a SigNoz endpoint fast after it failed a
+// number of times in a row, so HPA syncs do not each wait for the timeout
+// while SigNoz is down. After the open duration one request is let through
+// to probe the endpoint; its success closes the breaker again, its failure
+// keeps it open for another open duration. Only failures to reach SigNoz and
+// server errors count, not rejected queries. Requests cancelled or timed out
+// by their caller, e.g. by the timeout of a slow metric, count neither way; a
+// probe ending like that leaves the breaker half-open for the next request
+// to probe. While the breaker is not closed only the probe changes its state.
+type CircuitBreaker struct {
+	endpoint string
+	failures int
+	openFor  time.Duration
+
+	mu          sync.Mutex
+	state       breakerState
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+}
+
+// NewCircuitBreaker returns a breaker for endpoint opening after failures
+// consecutive failures for openFor.
+func NewCircuitBreaker(endpoint string, failures int, openFor time.Duration) *CircuitBreaker {
+	b := &CircuitBreaker{endpoint: endpoint, failures: failures, openFor: openFor}
+	circuitBreakerState.WithLabelValues(endpoint).Set(float64(breakerClosed))
+	return b
+}
+
+// allow returns an error if the request must fail fast, and whether the
+// allowed request is the probe of a half-open breaker. A nil breaker allows
+// every request.
+func (b *CircuitBreaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if remaining := b.openFor - time.Since(b.openedAt); remaining > 0 {
+			return false, &UnavailableError{Err: fmt.Errorf("%w for %s, retrying in %s", ErrCircuitOpen, b.endpoint, remaining.Round(time.Second))}
+		}
+		b.setState(breakerHalfOpen)
+	case breakerHalfOpen:
+		if b.probing {
+			return false, &UnavailableError{Err: fmt.Errorf("%w for %s, probing the endpoint", ErrCircuitOpen, b.endpoint)}
+		}
+	default:
+		return false, nil
+	}
+	b.probing = true
+	return true, nil
+}
+
+// record updates the breaker with the outcome of an allowed request, probe
+// as returned by allow. ctx is the context of the request.
+func (b *CircuitBreaker) record(ctx context.Context, probe bool, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	} else if b.state != breakerClosed {
+		// Requests allowed before the breaker opened do not decide it.
+		return
+	}
+	// Requests ended by their caller say nothing about the endpoint.
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	if !breakerFailure(err) {
+		b.consecutive = 0
+		if b.state != breakerClosed {
+			klog.Infof("circuit breaker for %s closed", b.endpoint)
+			b.setState(breakerClosed)
+		}
+		return
+	}
+
+	b.consecutive++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.consecutive >= b.failures) {
+		klog.Warningf("circuit breaker for %s opened for %s after %d consecutive failures: %v", b.endpoint, b.openFor, b.consecutive, err)
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// setState must be called with mu held.
+func (b *CircuitBreaker) setState(state breakerState) {
+	b.state = state
+	circuitBreakerState.WithLabelValues(b.endpoint).Set(float64(state))
+}
+
+// breakerFailure reports whether err counts towards opening the breaker:
+// transport errors and server errors.
+func breakerFailure(err error) bool {
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		return false
+	}
+	return unavailable.StatusCode == 0 || unavailable.StatusCode >= 500
+}
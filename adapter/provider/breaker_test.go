@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerFailures(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		open bool
+	}{
+		{name: "transport error", ctx: context.Background(), err: &UnavailableError{Err: errors.New("connection refused")}, open: true},
+		{name: "server error", ctx: context.Background(), err: &UnavailableError{StatusCode: http.StatusBadGateway}, open: true},
+		{name: "client timeout", ctx: context.Background(), err: &UnavailableError{Err: context.DeadlineExceeded}, open: true},
+		{name: "request timeout status", ctx: context.Background(), err: &UnavailableError{StatusCode: http.StatusRequestTimeout}},
+		{name: "rejected query", ctx: context.Background(), err: &QueryInvalidError{StatusCode: http.StatusBadRequest}},
+		{name: "caller deadline", ctx: expired, err: &UnavailableError{Err: context.DeadlineExceeded}},
+		{name: "caller cancelled", ctx: cancelled, err: &UnavailableError{Err: context.Canceled}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test", 2, time.Minute)
+			for range 2 {
+				probe, err := b.allow()
+				if err != nil {
+					t.Fatal(err)
+				}
+				b.record(tt.ctx, probe, tt.err)
+			}
+			_, err := b.allow()
+			if open := errors.Is(err, ErrCircuitOpen); open != tt.open {
+				t.Fatalf("breaker open = %v, want %v", open, tt.open)
+			}
+		})
+	}
+}
+
+// halfOpen returns a breaker whose open duration has passed.
+func halfOpen(t *testing.T) *CircuitBreaker {
+	t.Helper()
+	b := NewCircuitBreaker("test", 1, time.Minute)
+	b.record(context.Background(), false, &UnavailableError{StatusCode: http.StatusServiceUnavailable})
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("breaker not open: %v", err)
+	}
+	b.openedAt = time.Now().Add(-time.Minute)
+	return b
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	b := halfOpen(t)
+	probe, err := b.allow()
+	if err != nil || !probe {
+		t.Fatalf("allow() = %v, %v, want the probe", probe, err)
+	}
+
+	// A request allowed before the breaker opened finishes during the probe.
+	b.record(context.Background(), false, nil)
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second request allowed while probing: %v", err)
+	}
+	if b.state != breakerHalfOpen {
+		t.Fatalf("state = %s, want half-open", b.state)
+	}
+
+	b.record(context.Background(), probe, nil)
+	if b.state != breakerClosed {
+		t.Fatalf("state = %s after a successful probe, want closed", b.state)
+	}
+}
+
+func TestCircuitBreakerProbeTimedOut(t *testing.T) {
+	b := halfOpen(t)
+	probe, err := b.allow()
+	if err != nil || !probe {
+		t.Fatalf("allow() = %v, %v, want the probe", probe, err)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	b.record(ctx, probe, &UnavailableError{Err: context.DeadlineExceeded})
+	if b.state != breakerHalfOpen {
+		t.Fatalf("state = %s after a timed out probe, want half-open", b.state)
+	}
+	if probe, err := b.allow(); err != nil || !probe {
+		t.Fatalf("allow() = %v, %v, want a new probe", probe, err)
+	}
+}
+
+func TestCircuitBreakerProbeFailed(t *testing.T) {
+	b := halfOpen(t)
+	probe, _ := b.allow()
+	b.record(context.Background(), probe, &UnavailableError{StatusCode: http.StatusInternalServerError})
+	if b.state != breakerOpen {
+		t.Fatalf("state = %s after a failed probe, want open", b.state)
+	}
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// clickHouseVars are the variables clickHouseQuery sets itself.
+var clickHouseVars = []string{"start", "end", "start_s", "end_s", "window", "step", "namespace", "object", "pod"}
+
+// clickHouseQuery expands the ClickHouse SQL template of the metric. The
+// variables are:
+//
+//   - $start and $end: the query range in Unix milliseconds
+//   - $start_s and $end_s: the query range in Unix seconds
+//   - $window and $step: the window and step in seconds
+//   - $namespace and $object (or $pod): string literals of regexps matching
+//     the namespace and object of the request, or any if the query is not
+//     made for one, for use with match()
+//   - $<label>: the string literal of the value of an equality requirement
+//     of the metric selector, with dots in the label replaced by underscores
+//
+// Equality requirements on labels whose variable is one of the above, such
+// as namespace or start, fail the request, so that a caller cannot choose the
+// time range or widen the query beyond the namespace it is made for.
+// Requirements other than equality are rejected, as they cannot be applied
+// to an arbitrary statement.
+func (p *signozProvider) clickHouseQuery(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector, r QueryRange) (SignozQueryRangeOptions, error) {
+	scope := queryScopeFrom(ctx)
+	w := window(metric, r)
+	end := time.Now()
+	start := end.Add(-w)
+	vars := map[string]string{
+		"start":     strconv.FormatInt(start.UnixMilli(), 10),
+		"end":       strconv.FormatInt(end.UnixMilli(), 10),
+		"start_s":   strconv.FormatInt(start.Unix(), 10),
+		"end_s":     strconv.FormatInt(end.Unix(), 10),
+		"window":    strconv.FormatInt(int64(w.Seconds()), 10),
+		"step":      strconv.FormatInt(step(metric, r), 10),
+		"namespace": quoteFilterValue("^" + regexpOrAny(scope.namespace) + "$"),
+		"object":    quoteFilterValue("^" + regexpOrAny(scope.object) + "$"),
+		"pod":       quoteFilterValue("^" + regexpOrAny(scope.object) + "$"),
+	}
+
+	if metricSelector != nil && !metricSelector.Empty() {
+		reqs, _ := metricSelector.Requirements()
+		for _, req := range reqs {
+			if op := req.Operator(); op != selection.Equals && op != selection.DoubleEquals {
+				return SignozQueryRangeOptions{}, apierr.NewBadRequest(fmt.Sprintf("metric selector %q: only equality requirements are supported for ClickHouse metrics", metricSelector.String()))
+			}
+			name, err := selectorVar(metricSelector, req, clickHouseVars)
+			if err != nil {
+				return SignozQueryRangeOptions{}, err
+			}
+			vars[name] = quoteFilterValue(req.Values().List()[0])
+		}
+	}
+
+	query, err := expandTemplate(metric, metric.ClickHouseSQL, vars)
+	if err != nil {
+		return SignozQueryRangeOptions{}, err
+	}
+
+	return SignozQueryRangeOptions{
+		RequestType: "time_series",
+		Start:       start.UnixMilli(),
+		End:         end.UnixMilli(),
+		CompositeQuery: SignozCompositeQuery{
+			Queries: []SignozQuery{{
+				Type: "clickhouse_sql",
+				Spec: SignozQuerySpec{
+					Name:  "A",
+					Query: query,
+				},
+			}},
+		},
+	}, nil
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ConcurrencyOptions limits the number of metrics API requests served at
+// once, queueing the excess.
+type ConcurrencyOptions struct {
+	// MaxInflight is the number of requests served at once. Zero disables
+	// the limit.
+	MaxInflight int
+	// MaxQueued is the number of requests waiting for a slot, per priority.
+	// Requests arriving at a full queue are shed.
+	MaxQueued int
+	// QueueTimeout is how long a request waits for a slot before it is shed.
+	QueueTimeout time.Duration
+	// PriorityUsers are admitted ahead of the queued requests of other
+	// users, e.g. the HPA controller.
+	PriorityUsers []string
+}
+
+// DefaultPriorityUsers are the identities the HPA controller queries the
+// metrics APIs with, with and without per-controller ServiceAccounts.
+var DefaultPriorityUsers = []string{
+	"system:serviceaccount:kube-system:horizontal-pod-autoscaler",
+	"system:kube-controller-manager",
+}
+
+// concurrencyLimiter bounds the requests served at once. Requests beyond the
+// limit wait in a FIFO queue; requests of priority users have their own
+// queue that is drained first, so a flood of requests from another client
+// cannot starve the HPA controller.
+type concurrencyLimiter struct {
+	opts ConcurrencyOptions
+
+	mu       sync.Mutex
+	inflight int
+	// queues holds the waiting requests, priority requests first. A waiter
+	// is admitted by closing its channel.
+	queues [2][]chan struct{}
+}
+
+func newConcurrencyLimiter(opts ConcurrencyOptions) *concurrencyLimiter {
+	return &concurrencyLimiter{opts: opts}
+}
+
+// acquire waits for a slot and returns the function releasing it. It returns
+// a TooManyRequests error if the queue is full or the request waited longer
+// than the queue timeout.
+func (l *concurrencyLimiter) acquire(ctx context.Context, api string) (func(), error) {
+	if l == nil || l.opts.MaxInflight <= 0 {
+		return func() {}, nil
+	}
+
+	queue := 1
+	if slices.Contains(l.opts.PriorityUsers, requester(ctx)) {
+		queue = 0
+	}
+
+	l.mu.Lock()
+	if l.inflight < l.opts.MaxInflight && l.waiting(queue) == 0 {
+		l.inflight++
+		l.updateGauges()
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	if len(l.queues[queue]) >= l.opts.MaxQueued {
+		l.mu.Unlock()
+		return nil, l.shed(api, "queue_full")
+	}
+	ready := make(chan struct{})
+	l.queues[queue] = append(l.queues[queue], ready)
+	l.updateGauges()
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.opts.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return l.release, nil
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := slices.Index(l.queues[queue], ready)
+	if i < 0 {
+		// Admitted while giving up, keep the slot.
+		return l.release, nil
+	}
+	l.queues[queue] = slices.Delete(l.queues[queue], i, i+1)
+	l.updateGauges()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, l.shed(api, "timeout")
+}
+
+// release frees a slot, handing it to the next queued request.
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	for i, q := range l.queues {
+		if len(q) > 0 {
+			close(q[0])
+			l.queues[i] = q[1:]
+			l.inflight++
+			break
+		}
+	}
+	l.updateGauges()
+}
+
+// waiting returns the number of requests queued ahead of a new request in
+// queue. It must be called with mu held.
+func (l *concurrencyLimiter) waiting(queue int) int {
+	n := 0
+	for _, q := range l.queues[:queue+1] {
+		n += len(q)
+	}
+	return n
+}
+
+// updateGauges must be called with mu held.
+func (l *concurrencyLimiter) updateGauges() {
+	inflightRequests.Set(float64(l.inflight))
+	queuedRequests.WithLabelValues("priority").Set(float64(len(l.queues[0])))
+	queuedRequests.WithLabelValues("normal").Set(float64(len(l.queues[1])))
+}
+
+func (l *concurrencyLimiter) shed(api, reason string) error {
+	shedRequests.WithLabelValues(api, reason).Inc()
+	return apierr.NewTooManyRequests(fmt.Sprintf("too many concurrent metrics requests, limit is %d in flight and %d queued", l.opts.MaxInflight, l.opts.MaxQueued), 1)
+}
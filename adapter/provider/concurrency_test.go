@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// waitLimiter waits until the limiter has the given number of requests
+// queued and in flight.
+func waitLimiter(t *testing.T, l *concurrencyLimiter, queued, inflight int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		gotQueued, gotInflight := l.waiting(1), l.inflight
+		l.mu.Unlock()
+		if gotQueued == queued && gotInflight == inflight {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d queued and %d in flight, want %d and %d", gotQueued, gotInflight, queued, inflight)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiterShedsRequests(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		opts ConcurrencyOptions
+		ctx  context.Context
+		want func(error) bool
+	}{
+		{
+			name: "disabled",
+			opts: ConcurrencyOptions{},
+			ctx:  context.Background(),
+			want: func(err error) bool { return err == nil },
+		},
+		{
+			name: "queue full",
+			opts: ConcurrencyOptions{MaxInflight: 1, QueueTimeout: time.Minute},
+			ctx:  context.Background(),
+			want: apierr.IsTooManyRequests,
+		},
+		{
+			name: "queue timeout",
+			opts: ConcurrencyOptions{MaxInflight: 1, MaxQueued: 1, QueueTimeout: 10 * time.Millisecond},
+			ctx:  context.Background(),
+			want: apierr.IsTooManyRequests,
+		},
+		{
+			name: "cancelled while queued",
+			opts: ConcurrencyOptions{MaxInflight: 1, MaxQueued: 1, QueueTimeout: time.Minute},
+			ctx:  cancelled,
+			want: func(err error) bool { return errors.Is(err, context.Canceled) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newConcurrencyLimiter(tt.opts)
+			release, err := l.acquire(context.Background(), "custom")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			release2, err := l.acquire(tt.ctx, "custom")
+			if !tt.want(err) {
+				t.Fatalf("got %v", err)
+			}
+			if err == nil {
+				release2()
+			}
+			if len(l.queues[0])+len(l.queues[1]) != 0 {
+				t.Fatal("shed request left in the queue")
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterPriority(t *testing.T) {
+	hpa := request.WithUser(context.Background(), &user.DefaultInfo{Name: DefaultPriorityUsers[0]})
+	l := newConcurrencyLimiter(ConcurrencyOptions{MaxInflight: 1, MaxQueued: 2, QueueTimeout: time.Minute, PriorityUsers: DefaultPriorityUsers})
+	release, err := l.acquire(context.Background(), "custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan string, 3)
+	enqueue := func(ctx context.Context, name string) {
+		go func() {
+			release, err := l.acquire(ctx, "custom")
+			if err != nil {
+				admitted <- err.Error()
+				return
+			}
+			admitted <- name
+			release()
+		}()
+	}
+	enqueue(context.Background(), "first")
+	waitLimiter(t, l, 1, 1)
+	enqueue(context.Background(), "second")
+	waitLimiter(t, l, 2, 1)
+	enqueue(hpa, "hpa")
+	waitLimiter(t, l, 3, 1)
+
+	release()
+	for _, want := range []string{"hpa", "first", "second"} {
+		if got := <-admitted; got != want {
+			t.Fatalf("admitted %s, want %s", got, want)
+		}
+	}
+	waitLimiter(t, l, 0, 0)
+}
@@ -0,0 +1,657 @@
+package provider
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// MetricsConfig is the file format accepted by --signoz-metrics-config.
+type MetricsConfig struct {
+	Metrics []MetricConfig `json:"metrics"`
+	// SLOs are expanded into burn-rate metrics.
+	SLOs []SLOConfig `json:"slos,omitempty"`
+}
+
+// MetricConfig holds the settings of a single exposed metric.
+type MetricConfig struct {
+	// Name is the metric name as exposed to Kubernetes and queried in SigNoz.
+	Name string `json:"name"`
+	// Metric is the SigNoz metric queried, if it differs from Name, so one
+	// SigNoz metric can be exposed several times with different settings.
+	Metric string `json:"metric,omitempty"`
+	// LabelFilters are added to the query filter in addition to the global
+	// label filters.
+	LabelFilters []LabelFilter `json:"labelFilters,omitempty"`
+	// FilterExpression is a SigNoz filter expression added to the query
+	// filter in addition to the global filter expression.
+	FilterExpression string `json:"filterExpression,omitempty"`
+	// SpaceAggregation is used by SigNoz to combine the series of a pod
+	// into one. Defaults to sum.
+	SpaceAggregation string `json:"spaceAggregation,omitempty"`
+	// StepSeconds overrides the query step for this metric.
+	StepSeconds int64 `json:"stepSeconds,omitempty"`
+	// WindowSeconds overrides the query window for this metric.
+	WindowSeconds int64 `json:"windowSeconds,omitempty"`
+	// TimeoutSeconds bounds each query of this metric, overriding the
+	// default metric timeout, so a slow query cannot hold up requests and
+	// polls for longer than its budget.
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+	// CacheTTLSeconds overrides how long responses of this metric are
+	// reused for identical queries.
+	CacheTTLSeconds int64 `json:"cacheTTLSeconds,omitempty"`
+	// Function is latest, to serve the latest value, or increase, to serve
+	// how much a counter grew over the window, with resets handled by
+	// SigNoz. Defaults to latest.
+	Function string `json:"function,omitempty"`
+	// Signal is the SigNoz signal queried: metrics, or traces or logs to
+	// aggregate the spans or log records of each object with Aggregation.
+	// Defaults to metrics.
+	Signal string `json:"signal,omitempty"`
+	// Aggregation is the aggregation expression of traces and logs metrics,
+	// e.g. count(), p99(duration_nano) or countIf(has_error = true).
+	// Defaults to count().
+	Aggregation string `json:"aggregation,omitempty"`
+	// TimeAggregation reduces the points of each series over the window to
+	// the served value: last, avg, max, min, sum or p95, e.g. avg to smooth
+	// a bursty queue depth. Defaults to last. Cannot be combined with
+	// function increase.
+	TimeAggregation string `json:"timeAggregation,omitempty"`
+	// GroupBy lists extra attributes the query is grouped by. By default
+	// SigNoz aggregates server-side to one series per pod; attributes used
+	// as relabel source labels are added automatically.
+	GroupBy []string `json:"groupBy,omitempty"`
+	// Relabel rules are applied to the labels of every returned series.
+	Relabel []RelabelConfig `json:"relabel,omitempty"`
+	// Resource is the Kubernetes resource the metric describes, e.g. pods
+	// or nodes. Defaults to pods.
+	Resource string `json:"resource,omitempty"`
+	// Namespaced declares whether Resource is namespaced. Defaults to true,
+	// except for nodes, namespaces and persistentvolumes.
+	Namespaced *bool `json:"namespaced,omitempty"`
+	// ObjectLabel is the series attribute holding the name of the described
+	// object. It has a default for pods, nodes and namespaces and is
+	// required for other resources.
+	ObjectLabel string `json:"objectLabel,omitempty"`
+	// ObjectLabels are candidate attributes holding the name of the
+	// described object in priority order, for pipelines that disagree on
+	// the attribute; the first one set on a series is used. Cannot be
+	// combined with ObjectLabel.
+	ObjectLabels []string `json:"objectLabels,omitempty"`
+	// OwnerRollup queries the metric per pod and aggregates the pods to
+	// their owner of Resource, found through the controller
+	// ownerReferences, e.g. from a pod through its ReplicaSet to its
+	// Deployment, for series labeled with pod names only. The values of the
+	// pods are combined by SpaceAggregation if it is avg, max or min, and
+	// summed otherwise.
+	OwnerRollup bool `json:"ownerRollup,omitempty"`
+	// ZeroIsMissing treats series whose latest value is zero as missing,
+	// for exporters that report zero when they have no data. By default a
+	// zero value is served like any other value.
+	ZeroIsMissing bool `json:"zeroIsMissing,omitempty"`
+	// PerPodValueMode is how the series of an object are combined into its
+	// value, and those of an external metric into the served values: sum
+	// (the default) sums the series of an object and serves one external
+	// value per series, avg and max serve the average or maximum of the
+	// series of an object and a single external value over all series.
+	PerPodValueMode string `json:"perPodValueMode,omitempty"`
+	// MissingValuePolicy is what is served for objects without a series
+	// while other objects have one, e.g. pods that just started: skip (the
+	// default) leaves them out or fails the request for a single object
+	// with NotFound, zero serves 0 and constant:<n> serves n, so new pods
+	// count towards HPA averages during warm-up. aggregate serves a single
+	// object the aggregate of all series of the query, for metrics whose
+	// series do not name objects, and skips objects of list requests.
+	// Requests without any series follow GapFill.
+	MissingValuePolicy string `json:"missingValuePolicy,omitempty"`
+	// TopK keeps only the K series with the highest values, after grouping
+	// and relabeling, so high-cardinality groupings can back an external
+	// metric. Zero keeps all series.
+	TopK int `json:"topK,omitempty"`
+	// GapFill decides what is served when the window contains no
+	// datapoints at all. By default requests fail with NotFound.
+	GapFill *GapFillConfig `json:"gapFill,omitempty"`
+	// Formula computes the metric from several SigNoz metrics instead of
+	// querying the metric of the same name.
+	Formula *FormulaConfig `json:"formula,omitempty"`
+	// Expression derives the metric from other configured metrics of the
+	// same resource, e.g. http_rps / phpfpm_total_processes, evaluated per
+	// object from their latest results instead of querying SigNoz.
+	Expression string `json:"expression,omitempty"`
+	// Unit is the OTel unit of the values, e.g. ms or By. Values in time,
+	// byte and ratio units are converted to seconds, bytes and fractions.
+	// Defaults to the unit SigNoz reports for the metric.
+	Unit string `json:"unit,omitempty"`
+	// Scale multiplies values before they are converted, e.g. 0.001 to
+	// serve a counter in thousands.
+	Scale float64 `json:"scale,omitempty"`
+	// ServedUnit is the unit values are served in instead of the base unit,
+	// e.g. ms for durations or MiBy for sizes, so HPA targets can be written
+	// in it. It must be of the same kind as Unit.
+	ServedUnit string `json:"servedUnit,omitempty"`
+	// Precision is the number of decimal digits served, from 0 to 9.
+	// Defaults to 3 for durations and ratios and 0 otherwise.
+	Precision *int `json:"precision,omitempty"`
+	// Schedules override the metric while their schedule matches. The
+	// first active override applies.
+	Schedules []ScheduleOverride `json:"schedules,omitempty"`
+	// Synthetic generates the values of the metric instead of querying
+	// SigNoz.
+	Synthetic *SyntheticConfig `json:"synthetic,omitempty"`
+	// ShadowQuery is a PromQL query expected to return the same values,
+	// e.g. the query the metric was migrated from. A sample of the queries
+	// of the metric is compared against it, see --shadow-sample-rate.
+	ShadowQuery string `json:"shadowQuery,omitempty"`
+	// PromQL is a PromQL query template run instead of a builder query, with
+	// variables for the namespace, object and metric selector of the
+	// request, see promQLQuery. Global filters are not added to it.
+	PromQL string `json:"promql,omitempty"`
+	// ClickHouseSQL is a ClickHouse SQL statement template run instead of a
+	// builder query, for data only reachable through SQL such as span-derived
+	// counts, see clickHouseQuery. Global filters are not added to it.
+	ClickHouseSQL string `json:"clickhouseSQL,omitempty"`
+	// Apdex computes the Apdex score of a latency histogram instead of
+	// querying the metric of the same name.
+	Apdex *ApdexConfig `json:"apdex,omitempty"`
+
+	expr expr
+	// stepAggregation is how SigNoz aggregates the points of a series
+	// within a step. Defaults to latest.
+	stepAggregation string
+	// namespace restricts the metric to requests in this namespace, for
+	// metrics declared by a SignozMetric.
+	namespace string
+	// podLabels are the candidate attributes naming pods if the metric sets
+	// no object label, from --pod-label-keys.
+	podLabels []string
+	// namespaceKey is the attribute holding the namespace of objects, from
+	// --namespace-label-key.
+	namespaceKey string
+}
+
+// missingAggregate is the missing value policy serving the aggregate of all
+// series.
+const missingAggregate = "aggregate"
+
+// missingValue returns the value served for objects without a series, and
+// false if they are left out.
+func (m *MetricConfig) missingValue() (float64, bool, error) {
+	switch policy := m.MissingValuePolicy; {
+	case policy == "" || policy == "skip" || policy == missingAggregate:
+		return 0, false, nil
+	case policy == "zero":
+		return 0, true, nil
+	case strings.HasPrefix(policy, "constant:"):
+		value, err := strconv.ParseFloat(strings.TrimPrefix(policy, "constant:"), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, false, fmt.Errorf("missingValuePolicy %q: constant must be a finite number", policy)
+		}
+		return value, true, nil
+	default:
+		return 0, false, fmt.Errorf("missingValuePolicy must be skip, zero, constant:<n> or aggregate, got %q", policy)
+	}
+}
+
+// Per-pod value modes.
+const (
+	ValueModeSum = "sum"
+	ValueModeAvg = "avg"
+	ValueModeMax = "max"
+)
+
+// valueMode returns how the series of an object are combined.
+func (m *MetricConfig) valueMode() string {
+	if m.PerPodValueMode == "" {
+		return ValueModeSum
+	}
+	return m.PerPodValueMode
+}
+
+// combineExternal combines the series of an external metric into a single
+// value unless the value mode is sum.
+func (m *MetricConfig) combineExternal(series []seriesValue) []seriesValue {
+	if m.valueMode() == ValueModeSum || len(series) < 2 {
+		return series
+	}
+	values := make([]float64, len(series))
+	for i, s := range series {
+		values[i] = s.Value
+	}
+	return []seriesValue{{Labels: map[string]string{}, Value: combine(m.valueMode(), values)}}
+}
+
+// Metric functions.
+const (
+	FunctionLatest   = "latest"
+	FunctionIncrease = "increase"
+)
+
+// defaultObjectLabels are the OTel resource attributes naming objects of the
+// well-known resources.
+var defaultObjectLabels = map[string]string{
+	"pods":                   podLabelKey,
+	"nodes":                  "k8s.node.name",
+	"namespaces":             "k8s.namespace.name",
+	"deployments.apps":       "k8s.deployment.name",
+	"statefulsets.apps":      "k8s.statefulset.name",
+	"daemonsets.apps":        "k8s.daemonset.name",
+	"replicasets.apps":       "k8s.replicaset.name",
+	"jobs.batch":             "k8s.job.name",
+	"cronjobs.batch":         "k8s.cronjob.name",
+	"replicationcontrollers": "k8s.replicationcontroller.name",
+}
+
+// defaultObjectLabel returns the default object label of the resource. A
+// resource without a group, e.g. deployments before it is resolved through
+// the REST mapper, matches the well-known resource of that name.
+func defaultObjectLabel(resource string) string {
+	if label, ok := defaultObjectLabels[resource]; ok {
+		return label
+	}
+	gr := schema.ParseGroupResource(resource)
+	if gr.Group != "" {
+		return ""
+	}
+	for known, label := range defaultObjectLabels {
+		if schema.ParseGroupResource(known).Resource == gr.Resource {
+			return label
+		}
+	}
+	return ""
+}
+
+// clusterScopedResources are resources that default to namespaced: false.
+var clusterScopedResources = map[string]bool{
+	"nodes":             true,
+	"namespaces":        true,
+	"persistentvolumes": true,
+}
+
+func (m *MetricConfig) resource() string {
+	if m.Resource == "" {
+		return "pods"
+	}
+	return m.Resource
+}
+
+func (m *MetricConfig) groupResource() schema.GroupResource {
+	return schema.ParseGroupResource(m.resource())
+}
+
+func (m *MetricConfig) namespaced() bool {
+	if m.Namespaced != nil {
+		return *m.Namespaced
+	}
+	return !clusterScopedResources[m.resource()]
+}
+
+// servedIn reports whether the metric is served to requests in namespace.
+func (m *MetricConfig) servedIn(namespace string) bool {
+	return m.namespace == "" || m.namespace == namespace
+}
+
+// namespaceLabel returns the attribute holding the namespace of the
+// described objects, or "" if they are cluster-scoped or it is unknown.
+func (m *MetricConfig) namespaceLabel() string {
+	if !m.namespaced() {
+		return ""
+	}
+	return m.namespaceKey
+}
+
+// namespaceFilter restricts the queries of a namespace-scoped metric to the
+// series of its namespace, those made for objects of a namespace to its
+// series if the namespace attribute is known, and those made for a namespace
+// object to the series of that namespace.
+func (m *MetricConfig) namespaceFilter(scope queryScope) string {
+	if m.namespace != "" {
+		return fmt.Sprintf("%s = %s", cmp.Or(m.namespaceLabel(), "k8s.namespace.name"), quoteFilterValue(m.namespace))
+	}
+	if key, namespace := m.namespaceLabel(), scope.objectNamespace(); key != "" && namespace != "" {
+		return fmt.Sprintf("%s = %s", key, quoteFilterValue(namespace))
+	}
+	if labels := m.objectLabels(); m.resource() == "namespaces" && len(labels) == 1 && scope.objects && scope.object != "" {
+		return fmt.Sprintf("%s = %s", labels[0], quoteFilterValue(scope.object))
+	}
+	return ""
+}
+
+// objectLabels returns the attributes that may hold the name of the
+// described object, in priority order.
+func (m *MetricConfig) objectLabels() []string {
+	switch {
+	case len(m.ObjectLabels) > 0:
+		return m.ObjectLabels
+	case m.ObjectLabel != "":
+		return []string{m.ObjectLabel}
+	case m.resource() == "pods" && len(m.podLabels) > 0:
+		return m.podLabels
+	case m.resource() == "namespaces" && m.namespaceKey != "":
+		return []string{m.namespaceKey}
+	}
+	if label := defaultObjectLabel(m.resource()); label != "" {
+		return []string{label}
+	}
+	return nil
+}
+
+// queryLabels returns the attributes naming the objects series are queried
+// for: the pods of an owner rollup, or else the described objects.
+func (m *MetricConfig) queryLabels() []string {
+	if !m.OwnerRollup {
+		return m.objectLabels()
+	}
+	if len(m.podLabels) > 0 {
+		return m.podLabels
+	}
+	return []string{podLabelKey}
+}
+
+// objectLabelVariants returns the query labels and the namespace label with
+// their dot/underscore counterparts, as grouped by in queries.
+func (m *MetricConfig) objectLabelVariants() []string {
+	var keys []string
+	for _, label := range append(slices.Clone(m.queryLabels()), m.namespaceLabel()) {
+		if label == "" {
+			continue
+		}
+		for _, key := range labelKeyVariants(label) {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func (m *MetricConfig) spaceAggregation() string {
+	if m.SpaceAggregation == "" {
+		return "sum"
+	}
+	return m.SpaceAggregation
+}
+
+// reduce returns how the points of a series are reduced to the served
+// value: by the time aggregation if set, summed for queries of the per-step
+// increase of counters, so the value is the increase over the window, or
+// else the latest point.
+func (m *MetricConfig) reduce() func([]SignozSeriesValue) (float64, bool) {
+	if agg, ok := timeAggregations[m.TimeAggregation]; ok {
+		return agg.reduce
+	}
+	if m.signal() != SignalMetrics {
+		return m.signalReduce()
+	}
+	if m.Function == FunctionIncrease || m.stepAggregation == "increase" || m.Apdex != nil {
+		return sumValues
+	}
+	return latestValue
+}
+
+// formulaReduce returns how the points of a formula evaluated in SigNoz are
+// reduced to the served value: by the time aggregation if set, or else the
+// latest point.
+func (m *MetricConfig) formulaReduce() func([]SignozSeriesValue) (float64, bool) {
+	if agg, ok := timeAggregations[m.TimeAggregation]; ok {
+		return agg.reduce
+	}
+	return latestValue
+}
+
+// groupByKeys returns the configured group-by attributes plus the source
+// labels of the relabel rules, without duplicates or the object keys.
+func (m *MetricConfig) groupByKeys() []string {
+	seen := map[string]bool{}
+	for _, key := range m.objectLabelVariants() {
+		seen[key] = true
+	}
+
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range m.GroupBy {
+		add(key)
+	}
+	for _, r := range m.Relabel {
+		for _, key := range r.SourceLabels {
+			add(key)
+		}
+	}
+	return keys
+}
+
+// LoadMetricsConfig reads and validates a metrics config file.
+func LoadMetricsConfig(path string) (*MetricsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics config: %w", err)
+	}
+
+	var config MetricsConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics config %s: %w", path, err)
+	}
+
+	slos, err := ExpandSLOs(config.SLOs)
+	if err != nil {
+		return nil, err
+	}
+	config.Metrics = append(config.Metrics, slos...)
+
+	if err := ValidateMetricConfigs(config.Metrics); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ValidateMetricConfigs checks the metric configs and compiles their relabel
+// rules. All problems are returned joined.
+func ValidateMetricConfigs(metrics []MetricConfig) error {
+	var errs []error
+	seen := map[string]bool{}
+	for i := range metrics {
+		m := &metrics[i]
+		if m.Name == "" {
+			errs = append(errs, fmt.Errorf("metrics[%d]: name is required", i))
+		} else if seen[m.Name] {
+			errs = append(errs, fmt.Errorf("metrics[%d]: duplicate metric %q", i, m.Name))
+		}
+		seen[m.Name] = true
+
+		if m.StepSeconds < 0 {
+			errs = append(errs, fmt.Errorf("metrics[%d]: stepSeconds must not be negative", i))
+		}
+		if m.TopK < 0 {
+			errs = append(errs, fmt.Errorf("metrics[%d]: topK must not be negative", i))
+		}
+		if m.WindowSeconds < 0 {
+			errs = append(errs, fmt.Errorf("metrics[%d]: windowSeconds must not be negative", i))
+		}
+		if m.TimeoutSeconds < 0 {
+			errs = append(errs, fmt.Errorf("metrics[%d]: timeoutSeconds must not be negative", i))
+		}
+		if m.CacheTTLSeconds < 0 {
+			errs = append(errs, fmt.Errorf("metrics[%d]: cacheTTLSeconds must not be negative", i))
+		}
+		if m.GapFill != nil {
+			if err := m.GapFill.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d]: gapFill: %w", i, err))
+			}
+		}
+		switch m.Function {
+		case "", FunctionLatest, FunctionIncrease:
+		default:
+			errs = append(errs, fmt.Errorf("metrics[%d]: function must be latest or increase, got %q", i, m.Function))
+		}
+		if m.TimeAggregation != "" {
+			if _, ok := timeAggregations[m.TimeAggregation]; !ok {
+				errs = append(errs, fmt.Errorf("metrics[%d]: timeAggregation must be last, avg, max, min, sum or p95, got %q", i, m.TimeAggregation))
+			}
+			if m.Function == FunctionIncrease || m.Apdex != nil || m.Synthetic != nil || m.Expression != "" {
+				errs = append(errs, fmt.Errorf("metrics[%d]: timeAggregation cannot be combined with function increase, apdex, synthetic or expression", i))
+			}
+		}
+		if m.Function == FunctionIncrease && m.Formula != nil && m.Formula.evaluation() == FormulaEvaluationServer {
+			errs = append(errs, fmt.Errorf("metrics[%d]: function increase requires formula evaluation client", i))
+		}
+		if m.ObjectLabel != "" && len(m.ObjectLabels) > 0 {
+			errs = append(errs, fmt.Errorf("metrics[%d]: objectLabel cannot be combined with objectLabels", i))
+		}
+		if slices.Contains(m.ObjectLabels, "") {
+			errs = append(errs, fmt.Errorf("metrics[%d]: objectLabels must not contain empty attributes", i))
+		}
+		if len(m.objectLabels()) == 0 {
+			errs = append(errs, fmt.Errorf("metrics[%d]: objectLabel is required for resource %q", i, m.resource()))
+		}
+		if _, _, err := m.missingValue(); err != nil {
+			errs = append(errs, fmt.Errorf("metrics[%d]: %w", i, err))
+		}
+		if m.Scale < 0 || math.IsNaN(m.Scale) || math.IsInf(m.Scale, 0) {
+			errs = append(errs, fmt.Errorf("metrics[%d]: scale must be a positive number, got %v", i, m.Scale))
+		}
+		if m.ServedUnit != "" {
+			target, ok := units[m.ServedUnit]
+			source, known := units[normalizeUnit(m.Unit)]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("metrics[%d]: servedUnit %q is not a supported time, byte or ratio unit", i, m.ServedUnit))
+			case m.Unit != "" && (!known || source.kind != target.kind):
+				errs = append(errs, fmt.Errorf("metrics[%d]: servedUnit %q is not of the same kind as unit %q", i, m.ServedUnit, m.Unit))
+			}
+		}
+		if m.Precision != nil && (*m.Precision < 0 || *m.Precision > 9) {
+			errs = append(errs, fmt.Errorf("metrics[%d]: precision must be between 0 and 9, got %d", i, *m.Precision))
+		}
+		switch m.PerPodValueMode {
+		case "", ValueModeSum, ValueModeAvg, ValueModeMax:
+		default:
+			errs = append(errs, fmt.Errorf("metrics[%d]: perPodValueMode must be sum, avg or max, got %q", i, m.PerPodValueMode))
+		}
+		if m.OwnerRollup {
+			if m.resource() == "pods" || !m.namespaced() {
+				errs = append(errs, fmt.Errorf("metrics[%d]: ownerRollup requires a namespaced resource other than pods", i))
+			}
+			if m.Expression != "" || m.Synthetic != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d]: ownerRollup cannot be combined with expression or synthetic", i))
+			}
+		}
+
+		if m.Formula != nil {
+			if err := m.Formula.compile(); err != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d].formula: %w", i, err))
+			}
+		}
+		if m.Expression != "" {
+			if m.Formula != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d]: expression cannot be combined with formula", i))
+			}
+			if e, err := parseExpr(m.Expression); err != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d].expression: %w", i, err))
+			} else {
+				m.expr = e
+			}
+		}
+
+		if m.Synthetic != nil {
+			if err := m.Synthetic.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d].synthetic: %w", i, err))
+			}
+			if m.Formula != nil || m.Expression != "" {
+				errs = append(errs, fmt.Errorf("metrics[%d]: synthetic cannot be combined with formula or expression", i))
+			}
+		}
+
+		if m.Apdex != nil {
+			if err := m.Apdex.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d].apdex: %w", i, err))
+			}
+			if m.Formula != nil || m.Expression != "" || m.Synthetic != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d]: apdex cannot be combined with formula, expression or synthetic", i))
+			}
+		}
+		if m.Metric != "" && (m.Formula != nil || m.Expression != "" || m.Synthetic != nil || m.Apdex != nil) {
+			errs = append(errs, fmt.Errorf("metrics[%d]: metric cannot be combined with formula, expression, synthetic or apdex", i))
+		}
+		if err := m.validateSignal(); err != nil {
+			errs = append(errs, fmt.Errorf("metrics[%d]: %w", i, err))
+		}
+		if m.PromQL != "" && m.ClickHouseSQL != "" {
+			errs = append(errs, fmt.Errorf("metrics[%d]: promql and clickhouseSQL are mutually exclusive", i))
+		}
+		if m.ClickHouseSQL != "" && (m.Metric != "" || m.Function != "" || m.Formula != nil || m.Expression != "" || m.Synthetic != nil || m.Apdex != nil ||
+			m.FilterExpression != "" || len(m.LabelFilters) > 0 || len(m.GroupBy) > 0 || m.SpaceAggregation != "") {
+			errs = append(errs, fmt.Errorf("metrics[%d]: clickhouseSQL cannot be combined with metric, function, formula, expression, synthetic, apdex, filterExpression, labelFilters, groupBy or spaceAggregation", i))
+		}
+		if m.PromQL != "" && (m.Metric != "" || m.Function != "" || m.Formula != nil || m.Expression != "" || m.Synthetic != nil || m.Apdex != nil ||
+			m.FilterExpression != "" || len(m.LabelFilters) > 0 || len(m.GroupBy) > 0 || m.SpaceAggregation != "") {
+			errs = append(errs, fmt.Errorf("metrics[%d]: promql cannot be combined with metric, function, formula, expression, synthetic, apdex, filterExpression, labelFilters, groupBy or spaceAggregation", i))
+		}
+		if m.ShadowQuery != "" && (m.Expression != "" || m.Synthetic != nil) {
+			errs = append(errs, fmt.Errorf("metrics[%d]: shadowQuery cannot be combined with expression or synthetic", i))
+		}
+
+		for j := range m.Schedules {
+			o := &m.Schedules[j]
+			if err := o.compile(); err != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d].schedules[%d]: %w", i, j, err))
+			}
+			if (o.Metric != "" || len(o.LabelFilters) > 0) && (m.Formula != nil || m.Expression != "" || m.Synthetic != nil || m.Apdex != nil || m.PromQL != "" || m.ClickHouseSQL != "") {
+				errs = append(errs, fmt.Errorf("metrics[%d].schedules[%d]: metric and labelFilters cannot be overridden for formula, derived, synthetic, apdex, PromQL or ClickHouse metrics", i, j))
+			}
+		}
+
+		for j := range m.Relabel {
+			if err := m.Relabel[j].compile(); err != nil {
+				errs = append(errs, fmt.Errorf("metrics[%d].relabel[%d]: %w", i, j, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MergeMetricNames returns the configured metrics followed by a default
+// config for every name that is not configured yet.
+func MergeMetricNames(metrics []MetricConfig, names []string) []MetricConfig {
+	seen := map[string]bool{}
+	for _, m := range metrics {
+		seen[m.Name] = true
+	}
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		metrics = append(metrics, MetricConfig{Name: name})
+	}
+	return metrics
+}
+
+// MergeMetrics returns the configured metrics followed by every metric in
+// extra whose name is not configured yet, so explicit configuration
+// overrides presets.
+func MergeMetrics(metrics, extra []MetricConfig) []MetricConfig {
+	seen := map[string]bool{}
+	for _, m := range metrics {
+		seen[m.Name] = true
+	}
+	for _, m := range extra {
+		if seen[m.Name] {
+			continue
+		}
+		seen[m.Name] = true
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
@@ -0,0 +1,320 @@
+package provider
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+var signozMetricResource = schema.GroupVersionResource{Group: "signozadapter.brainpod.nl", Version: "v1alpha1", Resource: "signozmetrics"}
+
+// Reasons of the Ready condition of a SignozMetric.
+const (
+	signozMetricAccepted = "Accepted"
+	signozMetricInvalid  = "Invalid"
+	signozMetricConflict = "NameConflict"
+)
+
+// statusInterval is how often the health of the served metrics is written
+// to the status of their SignozMetric objects.
+const statusInterval = 30 * time.Second
+
+// signozMetricStatus is the status of a SignozMetric. The health fields are
+// those of its metric, see MetricHealth, and are empty while it is not
+// served or not yet queried.
+type signozMetricStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	LastQueryTime      *metav1.Time       `json:"lastQueryTime,omitempty"`
+	LastError          string             `json:"lastError,omitempty"`
+	SeriesCount        *int               `json:"seriesCount,omitempty"`
+	EffectiveQuery     string             `json:"effectiveQuery,omitempty"`
+}
+
+// signozMetricResult is the outcome of evaluating a SignozMetric.
+type signozMetricResult struct {
+	// metric is the name of the served metric, empty if it is not served.
+	metric    string
+	condition metav1.Condition
+}
+
+// MetricController serves the metrics declared by SignozMetric objects in
+// addition to the configured ones. The spec of a SignozMetric is a metric
+// config, named after the object unless spec.name is set. Its metric is only
+// served to requests in the namespace of the object and only queries the
+// series of that namespace, so teams can declare metrics without seeing
+// those of other namespaces.
+//
+// Metric names are global: when several objects declare the same name the
+// oldest one wins, and configured metrics win over all of them. Each object
+// reports whether its metric is served in its Ready condition and, if the
+// updater is a StatusReporter, the health of its metric.
+type MetricController struct {
+	dynamic  dynamic.Interface
+	mapper   apimeta.RESTMapper
+	updater  MetricUpdater
+	status   StatusReporter
+	informer cache.SharedIndexInformer
+	changed  chan struct{}
+	// results are the outcomes of the last sync by object key, only used by
+	// the Run goroutine.
+	results map[string]signozMetricResult
+
+	mu     sync.Mutex
+	static []MetricConfig
+}
+
+// NewMetricController returns a controller updating the metrics of updater
+// from the SignozMetric objects in all namespaces. static are the configured
+// metrics, which must be valid.
+func NewMetricController(dyn dynamic.Interface, mapper apimeta.RESTMapper, updater MetricUpdater, static []MetricConfig) *MetricController {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(dyn, 0)
+	c := &MetricController{
+		dynamic:  dyn,
+		mapper:   mapper,
+		updater:  updater,
+		informer: factory.ForResource(signozMetricResource).Informer(),
+		changed:  make(chan struct{}, 1),
+		static:   static,
+	}
+	c.status, _ = updater.(StatusReporter)
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(any) { c.trigger() },
+		// Status writes, including our own, don't change the metric.
+		UpdateFunc: func(oldObj, newObj any) {
+			o, ok1 := oldObj.(*unstructured.Unstructured)
+			n, ok2 := newObj.(*unstructured.Unstructured)
+			if !ok1 || !ok2 || o.GetGeneration() != n.GetGeneration() {
+				c.trigger()
+			}
+		},
+		DeleteFunc: func(any) { c.trigger() },
+	})
+	return c
+}
+
+// SetStatic replaces the configured metrics, which must be valid, and
+// re-evaluates the SignozMetric objects against them.
+func (c *MetricController) SetStatic(metrics []MetricConfig) {
+	c.mu.Lock()
+	c.static = metrics
+	c.mu.Unlock()
+	c.trigger()
+}
+
+func (c *MetricController) trigger() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run watches the SignozMetric objects and updates the served metrics on
+// every change until ctx is done. Changes arriving while the metrics are
+// updated are coalesced into a single update. The status of the objects is
+// refreshed every statusInterval.
+func (c *MetricController) Run(ctx context.Context) {
+	go c.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return
+	}
+	klog.Infof("watching %s for metrics", signozMetricResource.GroupResource())
+
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.changed:
+			c.sync(ctx)
+		case <-ticker.C:
+			c.writeStatus(ctx)
+		}
+	}
+}
+
+// sync recomputes the served metrics from the configured metrics and the
+// SignozMetric objects, and updates the status of the objects.
+func (c *MetricController) sync(ctx context.Context) {
+	var objects []*unstructured.Unstructured
+	for _, obj := range c.informer.GetStore().List() {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			objects = append(objects, u)
+		}
+	}
+	slices.SortFunc(objects, func(a, b *unstructured.Unstructured) int {
+		if c := a.GetCreationTimestamp().Compare(b.GetCreationTimestamp().Time); c != 0 {
+			return c
+		}
+		return cmp.Or(strings.Compare(a.GetNamespace(), b.GetNamespace()), strings.Compare(a.GetName(), b.GetName()))
+	})
+
+	c.mu.Lock()
+	metrics := slices.Clone(c.static)
+	c.mu.Unlock()
+	owners := map[string]string{}
+	for _, m := range metrics {
+		owners[m.Name] = "the adapter configuration"
+	}
+
+	results := make(map[string]signozMetricResult, len(objects))
+	for _, obj := range objects {
+		key := objectKey(obj.GetNamespace(), obj.GetName())
+		metric, err := c.metricFor(obj)
+		if err != nil {
+			results[key] = signozMetricResult{condition: metav1.Condition{Status: metav1.ConditionFalse, Reason: signozMetricInvalid, Message: err.Error()}}
+			continue
+		}
+		if owner, ok := owners[metric.Name]; ok {
+			results[key] = signozMetricResult{condition: metav1.Condition{Status: metav1.ConditionFalse, Reason: signozMetricConflict,
+				Message: fmt.Sprintf("metric %s is already declared by %s", metric.Name, owner)}}
+			continue
+		}
+		metrics = append(metrics, *metric)
+		owners[metric.Name] = fmt.Sprintf("SignozMetric %s", key)
+		results[key] = signozMetricResult{metric: metric.Name, condition: metav1.Condition{Status: metav1.ConditionTrue, Reason: signozMetricAccepted,
+			Message: fmt.Sprintf("metric %s is served", metric.Name)}}
+	}
+
+	c.updater.SetMetrics(metrics)
+	c.results = results
+	c.writeStatus(ctx)
+}
+
+// writeStatus updates the status of the objects evaluated by the last sync
+// with their outcome and the current health of their metric.
+func (c *MetricController) writeStatus(ctx context.Context) {
+	health := map[string]MetricHealth{}
+	if c.status != nil {
+		for _, s := range c.status.Status() {
+			health[s.Name] = s.MetricHealth
+		}
+	}
+	for _, obj := range c.informer.GetStore().List() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		key := objectKey(u.GetNamespace(), u.GetName())
+		result, ok := c.results[key]
+		if !ok {
+			// Added since the last sync, which is pending.
+			continue
+		}
+		// Objects whose metric is not served have no health.
+		if err := c.updateStatus(ctx, u, result.condition, health[result.metric]); err != nil {
+			klog.Errorf("failed to update status of SignozMetric %s: %v", key, err)
+		}
+	}
+}
+
+// metricFor returns the metric declared by a SignozMetric, scoped to its
+// namespace.
+func (c *MetricController) metricFor(obj *unstructured.Unstructured) (*MetricConfig, error) {
+	spec, ok, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil || !ok {
+		return nil, fmt.Errorf("spec is required")
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var metric MetricConfig
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&metric); err != nil {
+		return nil, fmt.Errorf("spec: %w", err)
+	}
+	if metric.Name == "" {
+		metric.Name = obj.GetName()
+	}
+	if metric.Expression != "" {
+		return nil, fmt.Errorf("spec.expression is not supported, derived metrics must be configured in the adapter")
+	}
+	if metric.PromQL != "" || metric.ClickHouseSQL != "" || metric.ShadowQuery != "" {
+		return nil, fmt.Errorf("spec.promql, spec.clickhouseSQL and spec.shadowQuery are not supported, their queries cannot be scoped to the namespace")
+	}
+
+	metrics := []MetricConfig{metric}
+	if err := ValidateMetricConfigs(metrics); err != nil {
+		return nil, fmt.Errorf("%s", strings.ReplaceAll(err.Error(), "metrics[0]: ", "spec: "))
+	}
+	resolveResources(c.mapper, metrics)
+	metric = metrics[0]
+	if !metric.namespaced() {
+		return nil, fmt.Errorf("spec.resource: %s is cluster-scoped, only metrics of namespaced resources can be declared", metric.resource())
+	}
+	metric.namespace = obj.GetNamespace()
+	return &metric, nil
+}
+
+// updateStatus sets the Ready condition and metric health of the object,
+// skipping the write if they did not change.
+func (c *MetricController) updateStatus(ctx context.Context, obj *unstructured.Unstructured, condition metav1.Condition, health MetricHealth) error {
+	var status signozMetricStatus
+	if current, ok, _ := unstructured.NestedMap(obj.Object, "status"); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(current, &status); err != nil {
+			klog.V(2).Infof("ignoring malformed status of SignozMetric %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+			status = signozMetricStatus{}
+		}
+	}
+
+	var lastQueryTime *metav1.Time
+	var seriesCount *int
+	if !health.LastQueryTime.IsZero() {
+		// The status only keeps seconds.
+		t := metav1.NewTime(health.LastQueryTime.Truncate(time.Second))
+		lastQueryTime = &t
+		seriesCount = &health.SeriesCount
+	}
+
+	condition.Type = "Ready"
+	condition.ObservedGeneration = obj.GetGeneration()
+	existing := apimeta.FindStatusCondition(status.Conditions, condition.Type)
+	if status.ObservedGeneration == obj.GetGeneration() && existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason &&
+		existing.Message == condition.Message && existing.ObservedGeneration == condition.ObservedGeneration &&
+		status.LastQueryTime.Equal(lastQueryTime) && status.LastError == health.LastError &&
+		equalIntPtr(status.SeriesCount, seriesCount) && status.EffectiveQuery == health.EffectiveQuery {
+		return nil
+	}
+	status.ObservedGeneration = obj.GetGeneration()
+	apimeta.SetStatusCondition(&status.Conditions, condition)
+	status.LastQueryTime = lastQueryTime
+	status.LastError = health.LastError
+	status.SeriesCount = seriesCount
+	status.EffectiveQuery = health.EffectiveQuery
+
+	updated, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	obj = obj.DeepCopy()
+	obj.Object["status"] = updated
+	_, err = c.dynamic.Resource(signozMetricResource).Namespace(obj.GetNamespace()).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
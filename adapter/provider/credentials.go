@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to SigNoz requests. It is used instead of
+// the API key when set on a SignozClient.
+type Authenticator interface {
+	Authenticate(ctx context.Context, request *http.Request) error
+}
+
+const (
+	// defaultTokenLifetime is assumed for tokens that do not say when they
+	// expire.
+	defaultTokenLifetime = 5 * time.Minute
+	// tokenRefreshMargin renews tokens this long before they expire.
+	tokenRefreshMargin = 30 * time.Second
+)
+
+// tokenCache holds a short-lived token until shortly before it expires.
+type tokenCache struct {
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// get returns the cached token, calling fetch for a new one if it expired.
+// fetch returns the token and how long it is valid.
+func (c *tokenCache) get(ctx context.Context, fetch func(context.Context) (string, time.Duration, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	token, lifetime, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expiry = time.Now().Add(max(lifetime-tokenRefreshMargin, lifetime/2))
+	return token, nil
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// derived reports whether the metric is computed from other metrics.
+func (m *MetricConfig) derived() bool {
+	return m.Expression != ""
+}
+
+// ValidateDerivedMetrics checks that derived metrics only refer to metrics
+// that are configured, describe the same resource and are not derived
+// themselves. It needs the complete list of metrics, including presets.
+func ValidateDerivedMetrics(metrics []MetricConfig) error {
+	byName := map[string]*MetricConfig{}
+	for i := range metrics {
+		byName[metrics[i].Name] = &metrics[i]
+	}
+
+	var errs []error
+	for _, m := range metrics {
+		if !m.derived() || m.expr == nil {
+			continue
+		}
+		for _, name := range exprVars(m.expr) {
+			ref, ok := byName[name]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("metric %q: expression refers to unknown metric %q", m.Name, name))
+			case ref.derived():
+				errs = append(errs, fmt.Errorf("metric %q: expression refers to derived metric %q", m.Name, name))
+			case ref.Synthetic != nil:
+				errs = append(errs, fmt.Errorf("metric %q: expression refers to synthetic metric %q", m.Name, name))
+			case ref.groupResource() != m.groupResource():
+				errs = append(errs, fmt.Errorf("metric %q: expression refers to metric %q of resource %q", m.Name, name, ref.resource()))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// derivedSeries evaluates the expression of a derived metric per object from
+// the results of the metrics it refers to. In polling mode these come from
+// the poller snapshots, so no extra SigNoz queries are made. Objects missing
+// from any of the metrics are left out.
+func (p *signozProvider) derivedSeries(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector, r QueryRange) ([]seriesValue, error) {
+	vars := map[string]map[string]float64{}
+	for _, name := range exprVars(metric.expr) {
+		ref, ok := p.metricConfig(name)
+		if !ok {
+			return nil, fmt.Errorf("derived metric %s refers to unknown metric %s", metric.Name, name)
+		}
+
+		var index *seriesIndex
+		if r == p.query().Custom {
+			var err error
+			if index, err = p.index(ctx, ref, metricSelector); err != nil {
+				return nil, err
+			}
+		} else {
+			series, err := p.fetchSeries(ctx, ref, metricSelector, r)
+			if err != nil {
+				return nil, err
+			}
+			index = newSeriesIndex(series, ref)
+		}
+
+		for object, value := range index.byObject {
+			if vars[object] == nil {
+				vars[object] = map[string]float64{}
+			}
+			vars[object][name] = value
+		}
+	}
+
+	objects := make([]string, 0, len(vars))
+	for object := range vars {
+		objects = append(objects, object)
+	}
+	slices.Sort(objects)
+
+	var series []seriesValue
+	for _, object := range objects {
+		if value, ok := metric.expr.eval(vars[object]); ok {
+			objectLabels := map[string]string{metric.objectLabels()[0]: object}
+			if namespace, name, ok := strings.Cut(object, "/"); ok && metric.namespaceLabel() != "" {
+				objectLabels = map[string]string{metric.objectLabels()[0]: name, metric.namespaceLabel(): namespace}
+			}
+			series = append(series, seriesValue{Labels: objectLabels, Value: value})
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	"github.com/brainpodnl/signoz-metrics-adapter/pkg/provider"
+)
+
+// discoveryCache holds the metric lists served to API discovery. The lists
+// are sorted and only replaced when their contents change, so discovery
+// clients don't see churn between identical configurations.
+type discoveryCache struct {
+	mu       sync.RWMutex
+	custom   []provider.CustomMetricInfo
+	external []provider.ExternalMetricInfo
+}
+
+// update replaces the cached lists if they differ from the current ones and
+// reports whether they changed.
+func (c *discoveryCache) update(custom []provider.CustomMetricInfo, external []provider.ExternalMetricInfo) bool {
+	slices.SortFunc(custom, func(a, b provider.CustomMetricInfo) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	slices.SortFunc(external, func(a, b provider.ExternalMetricInfo) int {
+		return strings.Compare(a.Metric, b.Metric)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if slices.Equal(c.custom, custom) && slices.Equal(c.external, external) {
+		return false
+	}
+
+	c.custom = custom
+	c.external = external
+	discoveryChanges.Inc()
+	klog.Infof("served metrics changed: %d custom metrics, %d external metrics", len(custom), len(external))
+	return true
+}
+
+func (c *discoveryCache) customMetrics() []provider.CustomMetricInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.custom)
+}
+
+func (c *discoveryCache) externalMetrics() []provider.ExternalMetricInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.external)
+}
@@ -0,0 +1,142 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+type dnsEntry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// CachingResolver resolves hostnames for the SigNoz client with positive and
+// negative caching, so short cluster DNS outages don't turn into failed
+// queries. Hosts can also be pinned to static addresses, and looked up at
+// dedicated DNS servers instead of the cluster DNS.
+type CachingResolver struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	static      map[string][]string
+	resolver    *net.Resolver
+	allowlist   *EndpointAllowlist
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+// NewCachingResolver returns a resolver caching successful lookups for ttl
+// and failed ones for negativeTTL. Hosts in static are never looked up.
+func NewCachingResolver(ttl, negativeTTL time.Duration, static map[string][]string) *CachingResolver {
+	return &CachingResolver{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		static:      static,
+		resolver:    net.DefaultResolver,
+		entries:     map[string]dnsEntry{},
+	}
+}
+
+// UseServers looks hosts up at the given DNS servers (host:port), tried in
+// order, instead of the servers of /etc/resolv.conf.
+func (r *CachingResolver) UseServers(servers []string) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	r.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var errs []error
+			for _, server := range servers {
+				conn, err := dialer.DialContext(ctx, network, server)
+				if err == nil {
+					return conn, nil
+				}
+				errs = append(errs, err)
+			}
+			return nil, errors.Join(errs...)
+		},
+	}
+}
+
+// Restrict only lets DialContext connect to addresses the allowlist allows.
+func (r *CachingResolver) Restrict(allowlist *EndpointAllowlist) {
+	r.allowlist = allowlist
+}
+
+// LookupHost returns the addresses of host. When a lookup fails and an
+// expired entry exists, the expired addresses are used instead.
+func (r *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.static[host]; ok {
+		return addrs, nil
+	}
+	// IPv6 literals may carry a zone, e.g. fe80::1%eth0.
+	if _, err := netip.ParseAddr(host); err == nil {
+		return []string{host}, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.entries[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, entry.err
+	}
+
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		if ok && len(entry.addrs) > 0 {
+			klog.Warningf("failed to resolve %s, using cached addresses: %v", host, err)
+			return entry.addrs, nil
+		}
+		r.store(host, dnsEntry{err: err, expires: time.Now().Add(r.negativeTTL)})
+		return nil, err
+	}
+
+	r.store(host, dnsEntry{addrs: addrs, expires: time.Now().Add(r.ttl)})
+	return addrs, nil
+}
+
+func (r *CachingResolver) store(host string, entry dnsEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[host] = entry
+}
+
+// DialContext returns a dial function for http.Transport that resolves hosts
+// through the cache and tries each address in turn.
+func (r *CachingResolver) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := r.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses found for %s", host)
+		}
+
+		var errs []error
+		for _, a := range addrs {
+			if r.allowlist != nil && !r.allowlist.allowsAddress(host, a) {
+				errs = append(errs, fmt.Errorf("address %s of %s is not in the endpoint allowlist", a, host))
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
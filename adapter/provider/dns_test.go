@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNSServer answers A queries for its hosts over UDP and fails all
+// others. Failing makes it answer every query with SERVFAIL. Tests look hosts
+// up fully qualified, so search domains of the machine are not tried.
+type fakeDNSServer struct {
+	conn    net.PacketConn
+	hosts   map[string]string
+	queries atomic.Int32
+	failing atomic.Bool
+}
+
+func newFakeDNSServer(t *testing.T, hosts map[string]string) *fakeDNSServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeDNSServer{conn: conn, hosts: hosts}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeDNSServer) addr() string { return s.conn.LocalAddr().String() }
+
+func (s *fakeDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+			continue
+		}
+		question := msg.Questions[0]
+		if question.Type == dnsmessage.TypeA {
+			s.queries.Add(1)
+		}
+		msg.Header.Response = true
+		msg.Header.RCode = dnsmessage.RCodeSuccess
+		ip, ok := s.hosts[question.Name.String()]
+		switch {
+		case s.failing.Load():
+			msg.Header.RCode = dnsmessage.RCodeServerFailure
+		case !ok:
+			msg.Header.RCode = dnsmessage.RCodeNameError
+		case question.Type == dnsmessage.TypeA:
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte(net.ParseIP(ip).To4())},
+			}}
+		}
+		packed, err := msg.Pack()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(packed, from)
+	}
+}
+
+func TestCachingResolverLookupHost(t *testing.T) {
+	server := newFakeDNSServer(t, map[string]string{"signoz.test.": "10.0.0.1"})
+	r := NewCachingResolver(time.Minute, time.Minute, map[string][]string{"pinned.test": {"10.0.0.9"}})
+	r.UseServers([]string{server.addr()})
+	ctx := context.Background()
+
+	for range 2 {
+		addrs, err := r.LookupHost(ctx, "signoz.test.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(addrs, []string{"10.0.0.1"}) {
+			t.Fatalf("got %v, want [10.0.0.1]", addrs)
+		}
+	}
+	if got := server.queries.Load(); got != 1 {
+		t.Fatalf("sent %d queries, want the second lookup cached", got)
+	}
+
+	if addrs, err := r.LookupHost(ctx, "pinned.test"); err != nil || !slices.Equal(addrs, []string{"10.0.0.9"}) {
+		t.Fatalf("pinned host: got %v, %v, want [10.0.0.9]", addrs, err)
+	}
+	if addrs, err := r.LookupHost(ctx, "10.1.2.3"); err != nil || !slices.Equal(addrs, []string{"10.1.2.3"}) {
+		t.Fatalf("IP literal: got %v, %v, want [10.1.2.3]", addrs, err)
+	}
+	if got := server.queries.Load(); got != 1 {
+		t.Fatalf("sent %d queries, want pinned hosts and IPs not looked up", got)
+	}
+}
+
+func TestCachingResolverNegativeCache(t *testing.T) {
+	server := newFakeDNSServer(t, nil)
+	r := NewCachingResolver(time.Minute, time.Minute, nil)
+	r.UseServers([]string{server.addr()})
+
+	for range 2 {
+		if _, err := r.LookupHost(context.Background(), "missing.test."); err == nil {
+			t.Fatal("got no error for an unknown host")
+		}
+	}
+	if got := server.queries.Load(); got != 1 {
+		t.Fatalf("sent %d queries, want the failure cached", got)
+	}
+}
+
+func TestCachingResolverServesExpiredOnFailure(t *testing.T) {
+	server := newFakeDNSServer(t, map[string]string{"signoz.test.": "10.0.0.1"})
+	r := NewCachingResolver(time.Minute, time.Minute, nil)
+	r.UseServers([]string{server.addr()})
+	if _, err := r.LookupHost(context.Background(), "signoz.test."); err != nil {
+		t.Fatal(err)
+	}
+
+	r.entries["signoz.test."] = dnsEntry{addrs: []string{"10.0.0.1"}, expires: time.Now().Add(-time.Second)}
+	server.failing.Store(true)
+	addrs, err := r.LookupHost(context.Background(), "signoz.test.")
+	if err != nil || !slices.Equal(addrs, []string{"10.0.0.1"}) {
+		t.Fatalf("got %v, %v, want the expired addresses", addrs, err)
+	}
+	if got := server.queries.Load(); got < 2 {
+		t.Fatalf("sent %d queries, want the expired entry looked up again", got)
+	}
+}
+
+func TestCachingResolverUseServersFallsBack(t *testing.T) {
+	server := newFakeDNSServer(t, map[string]string{"signoz.test.": "10.0.0.1"})
+	r := NewCachingResolver(time.Minute, time.Minute, nil)
+	r.UseServers([]string{"missing-port", server.addr()})
+
+	addrs, err := r.LookupHost(context.Background(), "signoz.test.")
+	if err != nil || !slices.Equal(addrs, []string{"10.0.0.1"}) {
+		t.Fatalf("got %v, %v, want the address from the second server", addrs, err)
+	}
+}
+
+func TestCachingResolverIPv6Literals(t *testing.T) {
+	r := NewCachingResolver(time.Minute, time.Minute, nil)
+	r.UseServers([]string{"missing-port"})
+	for _, host := range []string{"fd00::1", "fe80::1%eth0", "::ffff:10.0.0.1"} {
+		addrs, err := r.LookupHost(context.Background(), host)
+		if err != nil || !slices.Equal(addrs, []string{host}) {
+			t.Errorf("%s: got %v, %v, want the literal", host, addrs, err)
+		}
+	}
+}
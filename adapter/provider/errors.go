@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AuthError is returned when SigNoz rejects the API key.
+type AuthError struct {
+	StatusCode int
+	Body       string
+	// Hint explains the failure for the SigNoz flavor, if known.
+	Hint string
+}
+
+func (e *AuthError) Error() string {
+	return withHint(fmt.Sprintf("signoz rejected the api key: status %d, body: %s", e.StatusCode, e.Body), e.Hint)
+}
+
+// RateLimitedError is returned when SigNoz throttles the adapter.
+type RateLimitedError struct {
+	// RetryAfter is taken from the Retry-After header, zero if absent.
+	RetryAfter time.Duration
+	Body       string
+	Hint       string
+}
+
+func (e *RateLimitedError) Error() string {
+	return withHint(fmt.Sprintf("signoz rate limited the query, retry after %s, body: %s", e.RetryAfter, e.Body), e.Hint)
+}
+
+// QueryInvalidError is returned when SigNoz rejects the query itself, e.g.
+// an unknown metric or a malformed filter expression.
+type QueryInvalidError struct {
+	StatusCode int
+	Body       string
+	Hint       string
+}
+
+func (e *QueryInvalidError) Error() string {
+	return withHint(fmt.Sprintf("signoz rejected the query: status %d, body: %s", e.StatusCode, e.Body), e.Hint)
+}
+
+// UnavailableError is returned when SigNoz cannot be reached or fails with a
+// server error. StatusCode is zero for transport errors.
+type UnavailableError struct {
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("signoz is unavailable: %v", e.Err)
+	}
+	return fmt.Sprintf("signoz is unavailable: status %d, body: %s", e.StatusCode, e.Body)
+}
+
+func (e *UnavailableError) Unwrap() error { return e.Err }
+
+// DecodeError is returned when the SigNoz response cannot be decoded.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode signoz response: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+func withHint(msg, hint string) string {
+	if hint == "" {
+		return msg
+	}
+	return msg + " (" + hint + ")"
+}
+
+// statusError returns the typed error for a non-OK SigNoz response, with a
+// hint for the flavor of the endpoint.
+func statusError(response *http.Response, body string, flavor Flavor) error {
+	hint := flavor.hint(response.StatusCode)
+	switch code := response.StatusCode; {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &AuthError{StatusCode: code, Body: body, Hint: hint}
+	case code == http.StatusTooManyRequests:
+		var retryAfter time.Duration
+		if s, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(s) * time.Second
+		}
+		return &RateLimitedError{RetryAfter: retryAfter, Body: body, Hint: hint}
+	case code == http.StatusRequestTimeout || code >= 500:
+		return &UnavailableError{StatusCode: code, Body: body}
+	default:
+		return &QueryInvalidError{StatusCode: code, Body: body, Hint: hint}
+	}
+}
+
+// errorCategory returns the label value errors are counted under.
+func errorCategory(err error) string {
+	var (
+		auth        *AuthError
+		rateLimited *RateLimitedError
+		invalid     *QueryInvalidError
+		unavailable *UnavailableError
+		decode      *DecodeError
+	)
+	switch {
+	case errors.As(err, &auth):
+		return "auth"
+	case errors.As(err, &rateLimited):
+		return "rate_limited"
+	case errors.As(err, &invalid):
+		return "query_invalid"
+	case errors.As(err, &unavailable):
+		return "unavailable"
+	case errors.As(err, &decode):
+		return "decode"
+	default:
+		return "other"
+	}
+}
+
+// toAPIError maps client errors to Kubernetes API errors, so the HPA status
+// and kubectl show why a metric is missing instead of a generic failure.
+// A rejected API key is reported as unavailable with the Unauthorized
+// reason rather than as 401 or 403, which would blame the caller's
+// credentials instead of the adapter's.
+func toAPIError(err error) error {
+	var (
+		auth        *AuthError
+		rateLimited *RateLimitedError
+		invalid     *QueryInvalidError
+		unavailable *UnavailableError
+		decode      *DecodeError
+		status      apierr.APIStatus
+	)
+	switch {
+	case errors.As(err, &status):
+		return err
+	case errors.As(err, &auth):
+		return &apierr.StatusError{ErrStatus: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusServiceUnavailable,
+			Reason:  metav1.StatusReasonUnauthorized,
+			Message: err.Error(),
+		}}
+	case errors.As(err, &rateLimited):
+		return apierr.NewTooManyRequests(err.Error(), int(rateLimited.RetryAfter.Seconds()))
+	case errors.As(err, &invalid):
+		return apierr.NewBadRequest(err.Error())
+	case errors.As(err, &unavailable):
+		return apierr.NewServiceUnavailable(err.Error())
+	case errors.As(err, &decode):
+		return apierr.NewInternalError(fmt.Errorf("signoz returned a response the adapter cannot read: %w", err))
+	default:
+		return apierr.NewInternalError(err)
+	}
+}
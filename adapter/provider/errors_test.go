@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   int32
+		reason metav1.StatusReason
+	}{
+		{name: "auth", err: &AuthError{StatusCode: http.StatusUnauthorized, Hint: "check the key"}, code: http.StatusServiceUnavailable, reason: metav1.StatusReasonUnauthorized},
+		{name: "rate limited", err: &RateLimitedError{RetryAfter: 5 * time.Second}, code: http.StatusTooManyRequests, reason: metav1.StatusReasonTooManyRequests},
+		{name: "query invalid", err: &QueryInvalidError{StatusCode: http.StatusBadRequest}, code: http.StatusBadRequest, reason: metav1.StatusReasonBadRequest},
+		{name: "unavailable", err: &UnavailableError{StatusCode: http.StatusBadGateway}, code: http.StatusServiceUnavailable, reason: metav1.StatusReasonServiceUnavailable},
+		{name: "decode", err: &DecodeError{Err: errors.New("unexpected EOF")}, code: http.StatusInternalServerError, reason: metav1.StatusReasonInternalError},
+		{name: "api error", err: apierr.NewNotFound(podsResource, "a"), code: http.StatusNotFound, reason: metav1.StatusReasonNotFound},
+		{name: "other", err: errors.New("boom"), code: http.StatusInternalServerError, reason: metav1.StatusReasonInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status apierr.APIStatus
+			if !errors.As(toAPIError(tt.err), &status) {
+				t.Fatalf("got %T, want an API status", toAPIError(tt.err))
+			}
+			got := status.Status()
+			if got.Code != tt.code || got.Reason != tt.reason {
+				t.Fatalf("got %d %s, want %d %s", got.Code, got.Reason, tt.code, tt.reason)
+			}
+		})
+	}
+
+	status := toAPIError(&AuthError{StatusCode: http.StatusForbidden, Hint: "check the key"}).(apierr.APIStatus).Status()
+	if want := (&AuthError{StatusCode: http.StatusForbidden, Hint: "check the key"}).Error(); status.Message != want {
+		t.Fatalf("auth message = %q, want %q", status.Message, want)
+	}
+	if retry := toAPIError(&RateLimitedError{RetryAfter: 5 * time.Second}).(apierr.APIStatus).Status(); retry.Details == nil || retry.Details.RetryAfterSeconds != 5 {
+		t.Fatalf("got details %+v, want retry after 5s", retry.Details)
+	}
+}
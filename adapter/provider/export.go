@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// MappingExporter writes the effective metric to query mapping into a
+// ConfigMap, so it can be compared against what is declared in Git.
+type MappingExporter struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func NewMappingExporter(client kubernetes.Interface, namespace, name string) *MappingExporter {
+	return &MappingExporter{client: client, namespace: namespace, name: name}
+}
+
+// metricMapping is the exported form of a single metric.
+type metricMapping struct {
+	Window         string               `json:"window,omitempty"`
+	CompositeQuery SignozCompositeQuery `json:"compositeQuery"`
+	// Expression is set instead of the query for derived metrics.
+	Expression string `json:"expression,omitempty"`
+	// Synthetic is set instead of the query for synthetic metrics.
+	Synthetic *SyntheticConfig `json:"synthetic,omitempty"`
+}
+
+// Export creates or replaces the ConfigMap with one key per metric.
+func (e *MappingExporter) Export(ctx context.Context, mappings map[string]metricMapping) error {
+	data := make(map[string]string, len(mappings))
+	for name, mapping := range mappings {
+		out, err := json.MarshalIndent(mapping, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal mapping for %s: %w", name, err)
+		}
+		data[name+".json"] = string(out)
+	}
+
+	configMaps := e.client.CoreV1().ConfigMaps(e.namespace)
+	existing, err := configMaps.Get(ctx, e.name, metav1.GetOptions{})
+	if apierr.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: e.name, Namespace: e.namespace},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	existing.Data = data
+	_, err = configMaps.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expr is a parsed arithmetic expression over named values, supporting
+// numbers, identifiers, + - * /, unary minus and parentheses.
+type expr interface {
+	// eval returns the value of the expression, false if a variable is
+	// missing or the result is not a finite number.
+	eval(vars map[string]float64) (float64, bool)
+	// render writes the expression with variables renamed by rename.
+	render(rename func(string) string) string
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(map[string]float64) (float64, bool) { return float64(e), true }
+
+func (e numberExpr) render(func(string) string) string {
+	return strconv.FormatFloat(float64(e), 'g', -1, 64)
+}
+
+type varExpr string
+
+func (e varExpr) eval(vars map[string]float64) (float64, bool) {
+	v, ok := vars[string(e)]
+	return v, ok
+}
+
+func (e varExpr) render(rename func(string) string) string { return rename(string(e)) }
+
+type negExpr struct{ x expr }
+
+func (e negExpr) eval(vars map[string]float64) (float64, bool) {
+	v, ok := e.x.eval(vars)
+	return -v, ok
+}
+
+func (e negExpr) render(rename func(string) string) string { return "-" + e.x.render(rename) }
+
+type binaryExpr struct {
+	op   byte
+	l, r expr
+}
+
+func (e binaryExpr) eval(vars map[string]float64) (float64, bool) {
+	l, ok := e.l.eval(vars)
+	if !ok {
+		return 0, false
+	}
+	r, ok := e.r.eval(vars)
+	if !ok {
+		return 0, false
+	}
+	var v float64
+	switch e.op {
+	case '+':
+		v = l + r
+	case '-':
+		v = l - r
+	case '*':
+		v = l * r
+	case '/':
+		v = l / r
+	}
+	return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func (e binaryExpr) render(rename func(string) string) string {
+	return "(" + e.l.render(rename) + " " + string(e.op) + " " + e.r.render(rename) + ")"
+}
+
+// exprVars returns the variables referenced by e, in order of appearance.
+func exprVars(e expr) []string {
+	var vars []string
+	seen := map[string]bool{}
+	e.render(func(name string) string {
+		if !seen[name] {
+			seen[name] = true
+			vars = append(vars, name)
+		}
+		return name
+	})
+	return vars
+}
+
+// parseExpr parses an arithmetic expression. Identifiers may contain
+// letters, digits, '_' and '.', so metric names can be referenced directly.
+func parseExpr(s string) (expr, error) {
+	p := &exprParser{input: s}
+	p.next()
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.tok, p.tokPos)
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	input  string
+	pos    int
+	tok    string
+	tokPos int
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+// next advances to the next token; tok is empty at the end of the input.
+func (p *exprParser) next() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	p.tokPos = p.pos
+	if p.pos >= len(p.input) {
+		p.tok = ""
+		return
+	}
+	if strings.ContainsRune("+-*/()", rune(p.input[p.pos])) {
+		p.tok = p.input[p.pos : p.pos+1]
+		p.pos++
+		return
+	}
+	end := p.pos
+	for end < len(p.input) && isIdentRune(rune(p.input[end])) {
+		end++
+	}
+	if end == p.pos {
+		end++
+	}
+	p.tok = p.input[p.pos:end]
+	p.pos = end
+}
+
+func (p *exprParser) parseSum() (expr, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok[0]
+		p.next()
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseProduct() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op := p.tok[0]
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.tok == "-" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	tok, pos := p.tok, p.tokPos
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		p.next()
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing ) at offset %d", p.tokPos)
+		}
+		p.next()
+		return e, nil
+	case unicode.IsDigit(rune(tok[0])):
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", tok, pos)
+		}
+		p.next()
+		return numberExpr(v), nil
+	case isIdentRune(rune(tok[0])):
+		p.next()
+		return varExpr(tok), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", tok, pos)
+	}
+}
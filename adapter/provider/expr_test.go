@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestParseExprEval(t *testing.T) {
+	vars := map[string]float64{"a": 6, "b": 3, "zero": 0, "service.requests": 10}
+
+	tests := []struct {
+		expr  string
+		value float64
+		ok    bool
+	}{
+		{expr: "1 + 2 * 3", value: 7, ok: true},
+		{expr: "(1 + 2) * 3", value: 9, ok: true},
+		{expr: "a - b - 1", value: 2, ok: true},
+		{expr: "a / b / 2", value: 1, ok: true},
+		{expr: "-a + b", value: -3, ok: true},
+		{expr: "--a", value: 6, ok: true},
+		{expr: "a * -b", value: -18, ok: true},
+		{expr: "service.requests / a * b", value: 5, ok: true},
+		{expr: "0.5 * a", value: 3, ok: true},
+		{expr: "a / zero", ok: false},
+		{expr: "zero / zero", ok: false},
+		{expr: "a + missing", ok: false},
+		{expr: "missing / zero", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := parseExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, ok := e.eval(vars)
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+			if ok && value != tt.value {
+				t.Errorf("got %v, want %v", value, tt.value)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, s := range []string{"", "a +", "(a + b", "a b", "a + )", "1.2.3", "a % b", "*a"} {
+		t.Run(s, func(t *testing.T) {
+			if _, err := parseExpr(s); err == nil {
+				t.Errorf("parsing %q succeeded, want an error", s)
+			}
+		})
+	}
+}
+
+func TestExprVars(t *testing.T) {
+	e, err := parseExpr("(a + b) / a - 2 * c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := exprVars(e)
+	want := []string{"a", "b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
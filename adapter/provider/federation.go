@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// Querier runs SigNoz query_range requests.
+type Querier interface {
+	Query(ctx context.Context, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error)
+}
+
+var _ Querier = &SignozClient{}
+var _ Querier = &FederatedClient{}
+
+// FederatedClient sends every query to several SigNoz endpoints and merges
+// the series they return. If some endpoints fail, the result either fails or
+// contains what succeeded, depending on the partial-response policy.
+type FederatedClient struct {
+	clients      []*SignozClient
+	allowPartial bool
+}
+
+func NewFederatedClient(clients []*SignozClient, allowPartial bool) *FederatedClient {
+	return &FederatedClient{clients: clients, allowPartial: allowPartial}
+}
+
+func (f *FederatedClient) Query(ctx context.Context, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error) {
+	responses := make([]*SignozQueryRangeResponse, len(f.clients))
+	errs := make([]error, len(f.clients))
+
+	var wg sync.WaitGroup
+	for i, client := range f.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = client.Query(ctx, query)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", client.Endpoint, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	var merged *SignozQueryRangeResponse
+	var failed []error
+	for i, resp := range responses {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		if merged == nil {
+			merged = resp
+			continue
+		}
+		merged.Data.Data.Results = append(merged.Data.Data.Results, resp.Data.Data.Results...)
+	}
+
+	if len(failed) > 0 {
+		if merged == nil || !f.allowPartial {
+			return nil, errors.Join(failed...)
+		}
+		partialResponses.Inc()
+		klog.Warningf("partial response from %d of %d signoz endpoints: %v", len(f.clients)-len(failed), len(f.clients), errors.Join(failed...))
+	}
+	return merged, nil
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// labelFilterOperators lists the supported operators, longest first so that
+// `=~` is not mistaken for `=`.
+var labelFilterOperators = []string{"=~", "!~", "!=", "="}
+
+// LabelFilter restricts a query to series whose label matches a value.
+// It is written as `key=value`, `key!=value`, `key=~regex` or `key!~regex`.
+// Equality filters accept several values separated by `|`, e.g.
+// `service.name=checkout|cart`. Regexes must match the whole value, as in
+// Prometheus.
+type LabelFilter struct {
+	Key      string
+	Operator string
+	Value    string
+}
+
+// ParseLabelFilter parses a single `key<op>value` filter.
+func ParseLabelFilter(s string) (LabelFilter, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return LabelFilter{}, fmt.Errorf("invalid label filter %q: expected key<op>value", s)
+	}
+
+	for _, op := range labelFilterOperators {
+		if !strings.HasPrefix(s[i:], op) {
+			continue
+		}
+
+		f := LabelFilter{
+			Key:      strings.TrimSpace(s[:i]),
+			Operator: op,
+			Value:    strings.TrimSpace(s[i+len(op):]),
+		}
+		if f.Operator == "=~" || f.Operator == "!~" {
+			if _, err := regexp.Compile(f.Value); err != nil {
+				return LabelFilter{}, fmt.Errorf("invalid regex in label filter %q: %w", s, err)
+			}
+		}
+		return f, nil
+	}
+
+	return LabelFilter{}, fmt.Errorf("invalid label filter %q: unsupported operator", s)
+}
+
+// ParseLabelFilters parses a comma-separated list of label filters.
+func ParseLabelFilters(s string) ([]LabelFilter, error) {
+	var filters []LabelFilter
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		f, err := ParseLabelFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+func (f LabelFilter) String() string {
+	return f.Key + f.Operator + f.Value
+}
+
+func (f *LabelFilter) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseLabelFilter(s)
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+func (f LabelFilter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+// Values returns the alternatives of an equality filter.
+func (f LabelFilter) Values() []string {
+	return strings.Split(f.Value, "|")
+}
+
+// Expression returns the SigNoz filter expression for the filter. Regexes
+// are anchored, as REGEXP matches anywhere in the value.
+func (f LabelFilter) Expression() string {
+	values := f.Values()
+	switch f.Operator {
+	case "=~":
+		return fmt.Sprintf("%s REGEXP %s", f.Key, quoteFilterValue("^(?:"+f.Value+")$"))
+	case "!~":
+		return fmt.Sprintf("%s NOT REGEXP %s", f.Key, quoteFilterValue("^(?:"+f.Value+")$"))
+	case "!=":
+		if len(values) > 1 {
+			return fmt.Sprintf("%s NOT IN %s", f.Key, quoteFilterValues(values))
+		}
+		return fmt.Sprintf("%s != %s", f.Key, quoteFilterValue(f.Value))
+	default:
+		if len(values) > 1 {
+			return fmt.Sprintf("%s IN %s", f.Key, quoteFilterValues(values))
+		}
+		return fmt.Sprintf("%s = %s", f.Key, quoteFilterValue(f.Value))
+	}
+}
+
+// labelFiltersExpression joins the filters into a single SigNoz filter
+// expression.
+func labelFiltersExpression(filters []LabelFilter) string {
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = f.Expression()
+	}
+	return strings.Join(parts, " AND ")
+}
@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestParseLabelFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   LabelFilter
+		err    bool
+	}{
+		{filter: "service.name=checkout", want: LabelFilter{Key: "service.name", Operator: "=", Value: "checkout"}},
+		{filter: " env = prod ", want: LabelFilter{Key: "env", Operator: "=", Value: "prod"}},
+		{filter: "service.name=~check.*", want: LabelFilter{Key: "service.name", Operator: "=~", Value: "check.*"}},
+		{filter: "env!=dev", want: LabelFilter{Key: "env", Operator: "!=", Value: "dev"}},
+		{filter: "service.name!~test-.*", want: LabelFilter{Key: "service.name", Operator: "!~", Value: "test-.*"}},
+		{filter: "service.name=checkout|cart", want: LabelFilter{Key: "service.name", Operator: "=", Value: "checkout|cart"}},
+		{filter: "url=a=b", want: LabelFilter{Key: "url", Operator: "=", Value: "a=b"}},
+		{filter: "service.name=~(", err: true},
+		{filter: "service.name!~(", err: true},
+		{filter: "=checkout", err: true},
+		{filter: "checkout", err: true},
+		{filter: "env!prod", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			got, err := ParseLabelFilter(tt.filter)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelFilterExpression(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{filter: "env=prod", want: "env = 'prod'"},
+		{filter: "service.name=~check.*", want: "service.name REGEXP '^(?:check.*)$'"},
+		{filter: "service.name=~a|b", want: "service.name REGEXP '^(?:a|b)$'"},
+		{filter: "env!=dev", want: "env != 'dev'"},
+		{filter: "service.name=checkout|cart", want: "service.name IN ('checkout', 'cart')"},
+		{filter: "env!=dev|test", want: "env NOT IN ('dev', 'test')"},
+		{filter: "env=prod|", want: "env IN ('prod', '')"},
+		{filter: "service.name!~test-.*", want: "service.name NOT REGEXP '^(?:test-.*)$'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := ParseLabelFilter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Expression(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelFilterValues(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{filter: "env=prod", want: []string{"prod"}},
+		{filter: "service.name=checkout|cart|ads", want: []string{"checkout", "cart", "ads"}},
+	}
+	for _, tt := range tests {
+		f, err := ParseLabelFilter(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Values(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseLabelFilters(t *testing.T) {
+	filters, err := ParseLabelFilters("env=prod, service.name=~check.*,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := labelFiltersExpression(filters), "env = 'prod' AND service.name REGEXP '^(?:check.*)$'"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if _, err := ParseLabelFilters("env=prod,bad"); err == nil {
+		t.Fatal("got no error for an invalid filter")
+	}
+}
+
+func TestLabelFilterJSON(t *testing.T) {
+	var filters []LabelFilter
+	if err := json.Unmarshal([]byte(`["env=prod","service.name=~check.*"]`), &filters); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `["env=prod","service.name=~check.*"]`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if err := json.Unmarshal([]byte(`["env"]`), &filters); err == nil {
+		t.Fatal("got no error for an invalid filter")
+	}
+}
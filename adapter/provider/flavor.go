@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Flavor is the kind of SigNoz deployment an endpoint points at. The
+// flavors differ in how API keys are issued, in rate limits and in the API
+// versions they serve, which decides the hints attached to errors.
+type Flavor string
+
+const (
+	FlavorAuto       Flavor = "auto"
+	FlavorCloud      Flavor = "cloud"
+	FlavorSelfHosted Flavor = "self-hosted"
+)
+
+// cloudDomain is the domain SigNoz Cloud workspaces are served under.
+const cloudDomain = "signoz.cloud"
+
+// ResolveFlavor returns the flavor of endpoint. FlavorAuto detects SigNoz
+// Cloud by its domain and assumes self-hosted otherwise.
+func ResolveFlavor(flavor Flavor, endpoint string) Flavor {
+	if flavor != FlavorAuto && flavor != "" {
+		return flavor
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return FlavorSelfHosted
+	}
+	host := u.Hostname()
+	if host == cloudDomain || strings.HasSuffix(host, "."+cloudDomain) {
+		return FlavorCloud
+	}
+	return FlavorSelfHosted
+}
+
+// hint explains a failed request with the given status code in terms of the
+// flavor, or returns "" if there is nothing to add.
+func (f Flavor) hint(statusCode int) string {
+	switch {
+	case f == FlavorCloud && (statusCode == 401 || statusCode == 403):
+		return "SigNoz Cloud expects an API key from Settings > API Keys, ingestion keys are not accepted"
+	case f == FlavorCloud && statusCode == 404:
+		return "the endpoint must be the workspace URL, e.g. https://<workspace>.<region>.signoz.cloud"
+	case f == FlavorCloud && statusCode == 429:
+		return "SigNoz Cloud limits the query rate per workspace, consider --signoz-poll-interval to query each metric once per interval"
+	case f == FlavorSelfHosted && (statusCode == 401 || statusCode == 403):
+		return "check that the API key exists in Settings > API Keys and has not expired"
+	case f == FlavorSelfHosted && statusCode == 404:
+		return "the endpoint does not serve the v5 query API, upgrade SigNoz or set --signoz-api-path if it is behind a gateway"
+	default:
+		return ""
+	}
+}
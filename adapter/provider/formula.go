@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Formula evaluation modes.
+const (
+	FormulaEvaluationServer = "server"
+	FormulaEvaluationClient = "client"
+)
+
+// formulaQueryName is the name of the builder_formula query in server mode.
+const formulaQueryName = "F1"
+
+// maxFormulaQueries is the number of queries a formula can refer to, one
+// per builder query name from A to Z.
+const maxFormulaQueries = 26
+
+var formulaQueryNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FormulaConfig defines a metric computed from several SigNoz metrics, e.g.
+// utilization as active / total.
+type FormulaConfig struct {
+	// Expression combines the queries by name with + - * / and parentheses.
+	Expression string `json:"expression"`
+	// Queries name the SigNoz metrics the expression refers to. They are
+	// queried with the filters, grouping and aggregation of the metric.
+	Queries []FormulaQuery `json:"queries"`
+	// Evaluation is server, to evaluate the expression in SigNoz with a
+	// formula query, or client, to join the series of the queries on their
+	// labels in the adapter. Defaults to server.
+	Evaluation string `json:"evaluation,omitempty"`
+
+	expr expr
+}
+
+// FormulaQuery is a SigNoz metric referenced by a formula.
+type FormulaQuery struct {
+	Name   string `json:"name"`
+	Metric string `json:"metric"`
+}
+
+func (f *FormulaConfig) evaluation() string {
+	if f.Evaluation == "" {
+		return FormulaEvaluationServer
+	}
+	return f.Evaluation
+}
+
+// compile parses the expression and checks that it only refers to the
+// defined queries.
+func (f *FormulaConfig) compile() error {
+	switch f.evaluation() {
+	case FormulaEvaluationServer, FormulaEvaluationClient:
+	default:
+		return fmt.Errorf("evaluation must be server or client, got %q", f.Evaluation)
+	}
+	if len(f.Queries) == 0 {
+		return fmt.Errorf("queries are required")
+	}
+	if len(f.Queries) > maxFormulaQueries {
+		return fmt.Errorf("at most %d queries are supported, got %d", maxFormulaQueries, len(f.Queries))
+	}
+	names := map[string]bool{}
+	for i, q := range f.Queries {
+		if !formulaQueryNameRe.MatchString(q.Name) {
+			return fmt.Errorf("queries[%d]: invalid name %q", i, q.Name)
+		}
+		if names[q.Name] {
+			return fmt.Errorf("queries[%d]: duplicate name %q", i, q.Name)
+		}
+		if q.Metric == "" {
+			return fmt.Errorf("queries[%d]: metric is required", i)
+		}
+		names[q.Name] = true
+	}
+
+	e, err := parseExpr(f.Expression)
+	if err != nil {
+		return fmt.Errorf("expression: %w", err)
+	}
+	for _, name := range exprVars(e) {
+		if !names[name] {
+			return fmt.Errorf("expression: unknown query %q", name)
+		}
+	}
+	f.expr = e
+	return nil
+}
+
+// builderName returns the name of the builder query of the i-th formula
+// query. SigNoz names queries A, B, C and so on.
+func builderName(i int) string {
+	return string(rune('A' + i))
+}
+
+// formulaQueries expands base, the builder query of the metric, into one
+// query per formula query, plus the formula itself in server mode.
+func (f *FormulaConfig) formulaQueries(base SignozQuery) []SignozQuery {
+	server := f.evaluation() == FormulaEvaluationServer
+	rename := map[string]string{}
+
+	var queries []SignozQuery
+	for i, q := range f.Queries {
+		query := base
+		query.Spec.Name = builderName(i)
+		query.Spec.Aggregations = slices.Clone(base.Spec.Aggregations)
+		query.Spec.Aggregations[0].MetricName = q.Metric
+		if server {
+			disabled := true
+			query.Spec.Disabled = &disabled
+		}
+		rename[q.Name] = query.Spec.Name
+		queries = append(queries, query)
+	}
+
+	if server {
+		queries = append(queries, SignozQuery{
+			Type: "builder_formula",
+			Spec: SignozQuerySpec{
+				Name:       formulaQueryName,
+				Expression: f.expr.render(func(name string) string { return rename[name] }),
+			},
+		})
+	}
+	return queries
+}
+
+// formulaSeries returns the series of the formula from the response: those
+// of the formula query reduced by serverReduce in server mode, or the
+// expression evaluated over the series of all queries reduced by reduce and
+// joined on equal labels in client mode. Label sets missing from any query
+// are left out.
+func (f *FormulaConfig) formulaSeries(resp *SignozQueryRangeResponse, reduce, serverReduce func([]SignozSeriesValue) (float64, bool)) []seriesValue {
+	if f.evaluation() == FormulaEvaluationServer {
+		return resp.querySeries(formulaQueryName, serverReduce)
+	}
+
+	type joined struct {
+		labels map[string]string
+		vars   map[string]float64
+	}
+	var keys []string
+	byKey := map[string]*joined{}
+	for i, q := range f.Queries {
+		for _, s := range resp.querySeries(builderName(i), reduce) {
+			key := labels.Set(s.Labels).String()
+			j, ok := byKey[key]
+			if !ok {
+				j = &joined{labels: s.Labels, vars: map[string]float64{}}
+				byKey[key] = j
+				keys = append(keys, key)
+			}
+			j.vars[q.Name] = s.Value
+		}
+	}
+
+	var series []seriesValue
+	for _, key := range keys {
+		j := byKey[key]
+		if value, ok := f.expr.eval(j.vars); ok {
+			series = append(series, seriesValue{Labels: j.labels, Value: value})
+		}
+	}
+	return series
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormulaCompile(t *testing.T) {
+	queries := func(n int) []FormulaQuery {
+		q := make([]FormulaQuery, n)
+		for i := range q {
+			q[i] = FormulaQuery{Name: fmt.Sprintf("q%d", i), Metric: "m"}
+		}
+		return q
+	}
+
+	tests := []struct {
+		name    string
+		formula FormulaConfig
+		err     string
+	}{
+		{name: "valid", formula: FormulaConfig{Expression: "q0 / q1", Queries: queries(2)}},
+		{name: "max queries", formula: FormulaConfig{Expression: "q0 + q25", Queries: queries(maxFormulaQueries)}},
+		{name: "too many queries", formula: FormulaConfig{Expression: "q0", Queries: queries(maxFormulaQueries + 1)}, err: "at most 26 queries"},
+		{name: "no queries", formula: FormulaConfig{Expression: "1"}, err: "queries are required"},
+		{name: "unknown query", formula: FormulaConfig{Expression: "q0 / q9", Queries: queries(2)}, err: `unknown query "q9"`},
+		{name: "duplicate name", formula: FormulaConfig{Expression: "q0", Queries: []FormulaQuery{{Name: "q0", Metric: "a"}, {Name: "q0", Metric: "b"}}}, err: "duplicate name"},
+		{name: "invalid evaluation", formula: FormulaConfig{Expression: "q0", Queries: queries(1), Evaluation: "both"}, err: "evaluation must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.formula.compile()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestBuilderName(t *testing.T) {
+	for i := range maxFormulaQueries {
+		name := builderName(i)
+		if len(name) != 1 || name[0] < 'A' || name[0] > 'Z' {
+			t.Errorf("builderName(%d) = %q, want a letter", i, name)
+		}
+	}
+}
+
+func TestFormulaSeriesServerTimeAggregation(t *testing.T) {
+	var resp SignozQueryRangeResponse
+	resp.Data.Data.Results = []SignozQueryResult{{
+		QueryName: formulaQueryName,
+		Aggregations: []SignozResultAggregation{{Series: []SignozResultSeries{{
+			Values: []SignozSeriesValue{{Timestamp: 1, Value: 2}, {Timestamp: 2, Value: 8}, {Timestamp: 3, Value: 5}},
+		}}}},
+	}}
+
+	tests := []struct {
+		timeAggregation string
+		want            float64
+	}{
+		{timeAggregation: "", want: 5},
+		{timeAggregation: TimeAggregationMax, want: 8},
+		{timeAggregation: TimeAggregationAvg, want: 5},
+		{timeAggregation: TimeAggregationMin, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timeAggregation, func(t *testing.T) {
+			metric := MetricConfig{
+				TimeAggregation: tt.timeAggregation,
+				Formula:         &FormulaConfig{Expression: "a / b", Queries: []FormulaQuery{{Name: "a", Metric: "x"}, {Name: "b", Metric: "y"}}},
+			}
+			series := metric.Formula.formulaSeries(&resp, metric.reduce(), metric.formulaReduce())
+			if len(series) != 1 || series[0].Value != tt.want {
+				t.Fatalf("got %+v, want one series with value %v", series, tt.want)
+			}
+		})
+	}
+}
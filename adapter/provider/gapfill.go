@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+)
+
+// Gap-fill policies.
+const (
+	GapFillNotFound = "notFound"
+	GapFillFallback = "fallback"
+	GapFillWiden    = "widen"
+)
+
+// GapFillConfig decides what is served when the query window of a metric
+// contains no datapoints at all, e.g. for a sparse metric or an exporter that
+// was down.
+type GapFillConfig struct {
+	// Policy is notFound, to fail the request with NotFound, fallback, to
+	// serve FallbackValue, or widen, to query once more with the window
+	// widened to MaxWindowSeconds and fail with NotFound if that is empty
+	// too. Defaults to notFound.
+	Policy string `json:"policy,omitempty"`
+	// FallbackValue is served for every object by the fallback policy.
+	FallbackValue *float64 `json:"fallbackValue,omitempty"`
+	// MaxWindowSeconds is the window the widen policy queries with.
+	MaxWindowSeconds int64 `json:"maxWindowSeconds,omitempty"`
+}
+
+func (g *GapFillConfig) validate() error {
+	switch g.Policy {
+	case "", GapFillNotFound:
+	case GapFillFallback:
+		if g.FallbackValue == nil {
+			return fmt.Errorf("fallbackValue is required by the fallback policy")
+		}
+	case GapFillWiden:
+		if g.MaxWindowSeconds <= 0 {
+			return fmt.Errorf("maxWindowSeconds must be positive for the widen policy")
+		}
+	default:
+		return fmt.Errorf("policy must be notFound, fallback or widen, got %q", g.Policy)
+	}
+	return nil
+}
+
+// fallback returns the value to serve for a metric without datapoints, or
+// false if the request should fail with NotFound.
+func (m *MetricConfig) fallback() (float64, bool) {
+	if m.GapFill == nil || m.GapFill.Policy != GapFillFallback {
+		return 0, false
+	}
+	return *m.GapFill.FallbackValue, true
+}
+
+// widened returns a copy of the metric querying the maximum window of the
+// widen policy, or nil if the metric is not widened beyond window.
+func (m *MetricConfig) widened(window time.Duration) *MetricConfig {
+	if m.GapFill == nil || m.GapFill.Policy != GapFillWiden {
+		return nil
+	}
+	if time.Duration(m.GapFill.MaxWindowSeconds)*time.Second <= window {
+		return nil
+	}
+	wider := *m
+	wider.WindowSeconds = m.GapFill.MaxWindowSeconds
+	wider.GapFill = nil
+	return &wider
+}
@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// MetricHealth is the observed health of a single metric.
+type MetricHealth struct {
+	LastQueryTime   time.Time `json:"lastQueryTime,omitempty"`
+	LastSuccessTime time.Time `json:"lastSuccessTime,omitempty"`
+	LastError       string    `json:"lastError,omitempty"`
+	SeriesCount     int       `json:"seriesCount"`
+	// MatchedObjects and CoveredObjects are the number of objects matched
+	// by the last list request and how many of them had a series.
+	MatchedObjects int    `json:"matchedObjects"`
+	CoveredObjects int    `json:"coveredObjects"`
+	EffectiveQuery string `json:"effectiveQuery,omitempty"`
+	// Unit is the unit SigNoz reported for the metric.
+	Unit string `json:"unit,omitempty"`
+	// StaleAge is the age of the last-known-good response served by the
+	// last query, empty if it was answered by SigNoz.
+	StaleAge string `json:"staleAge,omitempty"`
+}
+
+// healthTracker records the outcome of the queries issued for each metric.
+type healthTracker struct {
+	mu      sync.RWMutex
+	metrics map[string]*MetricHealth
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{metrics: map[string]*MetricHealth{}}
+}
+
+// record stores the outcome of a query, exports it as the metric_* gauges
+// and logs when a metric starts or stops failing.
+func (h *healthTracker) record(name string, query SignozQueryRangeOptions, seriesCount int, err error) {
+	effective, _ := json.Marshal(query.CompositeQuery)
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	health, ok := h.metrics[name]
+	if !ok {
+		health = &MetricHealth{}
+		h.metrics[name] = health
+	}
+	wasFailing := health.LastError != ""
+
+	health.LastQueryTime = now
+	health.EffectiveQuery = string(effective)
+	if err != nil {
+		health.LastError = err.Error()
+		metricHealthy.WithLabelValues(name).Set(0)
+		if !wasFailing {
+			klog.Warningf("metric %s became unhealthy: %v", name, err)
+		}
+		return
+	}
+
+	health.LastSuccessTime = now
+	health.LastError = ""
+	health.StaleAge = ""
+	health.SeriesCount = seriesCount
+	metricHealthy.WithLabelValues(name).Set(1)
+	metricSeries.WithLabelValues(name).Set(float64(seriesCount))
+	metricLastSuccess.WithLabelValues(name).Set(float64(now.Unix()))
+	if wasFailing {
+		klog.Infof("metric %s recovered, %d series", name, seriesCount)
+	}
+}
+
+// recordStale stores that the last query was answered with a response of
+// the given age because SigNoz failed with err.
+func (h *healthTracker) recordStale(name string, age time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	health, ok := h.metrics[name]
+	if !ok {
+		health = &MetricHealth{}
+		h.metrics[name] = health
+	}
+	if health.StaleAge == "" {
+		klog.Warningf("serving stale values of metric %s: %v", name, err)
+	}
+	health.LastQueryTime = time.Now()
+	health.LastError = err.Error()
+	metricHealthy.WithLabelValues(name).Set(0)
+	health.StaleAge = age.Round(time.Second).String()
+}
+
+// recordCoverage stores how many of the objects matched by a list request
+// had a series.
+func (h *healthTracker) recordCoverage(name string, matched, covered int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	health, ok := h.metrics[name]
+	if !ok {
+		health = &MetricHealth{}
+		h.metrics[name] = health
+	}
+	health.MatchedObjects = matched
+	health.CoveredObjects = covered
+}
+
+// recordUnit stores the unit SigNoz reported for the metric.
+func (h *healthTracker) recordUnit(name, unit string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	health, ok := h.metrics[name]
+	if !ok {
+		health = &MetricHealth{}
+		h.metrics[name] = health
+	}
+	health.Unit = unit
+}
+
+// forget drops the health of a metric that is no longer served and stops
+// exporting its series.
+func (h *healthTracker) forget(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.metrics, name)
+	metricHealthy.DeleteLabelValues(name)
+	metricSeries.DeleteLabelValues(name)
+	metricLastSuccess.DeleteLabelValues(name)
+	labels := map[string]string{"metric": name}
+	staleResponses.Delete(labels)
+	staleValues.Delete(labels)
+	queryCacheHits.Delete(labels)
+	queryCacheMisses.Delete(labels)
+	coalescedQueries.Delete(labels)
+	shadowDivergence.Delete(labels)
+	for _, result := range []string{shadowMatch, shadowDiverged, shadowMissing, shadowError} {
+		shadowComparisons.Delete(map[string]string{"metric": name, "result": result})
+	}
+}
+
+// get returns a copy of the health of the metric.
+func (h *healthTracker) get(name string) MetricHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if health, ok := h.metrics[name]; ok {
+		return *health
+	}
+	return MetricHealth{}
+}
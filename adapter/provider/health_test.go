@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestHealthTrackerForget(t *testing.T) {
+	registry := testutil.NewFakeKubeRegistry("1.35.0")
+	registry.MustRegister(metricHealthy, metricSeries)
+
+	h := newHealthTracker()
+	h.record("removed", SignozQueryRangeOptions{}, 3, nil)
+	h.record("kept", SignozQueryRangeOptions{}, 2, nil)
+	h.forget("removed")
+
+	if health := h.get("removed"); !health.LastQueryTime.IsZero() {
+		t.Fatalf("health of the forgotten metric kept: %+v", health)
+	}
+	expected := `
+# HELP signoz_adapter_metric_healthy [ALPHA] Whether the last query of each metric succeeded: 1 healthy, 0 failing
+# TYPE signoz_adapter_metric_healthy gauge
+signoz_adapter_metric_healthy{metric="kept"} 1
+# HELP signoz_adapter_metric_series [ALPHA] Number of series returned by the last successful query of each metric
+# TYPE signoz_adapter_metric_series gauge
+signoz_adapter_metric_series{metric="kept"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "signoz_adapter_metric_healthy", "signoz_adapter_metric_series"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,40 @@
+package provider
+
+import "strings"
+
+// labelKeyVariants returns the key followed by its dot/underscore counterpart.
+// OTel exporters disagree on whether attribute keys like `k8s.pod.name` are
+// sanitized to `k8s_pod_name`, so both spellings are tried when matching.
+func labelKeyVariants(key string) []string {
+	var alt string
+	if strings.Contains(key, ".") {
+		alt = strings.ReplaceAll(key, ".", "_")
+	} else {
+		alt = strings.ReplaceAll(key, "_", ".")
+	}
+	if alt == key {
+		return []string{key}
+	}
+	return []string{key, alt}
+}
+
+// lookupObject returns the value of the first of keys, in priority order,
+// that is set on the labels.
+func lookupObject(labels map[string]string, keys []string) (string, bool) {
+	for _, key := range keys {
+		if v, ok := lookupLabel(labels, key); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// lookupLabel returns the first non-empty value for any variant of key.
+func lookupLabel(labels map[string]string, key string) (string, bool) {
+	for _, k := range labelKeyVariants(key) {
+		if v := labels[k]; v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
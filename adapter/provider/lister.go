@@ -0,0 +1,332 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/brainpodnl/signoz-metrics-adapter/pkg/provider"
+	"github.com/brainpodnl/signoz-metrics-adapter/pkg/provider/helpers"
+)
+
+var podsResource = schema.GroupResource{Resource: "pods"}
+
+// PodFilter selects the pods that metrics are served for, on top of the
+// label selector of the request.
+type PodFilter struct {
+	// RequireRunning leaves out pods that are not in the Running phase, so
+	// values of pods that recently completed or were evicted, and still
+	// linger in the query window, do not skew averages.
+	RequireRunning bool
+	// ExcludeUnready leaves out pods that are terminating or not Ready,
+	// matching how the HPA controller discounts unready pods.
+	ExcludeUnready bool
+}
+
+// matches reports whether the pod passes the filter.
+func (f PodFilter) matches(pod runtime.Object) bool {
+	u, ok := pod.(*unstructured.Unstructured)
+	if !ok {
+		return true
+	}
+	if f.RequireRunning {
+		phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+		if phase != "Running" {
+			return false
+		}
+	}
+	if f.ExcludeUnready && (u.GetDeletionTimestamp() != nil || !podReady(u)) {
+		return false
+	}
+	return true
+}
+
+// podReady reports whether the Ready condition of the pod is True.
+func podReady(pod *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(pod.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if ok && condition["type"] == "Ready" {
+			return condition["status"] == "True"
+		}
+	}
+	return false
+}
+
+// informerSyncTimeout bounds how long an informer may take to sync. After
+// it, requests for the resource fail right away until the informer syncs,
+// instead of each waiting for its own timeout, e.g. while the adapter may not
+// list the resource.
+const informerSyncTimeout = 30 * time.Second
+
+// objectLister answers object lookups from shared informers instead of
+// issuing a LIST against the apiserver for every request. The informers of
+// the resources of the configured metrics are started in the background, and
+// requests for other resources are rejected, as informers are never
+// stopped. Each is shared by all later requests, so apiserver load does not
+// grow with the number of HPAs. Objects are looked up by their namespace/name key and
+// listed through the namespace index of the informer, both of which
+// resyncs update in place.
+type objectLister struct {
+	mapper  apimeta.RESTMapper
+	factory dynamicinformer.DynamicSharedInformerFactory
+	pods    PodFilter
+
+	mu        sync.Mutex
+	informers map[schema.GroupVersionResource]*listerInformer
+	// resources are the group-resources objects may be listed for.
+	resources map[schema.GroupResource]bool
+}
+
+// listerInformer is an informer of the lister and the state of its sync.
+type listerInformer struct {
+	informers.GenericInformer
+	// deadline is when the informer should have synced.
+	deadline time.Time
+
+	mu sync.Mutex
+	// err is the last error listing or watching the resource.
+	err error
+}
+
+func newObjectLister(client dynamic.Interface, mapper apimeta.RESTMapper, resync time.Duration, pods PodFilter) *objectLister {
+	return &objectLister{
+		mapper:    mapper,
+		factory:   dynamicinformer.NewDynamicSharedInformerFactory(client, resync),
+		pods:      pods,
+		informers: map[schema.GroupVersionResource]*listerInformer{},
+		resources: map[schema.GroupResource]bool{podsResource: true},
+	}
+}
+
+// allow sets the resources objects may be listed for to those of the
+// metrics, in addition to pods. Informers of resources no longer allowed
+// keep running, but are no longer used.
+func (l *objectLister) allow(resources []schema.GroupResource) {
+	allowed := map[schema.GroupResource]bool{podsResource: true}
+	for _, gr := range resources {
+		allowed[gr] = true
+	}
+	l.mu.Lock()
+	l.resources = allowed
+	l.mu.Unlock()
+}
+
+// allowed reports whether objects may be listed for the resource.
+func (l *objectLister) allowed(gr schema.GroupResource) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.resources[gr]
+}
+
+// start starts the informers of the resources and, in the background, waits
+// for those it started to sync, logging the ones that did not sync in time.
+// The metrics' resources are resolved by the mapper; unknown ones are left to
+// requests.
+func (l *objectLister) start(resources []schema.GroupResource) {
+	var started []schema.GroupVersionResource
+	for _, gr := range resources {
+		gvr, err := l.mapper.ResourceFor(gr.WithVersion(""))
+		if err != nil {
+			klog.V(2).Infof("not starting informer for %s: %v", gr, err)
+			continue
+		}
+		if _, created := l.informer(gvr); created {
+			started = append(started, gvr)
+		}
+	}
+	for _, gvr := range started {
+		go func() {
+			if _, err := l.informerForResource(context.Background(), gvr); err != nil {
+				klog.Errorf("%v", err)
+			}
+		}()
+	}
+}
+
+// informer returns the informer of the resource, starting it if it is not
+// running yet.
+func (l *objectLister) informer(gvr schema.GroupVersionResource) (*listerInformer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if informer, ok := l.informers[gvr]; ok {
+		return informer, false
+	}
+
+	informer := &listerInformer{GenericInformer: l.factory.ForResource(gvr), deadline: time.Now().Add(informerSyncTimeout)}
+	_ = informer.Informer().SetWatchErrorHandlerWithContext(func(ctx context.Context, r *cache.Reflector, err error) {
+		informer.mu.Lock()
+		informer.err = err
+		informer.mu.Unlock()
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+	})
+	l.informers[gvr] = informer
+	// Start is a no-op for informers that are already running.
+	l.factory.Start(wait.NeverStop)
+	return informer, true
+}
+
+// synced returns an error while an informer has neither synced nor reached
+// its sync deadline. Informers past their deadline do not count, as requests
+// for their resource fail right away instead of waiting for them.
+func (l *objectLister) synced() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var pending []string
+	for gvr, informer := range l.informers {
+		if !informer.Informer().HasSynced() && time.Now().Before(informer.deadline) {
+			pending = append(pending, gvr.String())
+		}
+	}
+	if len(pending) > 0 {
+		slices.Sort(pending)
+		return fmt.Errorf("informers have not synced yet: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// syncError describes why the informer did not sync in time.
+func (i *listerInformer) syncError(gvr schema.GroupVersionResource) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.err != nil {
+		return fmt.Errorf("%s informer has not synced: %w", gvr.String(), i.err)
+	}
+	return fmt.Errorf("%s informer has not synced within %s, check that the adapter may list and watch it", gvr.String(), informerSyncTimeout)
+}
+
+// informerFor returns the synced informer for the resource described by info.
+// Resources that are not allowed are reported as not found.
+func (l *objectLister) informerFor(ctx context.Context, info provider.CustomMetricInfo) (informers.GenericInformer, error) {
+	if !l.allowed(info.GroupResource) {
+		return nil, provider.NewMetricNotFoundError(info.GroupResource, info.Metric)
+	}
+	gvr, err := helpers.ResourceFor(l.mapper, info)
+	if err != nil {
+		return nil, err
+	}
+	return l.informerForResource(ctx, gvr)
+}
+
+// informerForResource returns the synced informer for the resource. It
+// waits for the informer to sync until its sync deadline at most.
+func (l *objectLister) informerForResource(ctx context.Context, gvr schema.GroupVersionResource) (informers.GenericInformer, error) {
+	informer, _ := l.informer(gvr)
+	if informer.Informer().HasSynced() {
+		return informer, nil
+	}
+
+	if remaining := time.Until(informer.deadline); remaining > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, remaining)
+		defer cancel()
+		if cache.WaitForCacheSync(waitCtx.Done(), informer.Informer().HasSynced) {
+			return informer, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("timed out waiting for %s informer to sync: %w", gvr.String(), err)
+		}
+	}
+	return nil, informer.syncError(gvr)
+}
+
+// ListObjectNames lists the names of all objects of the given resource
+// matching the selector, sorted so responses built from them are stable.
+// Pods are additionally filtered by the PodFilter. Namespace is ignored for
+// root-scoped resources.
+func (l *objectLister) ListObjectNames(ctx context.Context, namespace string, selector labels.Selector, info provider.CustomMetricInfo) ([]string, error) {
+	informer, err := l.informerFor(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []runtime.Object
+	if info.Namespaced {
+		objects, err = informer.Lister().ByNamespace(namespace).List(selector)
+	} else {
+		objects, err = informer.Lister().List(selector)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filterPods := info.GroupResource == podsResource
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		if filterPods && !l.pods.matches(obj) {
+			continue
+		}
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, accessor.GetName())
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// maxOwnerDepth bounds the chain of controllers followed from a pod to its
+// owner, e.g. from a pod through its ReplicaSet to its Deployment.
+const maxOwnerDepth = 4
+
+// ownerOf returns the name of the object of the target resource that
+// controls the pod, directly or through intermediate controllers, following
+// the controller ownerReferences. It returns false if the pod is unknown or
+// has no such owner.
+func (l *objectLister) ownerOf(ctx context.Context, namespace, pod string, target schema.GroupResource) (string, bool, error) {
+	gvr, err := l.mapper.ResourceFor(schema.GroupVersionResource{Resource: podsResource.Resource})
+	if err != nil {
+		return "", false, err
+	}
+	name := pod
+	for range maxOwnerDepth {
+		informer, err := l.informerForResource(ctx, gvr)
+		if err != nil {
+			return "", false, err
+		}
+		obj, err := informer.Lister().ByNamespace(namespace).Get(name)
+		if apierr.IsNotFound(err) {
+			return "", false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			return "", false, err
+		}
+		ref := metav1.GetControllerOfNoCopy(accessor)
+		if ref == nil {
+			return "", false, nil
+		}
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return "", false, nil
+		}
+		mapping, err := l.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+		if err != nil {
+			return "", false, nil
+		}
+		if mapping.Resource.GroupResource() == target {
+			return ref.Name, true, nil
+		}
+		gvr, name = mapping.Resource, ref.Name
+	}
+	return "", false, nil
+}
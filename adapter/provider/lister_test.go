@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/brainpodnl/signoz-metrics-adapter/pkg/provider"
+)
+
+func TestObjectListerRejectsUnconfiguredResources(t *testing.T) {
+	mapper := apimeta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, apimeta.RESTScopeNamespace)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "pods"}:                       "PodList",
+		{Version: "v1", Resource: "secrets"}:                    "SecretList",
+		{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+	})
+	l := newObjectLister(client, mapper, 0, PodFilter{})
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	l.allow([]schema.GroupResource{deployments})
+
+	tests := []struct {
+		resource schema.GroupResource
+		allowed  bool
+	}{
+		{resource: podsResource, allowed: true},
+		{resource: deployments, allowed: true},
+		{resource: schema.GroupResource{Resource: "secrets"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource.String(), func(t *testing.T) {
+			info := provider.CustomMetricInfo{GroupResource: tt.resource, Namespaced: true, Metric: "requests"}
+			_, err := l.ListObjectNames(context.Background(), "default", labels.Everything(), info)
+			if tt.allowed && err != nil {
+				t.Fatalf("got %v, want no error", err)
+			}
+			if !tt.allowed && !apierr.IsNotFound(err) {
+				t.Fatalf("got %v, want a not found error", err)
+			}
+		})
+	}
+	if len(l.informers) != 2 {
+		t.Fatalf("started %d informers, want 2", len(l.informers))
+	}
+}
+
+func TestObjectListerSynced(t *testing.T) {
+	mapper := apimeta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, apimeta.RESTScopeNamespace)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "pods"}:    "PodList",
+		{Version: "v1", Resource: "secrets"}: "SecretList",
+	})
+	// Listing secrets is forbidden, so their informer never syncs.
+	client.PrependReactor("list", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierr.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("no RBAC"))
+	})
+	l := newObjectLister(client, mapper, 0, PodFilter{})
+	secrets := schema.GroupResource{Resource: "secrets"}
+	l.allow([]schema.GroupResource{secrets})
+	l.start([]schema.GroupResource{podsResource, secrets})
+
+	deadline := time.Now().Add(5 * time.Second)
+	var err error
+	for time.Now().Before(deadline) {
+		err = l.synced()
+		if err != nil && !strings.Contains(err.Error(), "pods") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err == nil || !strings.Contains(err.Error(), "secrets") {
+		t.Fatalf("got %v, want only the secrets informer pending", err)
+	}
+
+	// Past its sync deadline the informer no longer holds up readiness.
+	l.mu.Lock()
+	for gvr, informer := range l.informers {
+		if gvr.Resource == "secrets" {
+			informer.deadline = time.Now()
+		}
+	}
+	l.mu.Unlock()
+	if err := l.synced(); err != nil {
+		t.Fatalf("got %v, want synced after the deadline", err)
+	}
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"k8s.io/component-base/metrics"
+)
+
+var (
+	discoveryChanges = metrics.NewCounter(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "discovery_changes_total",
+		Help:           "Number of times the list of served metrics changed",
+		StabilityLevel: metrics.ALPHA,
+	})
+	queryRetries = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "query_retries_total",
+		Help:           "Number of retried SigNoz queries by the category of the error retried",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"category"})
+	circuitBreakerState = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "circuit_breaker_state",
+		Help:           "State of the circuit breaker of each SigNoz endpoint: 0 closed, 1 half-open, 2 open",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"endpoint"})
+	staleResponses = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "stale_responses_total",
+		Help:           "Number of queries answered with a last-known-good response while SigNoz was unavailable, by metric",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	staleValues = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "stale_values_total",
+		Help:           "Number of values served from the last successful query of an object because its query failed or returned no series, by metric",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	partialResponses = metrics.NewCounter(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "partial_responses_total",
+		Help:           "Number of federated queries answered by only some of the SigNoz endpoints",
+		StabilityLevel: metrics.ALPHA,
+	})
+	queryErrors = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "query_errors_total",
+		Help:           "Number of failed SigNoz queries by error category",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"category"})
+	apiRequests = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "api_requests_total",
+		Help:           "Number of custom and external metrics API requests by API and requesting user",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"api", "user"})
+	rateLimitedRequests = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "rate_limited_requests_total",
+		Help:           "Number of metrics API requests rejected by the inbound rate limit",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"api"})
+	inflightRequests = metrics.NewGauge(&metrics.GaugeOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "inflight_requests",
+		Help:           "Number of metrics API requests being served under the concurrency limit",
+		StabilityLevel: metrics.ALPHA,
+	})
+	queuedRequests = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "queued_requests",
+		Help:           "Number of metrics API requests waiting for the concurrency limit, by priority",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"priority"})
+	shedRequests = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "shed_requests_total",
+		Help:           "Number of metrics API requests rejected by the concurrency limit, by reason",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"api", "reason"})
+	queryCacheHits = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "query_cache_hits_total",
+		Help:           "Number of SigNoz queries answered from the query cache, by metric",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	queryCacheMisses = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "query_cache_misses_total",
+		Help:           "Number of SigNoz queries not found in the query cache, by metric",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	coalescedQueries = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "coalesced_queries_total",
+		Help:           "Number of SigNoz queries shared with an identical query in flight, by metric",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	metricHealthy = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "metric_healthy",
+		Help:           "Whether the last query of each metric succeeded: 1 healthy, 0 failing",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	metricSeries = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "metric_series",
+		Help:           "Number of series returned by the last successful query of each metric",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	metricLastSuccess = metrics.NewGaugeVec(&metrics.GaugeOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "metric_last_success_timestamp_seconds",
+		Help:           "Unix time of the last successful query of each metric",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric"})
+	shadowComparisons = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "shadow_comparisons_total",
+		Help:           "Number of objects compared between the builder and shadow query of a metric, by result",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"metric", "result"})
+	shadowDivergence = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Namespace:      "signoz_adapter",
+		Name:           "shadow_divergence_ratio",
+		Help:           "Relative divergence between the builder and shadow query values of an object",
+		StabilityLevel: metrics.ALPHA,
+		Buckets:        []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"metric"})
+)
+
+// RegisterMetrics registers the provider metrics, given a registration function.
+func RegisterMetrics(registrationFunc func(metrics.Registerable) error) error {
+	for _, m := range []metrics.Registerable{
+		discoveryChanges,
+		partialResponses,
+		queryErrors,
+		queryRetries,
+		circuitBreakerState,
+		staleResponses,
+		staleValues,
+		apiRequests,
+		rateLimitedRequests,
+		inflightRequests,
+		queuedRequests,
+		shedRequests,
+		queryCacheHits,
+		queryCacheMisses,
+		coalescedQueries,
+		metricHealthy,
+		metricSeries,
+		metricLastSuccess,
+		shadowComparisons,
+		shadowDivergence,
+	} {
+		if err := registrationFunc(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
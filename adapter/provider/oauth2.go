@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Auth modes selecting how the SigNoz client authenticates.
+const (
+	AuthModeAPIKey = "api-key"
+	AuthModeBearer = "bearer"
+	AuthModeOAuth2 = "oauth2"
+)
+
+// BearerToken authenticates with a static token sent as
+// `Authorization: Bearer`, for SigNoz behind an OIDC proxy that expects a
+// token instead of the API key header.
+type BearerToken struct {
+	token func() (string, error)
+}
+
+// NewBearerToken returns an Authenticator sending the token returned by
+// token, which is called for every request so rotated tokens are picked up.
+func NewBearerToken(token func() (string, error)) *BearerToken {
+	return &BearerToken{token: token}
+}
+
+func (b *BearerToken) Authenticate(ctx context.Context, request *http.Request) error {
+	token, err := b.token()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// OAuth2ClientCredentials authenticates with a bearer token obtained from an
+// OAuth2 token endpoint with the client credentials grant (RFC 6749 section
+// 4.4). The token is cached until shortly before it expires.
+type OAuth2ClientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret func() string
+	scopes       []string
+	http         http.Client
+	cache        tokenCache
+}
+
+// NewOAuth2ClientCredentials returns an Authenticator requesting tokens at
+// tokenURL. clientSecret is called for every token request, so a secret read
+// from a file can be rotated. A nil transport uses http.DefaultTransport.
+func NewOAuth2ClientCredentials(tokenURL, clientID string, clientSecret func() string, scopes []string, transport http.RoundTripper) *OAuth2ClientCredentials {
+	return &OAuth2ClientCredentials{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		http:         http.Client{Timeout: 10 * time.Second, Transport: transport, CheckRedirect: sameHostRedirect},
+	}
+}
+
+func (o *OAuth2ClientCredentials) Authenticate(ctx context.Context, request *http.Request) error {
+	token, err := o.cache.get(ctx, o.fetch)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (o *OAuth2ClientCredentials) fetch(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.scopes) > 0 {
+		form.Set("scope", strings.Join(o.scopes, " "))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret()))
+
+	response, err := o.http.Do(request)
+	if err != nil {
+		return "", 0, &UnavailableError{Err: fmt.Errorf("oauth2 token request: %w", err)}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return "", 0, &AuthError{StatusCode: response.StatusCode, Body: string(body), Hint: "the oauth2 token endpoint rejected the client credentials"}
+	}
+
+	var data tokenExchangeResponse
+	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
+		return "", 0, &DecodeError{Err: fmt.Errorf("oauth2 token request: %w", err)}
+	}
+	if data.AccessToken == "" {
+		return "", 0, &DecodeError{Err: fmt.Errorf("oauth2 token request: response has no access_token")}
+	}
+
+	lifetime := defaultTokenLifetime
+	if data.ExpiresIn > 0 {
+		lifetime = time.Duration(data.ExpiresIn) * time.Second
+	}
+	return data.AccessToken, lifetime, nil
+}
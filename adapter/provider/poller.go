@@ -0,0 +1,464 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// externalIdleIntervals is how many intervals an external metric and
+// selector pair is kept without being requested when there is no idle
+// timeout.
+const externalIdleIntervals = 10
+
+// PollOptions configures the background poller.
+type PollOptions struct {
+	// Interval between refresh rounds. Zero disables polling.
+	Interval time.Duration
+	// Workers is the number of metrics refreshed concurrently.
+	Workers int
+	// IdleTimeout skips metrics that were not requested for this long.
+	// Zero refreshes every metric on every round.
+	IdleTimeout time.Duration
+	// Jitter delays each metric by a random fraction of the interval, up to
+	// this fraction, so queries of a round are spread out.
+	Jitter float64
+	// Replica identifies this adapter instance. The first round is delayed
+	// by a phase offset derived from it, so replicas polling independently
+	// do not query SigNoz at the same instant.
+	Replica string
+}
+
+// seriesSnapshot is the result of polling a single target. The index of a
+// custom metric is built once per poll and shared by all requests until the
+// next one; external metrics keep the series.
+type seriesSnapshot struct {
+	index   *seriesIndex
+	series  []seriesValue
+	fetched time.Time
+}
+
+// pollTarget identifies a polled query: a custom metric, queried without a
+// metric selector, or an external metric for the namespace and metric
+// selector of an external metrics API request.
+type pollTarget struct {
+	metric    string
+	external  bool
+	namespace string
+	selector  string
+}
+
+// metricState tracks the freshness of a single target.
+type metricState struct {
+	metric *MetricConfig
+	// configHash is the configHash of metric, compared instead of the
+	// pointer, which changes with every update of the metrics.
+	configHash uint64
+	// metricSelector is the selector of an external target.
+	metricSelector labels.Selector
+	// stop ends the goroutine refreshing the target, nil until it started.
+	stop context.CancelFunc
+
+	snapshot      seriesSnapshot
+	lastSuccess   time.Time
+	lastRequested time.Time
+}
+
+// seriesPoller periodically refreshes the configured metrics and keeps the
+// latest result in memory, so API requests can be answered without waiting
+// on SigNoz. Besides the custom metrics, it refreshes every external metric
+// and selector pair requested through the external metrics API, from its
+// first request until it goes idle. Every target is refreshed by its own
+// goroutine on its own schedule, so a query that is slow or failing does not
+// delay the others. At most Workers queries run at once; when more are due,
+// the target with the oldest successful refresh goes first. The set of
+// metrics can be replaced while polling with setMetrics.
+type seriesPoller struct {
+	opts          PollOptions
+	fetch         func(ctx context.Context, metric *MetricConfig) ([]seriesValue, error)
+	fetchExternal func(ctx context.Context, metric *MetricConfig, namespace string, metricSelector labels.Selector) ([]seriesValue, error)
+	workers       *workerPool
+
+	mu sync.RWMutex
+	// ctx is the context of run, nil until polling started.
+	ctx    context.Context
+	states map[pollTarget]*metricState
+}
+
+func newSeriesPoller(opts PollOptions, metrics []MetricConfig,
+	fetch func(ctx context.Context, metric *MetricConfig) ([]seriesValue, error),
+	fetchExternal func(ctx context.Context, metric *MetricConfig, namespace string, metricSelector labels.Selector) ([]seriesValue, error),
+) *seriesPoller {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+
+	sp := &seriesPoller{
+		opts:          opts,
+		fetch:         fetch,
+		fetchExternal: fetchExternal,
+		workers:       newWorkerPool(opts.Workers),
+		states:        make(map[pollTarget]*metricState, len(metrics)),
+	}
+	sp.setMetrics(metrics)
+	return sp
+}
+
+// setMetrics replaces the polled metrics. Refreshing starts for added metrics
+// and stops for removed ones, including their external targets; a target
+// whose metric config changed keeps its schedule but drops its snapshot,
+// while unchanged targets keep their snapshot and refreshes in flight.
+func (sp *seriesPoller) setMetrics(metrics []MetricConfig) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	keep := make(map[string]*MetricConfig, len(metrics))
+	for i := range metrics {
+		metric := &metrics[i]
+		keep[metric.Name] = metric
+
+		target := pollTarget{metric: metric.Name}
+		if _, ok := sp.states[target]; !ok {
+			state := &metricState{metric: metric, configHash: metric.configHash()}
+			sp.states[target] = state
+			sp.start(target, state, time.Now())
+		}
+	}
+
+	hashes := make(map[string]uint64, len(keep))
+	for target, state := range sp.states {
+		metric, ok := keep[target.metric]
+		if !ok {
+			sp.remove(target, state)
+			continue
+		}
+		hash, ok := hashes[metric.Name]
+		if !ok {
+			hash = metric.configHash()
+			hashes[metric.Name] = hash
+		}
+		if state.configHash != hash {
+			state.snapshot = seriesSnapshot{}
+			state.configHash = hash
+		}
+		state.metric = metric
+	}
+}
+
+// configHash returns a hash of the config of the metric, so configs that are
+// equal but loaded separately are recognized as unchanged. The compiled
+// fields are left out, as they are derived from the others.
+func (m *MetricConfig) configHash() uint64 {
+	h := fnv.New64a()
+	if err := json.NewEncoder(h).Encode(m); err != nil {
+		// Not expected; treat the config as changed on every update.
+		return rand.Uint64()
+	}
+	fmt.Fprintf(h, "%s\x00%s\x00%q\x00%s", m.stepAggregation, m.namespace, m.podLabels, m.namespaceKey)
+	return h.Sum64()
+}
+
+// remove stops refreshing the target. It must be called with mu held.
+func (sp *seriesPoller) remove(target pollTarget, state *metricState) {
+	if state.stop != nil {
+		state.stop()
+	}
+	delete(sp.states, target)
+}
+
+// invalidate drops the snapshots of all metrics, so requests query SigNoz
+// until the next refresh.
+func (sp *seriesPoller) invalidate() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for _, state := range sp.states {
+		state.snapshot = seriesSnapshot{}
+	}
+}
+
+// start starts refreshing the target from next if polling is running. It
+// must be called with mu held.
+func (sp *seriesPoller) start(target pollTarget, state *metricState, next time.Time) {
+	if sp.ctx == nil {
+		return
+	}
+	ctx, stop := context.WithCancel(sp.ctx)
+	state.stop = stop
+	go sp.runMetric(ctx, target, next)
+}
+
+// run refreshes every metric each interval, starting after the phase offset
+// of the replica, until the context is cancelled.
+func (sp *seriesPoller) run(ctx context.Context) {
+	offset := sp.phaseOffset()
+	klog.V(2).Infof("polling every %s with phase offset %s", sp.opts.Interval, offset)
+
+	sp.mu.Lock()
+	sp.ctx = ctx
+	for target, state := range sp.states {
+		sp.start(target, state, time.Now().Add(offset))
+	}
+	sp.mu.Unlock()
+
+	<-ctx.Done()
+}
+
+// runMetric refreshes the target every interval from start, each time
+// delayed by a random jitter. A refresh that overruns the interval moves the
+// schedule instead of queueing up missed refreshes. It returns when ctx is
+// cancelled, which happens when the target is removed, or when an external
+// target went idle.
+func (sp *seriesPoller) runMetric(ctx context.Context, target pollTarget, next time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next) + sp.jitter()):
+		}
+		next = next.Add(sp.opts.Interval)
+
+		state, ok := sp.current(target)
+		if !ok {
+			return
+		}
+		if sp.idle(target) {
+			continue
+		}
+		if !sp.workers.acquire(ctx, state.lastSuccess) {
+			return
+		}
+		sp.refreshMetric(ctx, target, state)
+		sp.workers.release()
+
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+	}
+}
+
+// phaseOffset spreads replicas over the interval by a hash of their name.
+func (sp *seriesPoller) phaseOffset() time.Duration {
+	if sp.opts.Replica == "" {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(sp.opts.Replica))
+	return time.Duration(h.Sum64() % uint64(sp.opts.Interval))
+}
+
+// jitter returns a random delay up to the jitter fraction of the interval.
+func (sp *seriesPoller) jitter() time.Duration {
+	if maxDelay := time.Duration(sp.opts.Jitter * float64(sp.opts.Interval)); maxDelay > 0 {
+		return rand.N(maxDelay)
+	}
+	return 0
+}
+
+// current returns a copy of the state of the target, false if it was
+// removed.
+func (sp *seriesPoller) current(target pollTarget) (metricState, bool) {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	state, ok := sp.states[target]
+	if !ok {
+		return metricState{}, false
+	}
+	return *state, true
+}
+
+// idle reports whether the target was not requested within the idle
+// timeout. External targets that are idle are removed, as nothing requests
+// their metric and selector anymore.
+func (sp *seriesPoller) idle(target pollTarget) bool {
+	if target.external {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+		state, ok := sp.states[target]
+		timeout := sp.opts.IdleTimeout
+		if timeout <= 0 {
+			timeout = externalIdleIntervals * sp.opts.Interval
+		}
+		if ok && time.Since(state.lastRequested) > timeout {
+			sp.remove(target, state)
+			return true
+		}
+		return false
+	}
+
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	state, ok := sp.states[target]
+	return ok && sp.opts.IdleTimeout > 0 && time.Since(state.lastRequested) > sp.opts.IdleTimeout
+}
+
+func (sp *seriesPoller) refreshMetric(ctx context.Context, target pollTarget, state metricState) {
+	metric := state.metric
+	var series []seriesValue
+	var err error
+	if target.external {
+		series, err = sp.fetchExternal(ctx, metric, target.namespace, state.metricSelector)
+	} else {
+		series, err = sp.fetch(ctx, metric)
+	}
+	if err != nil {
+		klog.Errorf("failed to poll metric %s: %v", metric.Name, err)
+		return
+	}
+
+	now := time.Now()
+	snapshot := seriesSnapshot{series: series, fetched: now}
+	if !target.external {
+		snapshot = seriesSnapshot{index: newSeriesIndex(series, metric), fetched: now}
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	current, ok := sp.states[target]
+	if !ok || current.configHash != state.configHash {
+		// Removed or changed while fetching.
+		return
+	}
+	current.snapshot = snapshot
+	current.lastSuccess = now
+}
+
+// age returns the age of the latest snapshot of the custom metric.
+func (sp *seriesPoller) age(name string) (time.Duration, bool) {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+
+	state, ok := sp.states[pollTarget{metric: name}]
+	if !ok || state.snapshot.index == nil {
+		return 0, false
+	}
+	return time.Since(state.snapshot.fetched), true
+}
+
+// get marks the custom metric as requested and returns its latest snapshot.
+func (sp *seriesPoller) get(name string) (seriesSnapshot, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	state, ok := sp.states[pollTarget{metric: name}]
+	if !ok {
+		return seriesSnapshot{}, false
+	}
+	state.lastRequested = time.Now()
+	return sp.fresh(state)
+}
+
+// getExternal marks the external metric as requested for the namespace and
+// metric selector and returns its latest snapshot. A pair requested for the
+// first time is polled from then on.
+func (sp *seriesPoller) getExternal(name, namespace string, metricSelector labels.Selector) (seriesSnapshot, bool) {
+	if metricSelector == nil {
+		metricSelector = labels.Everything()
+	}
+	target := pollTarget{metric: name, external: true, namespace: namespace, selector: metricSelector.String()}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	state, ok := sp.states[target]
+	if !ok {
+		custom, ok := sp.states[pollTarget{metric: name}]
+		if !ok {
+			return seriesSnapshot{}, false
+		}
+		state = &metricState{metric: custom.metric, configHash: custom.configHash, metricSelector: metricSelector, lastRequested: time.Now()}
+		sp.states[target] = state
+		sp.start(target, state, time.Now().Add(sp.opts.Interval))
+		return seriesSnapshot{}, false
+	}
+	state.lastRequested = time.Now()
+	return sp.fresh(state)
+}
+
+// fresh returns the snapshot of the target unless there is none or it
+// missed more than a couple of polls, in which case it is considered stale.
+// It must be called with mu held.
+func (sp *seriesPoller) fresh(state *metricState) (seriesSnapshot, bool) {
+	if time.Since(state.snapshot.fetched) > 3*sp.opts.Interval {
+		return seriesSnapshot{}, false
+	}
+	return state.snapshot, true
+}
+
+// workerPool bounds the number of concurrent refreshes. Contended slots go
+// to the waiter whose target was refreshed successfully longest ago, so stale
+// targets are caught up first.
+type workerPool struct {
+	mu      sync.Mutex
+	free    int
+	waiters []*poolWaiter
+}
+
+type poolWaiter struct {
+	lastSuccess time.Time
+	ready       chan struct{}
+}
+
+func newWorkerPool(size int) *workerPool {
+	return &workerPool{free: size}
+}
+
+// acquire waits for a slot for a target last refreshed successfully at
+// lastSuccess. It returns false if ctx is done first.
+func (wp *workerPool) acquire(ctx context.Context, lastSuccess time.Time) bool {
+	wp.mu.Lock()
+	if wp.free > 0 {
+		wp.free--
+		wp.mu.Unlock()
+		return true
+	}
+	w := &poolWaiter{lastSuccess: lastSuccess, ready: make(chan struct{})}
+	wp.waiters = append(wp.waiters, w)
+	wp.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-ctx.Done():
+	}
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	if i := slices.Index(wp.waiters, w); i >= 0 {
+		wp.waiters = slices.Delete(wp.waiters, i, i+1)
+		return false
+	}
+	// The slot was handed over while ctx was done.
+	wp.releaseLocked()
+	return false
+}
+
+// release returns a slot, handing it to the stalest waiter if any.
+func (wp *workerPool) release() {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.releaseLocked()
+}
+
+func (wp *workerPool) releaseLocked() {
+	if len(wp.waiters) == 0 {
+		wp.free++
+		return
+	}
+	i := 0
+	for j, w := range wp.waiters {
+		if w.lastSuccess.Before(wp.waiters[i].lastSuccess) {
+			i = j
+		}
+	}
+	w := wp.waiters[i]
+	wp.waiters = slices.Delete(wp.waiters, i, i+1)
+	close(w.ready)
+}
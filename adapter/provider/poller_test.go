@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func newTestPoller(metrics []MetricConfig) *seriesPoller {
+	fetch := func(ctx context.Context, metric *MetricConfig) ([]seriesValue, error) {
+		return []seriesValue{{Labels: map[string]string{"k8s.pod.name": "a"}, Value: 1}}, nil
+	}
+	fetchExternal := func(ctx context.Context, metric *MetricConfig, namespace string, metricSelector labels.Selector) ([]seriesValue, error) {
+		return fetch(ctx, metric)
+	}
+	return newSeriesPoller(PollOptions{Interval: time.Minute}, metrics, fetch, fetchExternal)
+}
+
+func pollerMetrics(filter string) []MetricConfig {
+	return []MetricConfig{
+		{Name: "requests", Resource: "pods", FilterExpression: filter},
+		{Name: "latency", Resource: "pods"},
+	}
+}
+
+func TestSeriesPollerKeepsUnchangedMetrics(t *testing.T) {
+	sp := newTestPoller(pollerMetrics("a"))
+	target := pollTarget{metric: "requests"}
+	state, _ := sp.current(target)
+	sp.refreshMetric(context.Background(), target, state)
+
+	// An update reloading the same config, e.g. for another SignozMetric,
+	// keeps the snapshot and the result of a refresh in flight.
+	state, _ = sp.current(target)
+	sp.setMetrics(pollerMetrics("a"))
+	if _, ok := sp.get("requests"); !ok {
+		t.Fatal("snapshot dropped by an unchanged update")
+	}
+	sp.invalidate()
+	sp.refreshMetric(context.Background(), target, state)
+	if _, ok := sp.get("requests"); !ok {
+		t.Fatal("refresh in flight discarded by an unchanged update")
+	}
+}
+
+func TestSeriesPollerDropsChangedMetrics(t *testing.T) {
+	sp := newTestPoller(pollerMetrics("a"))
+	target := pollTarget{metric: "requests"}
+	state, _ := sp.current(target)
+	sp.refreshMetric(context.Background(), target, state)
+	other, _ := sp.current(pollTarget{metric: "latency"})
+	sp.refreshMetric(context.Background(), pollTarget{metric: "latency"}, other)
+
+	state, _ = sp.current(target)
+	sp.setMetrics(pollerMetrics("b"))
+	if _, ok := sp.get("requests"); ok {
+		t.Fatal("snapshot of a changed metric kept")
+	}
+	if _, ok := sp.get("latency"); !ok {
+		t.Fatal("snapshot of an unchanged metric dropped")
+	}
+	sp.refreshMetric(context.Background(), target, state)
+	if _, ok := sp.get("requests"); ok {
+		t.Fatal("refresh with the old config stored")
+	}
+}
+
+func TestSeriesPollerRemovesMetrics(t *testing.T) {
+	sp := newTestPoller(pollerMetrics("a"))
+	sp.getExternal("requests", "default", labels.Everything())
+	sp.setMetrics(pollerMetrics("a")[1:])
+
+	if _, ok := sp.current(pollTarget{metric: "requests"}); ok {
+		t.Fatal("removed metric still polled")
+	}
+	if _, ok := sp.current(pollTarget{metric: "requests", external: true, namespace: "default", selector: labels.Everything().String()}); ok {
+		t.Fatal("external target of a removed metric still polled")
+	}
+}
+
+func TestSeriesPollerExternalTargets(t *testing.T) {
+	fetch := func(ctx context.Context, metric *MetricConfig) ([]seriesValue, error) {
+		return nil, nil
+	}
+	fetchExternal := func(ctx context.Context, metric *MetricConfig, namespace string, metricSelector labels.Selector) ([]seriesValue, error) {
+		return []seriesValue{{Labels: map[string]string{"selector": metricSelector.String()}, Value: float64(len(namespace))}}, nil
+	}
+	sp := newSeriesPoller(PollOptions{Interval: time.Minute}, pollerMetrics("a"), fetch, fetchExternal)
+
+	queue := labels.SelectorFromSet(labels.Set{"queue": "orders"})
+	targets := []struct {
+		namespace string
+		selector  labels.Selector
+	}{
+		{namespace: "default", selector: labels.Everything()},
+		{namespace: "shop", selector: queue},
+	}
+	for _, tt := range targets {
+		if _, ok := sp.getExternal("requests", tt.namespace, tt.selector); ok {
+			t.Fatal("got a snapshot before the first refresh")
+		}
+		target := pollTarget{metric: "requests", external: true, namespace: tt.namespace, selector: tt.selector.String()}
+		state, ok := sp.current(target)
+		if !ok {
+			t.Fatalf("%s %s: requested pair not polled", tt.namespace, tt.selector)
+		}
+		sp.refreshMetric(context.Background(), target, state)
+	}
+
+	for _, tt := range targets {
+		snapshot, ok := sp.getExternal("requests", tt.namespace, tt.selector)
+		if !ok || len(snapshot.series) != 1 {
+			t.Fatalf("%s %s: got %+v, %v, want the polled series", tt.namespace, tt.selector, snapshot, ok)
+		}
+		if got := snapshot.series[0]; got.Labels["selector"] != tt.selector.String() || got.Value != float64(len(tt.namespace)) {
+			t.Fatalf("%s %s: got series %+v of another pair", tt.namespace, tt.selector, got)
+		}
+	}
+
+	target := pollTarget{metric: "requests", external: true, namespace: "shop", selector: queue.String()}
+	sp.mu.Lock()
+	sp.states[target].lastRequested = time.Now().Add(-externalIdleIntervals * 2 * time.Minute)
+	sp.mu.Unlock()
+	if !sp.idle(target) {
+		t.Fatal("pair not requested for the idle timeout is not idle")
+	}
+	if _, ok := sp.current(target); ok {
+		t.Fatal("idle pair still polled")
+	}
+}
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"maps"
+	"slices"
+)
+
+// presets are curated metric sets for common exporters, selected with
+// --preset. Metric names follow the exporters' Prometheus naming as ingested
+// by the SigNoz collector; pods are attributed through the k8s.pod.name
+// resource attribute set by the k8sattributes processor.
+var presets = map[string][]MetricConfig{
+	// hipages/php-fpm_exporter running as a sidecar.
+	"phpfpm": {
+		{Name: "phpfpm_active_processes", SpaceAggregation: "max"},
+		{Name: "phpfpm_idle_processes", SpaceAggregation: "max"},
+		{Name: "phpfpm_listen_queue", SpaceAggregation: "max"},
+	},
+	// nginx/nginx-prometheus-exporter running as a sidecar.
+	"nginx": {
+		{Name: "nginx_connections_active", SpaceAggregation: "max"},
+		{Name: "nginx_connections_waiting", SpaceAggregation: "max"},
+	},
+	// OpenTelemetry Java agent runtime metrics. Memory is summed over all
+	// pools of a pod.
+	"jvm": {
+		{Name: "jvm.memory.used", SpaceAggregation: "sum"},
+		{Name: "jvm.thread.count", SpaceAggregation: "sum"},
+		{Name: "jvm.cpu.recent_utilization", SpaceAggregation: "max"},
+	},
+	// danielqsj/kafka_exporter. Lag is reported per consumer group rather
+	// than per pod, so it is meant to be consumed as an external metric
+	// selected by consumergroup and topic.
+	"kafka-lag": {
+		{Name: "kafka_consumergroup_lag", SpaceAggregation: "sum", GroupBy: []string{"consumergroup", "topic"}},
+	},
+}
+
+// PresetNames returns the names of the built-in presets.
+func PresetNames() []string {
+	return slices.Sorted(maps.Keys(presets))
+}
+
+// PresetMetrics returns a copy of the metrics of the named preset.
+func PresetMetrics(name string) ([]MetricConfig, bool) {
+	metrics, ok := presets[name]
+	if !ok {
+		return nil, false
+	}
+	out := make([]MetricConfig, len(metrics))
+	for i, m := range metrics {
+		m.GroupBy = slices.Clone(m.GroupBy)
+		out[i] = m
+	}
+	return out, true
+}
@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// PrometheusProxy serves a read-only subset of the Prometheus HTTP API,
+// /api/v1/query and /api/v1/query_range, by running the PromQL through
+// SigNoz with the adapter's credentials. It is meant for debugging adapter
+// queries with tools that only speak the Prometheus API.
+type PrometheusProxy struct {
+	signoz Querier
+}
+
+func NewPrometheusProxy(signoz Querier) *PrometheusProxy {
+	return &PrometheusProxy{signoz: signoz}
+}
+
+// Install registers the proxy handlers on the given mux.
+func (pp *PrometheusProxy) Install(mux interface {
+	HandleFunc(path string, handler func(http.ResponseWriter, *http.Request))
+}) {
+	mux.HandleFunc("/api/v1/query", pp.handleQuery)
+	mux.HandleFunc("/api/v1/query_range", pp.handleQueryRange)
+}
+
+type promResponse struct {
+	Status    string    `json:"status"`
+	Data      *promData `json:"data,omitempty"`
+	ErrorType string    `json:"errorType,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type promData struct {
+	ResultType string       `json:"resultType"`
+	Result     []promSeries `json:"result"`
+}
+
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  []any             `json:"value,omitempty"`
+	Values [][]any           `json:"values,omitempty"`
+}
+
+func (pp *PrometheusProxy) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if !pp.checkMethod(w, r) {
+		return
+	}
+
+	at := time.Now()
+	if v := r.FormValue("time"); v != "" {
+		t, err := parsePromTime(v)
+		if err != nil {
+			writePromError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		at = t
+	}
+
+	// An instant query is evaluated as a short range ending at the
+	// requested time, keeping the last point of every series.
+	resp, err := pp.query(r, r.FormValue("query"), at.Add(-5*time.Minute), at, time.Minute)
+	if err != nil {
+		writePromError(w, http.StatusUnprocessableEntity, "execution", err)
+		return
+	}
+
+	result := []promSeries{}
+	for _, s := range resultSeries(resp) {
+		if len(s.Values) == 0 {
+			continue
+		}
+		last := s.Values[len(s.Values)-1]
+		result = append(result, promSeries{Metric: s.LabelMap(), Value: promSample(last)})
+	}
+	writePromData(w, &promData{ResultType: "vector", Result: result})
+}
+
+func (pp *PrometheusProxy) handleQueryRange(w http.ResponseWriter, r *http.Request) {
+	if !pp.checkMethod(w, r) {
+		return
+	}
+
+	start, err := parsePromTime(r.FormValue("start"))
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid start: %w", err))
+		return
+	}
+	end, err := parsePromTime(r.FormValue("end"))
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid end: %w", err))
+		return
+	}
+	step, err := parsePromDuration(r.FormValue("step"))
+	if err != nil {
+		writePromError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid step: %w", err))
+		return
+	}
+
+	resp, err := pp.query(r, r.FormValue("query"), start, end, step)
+	if err != nil {
+		writePromError(w, http.StatusUnprocessableEntity, "execution", err)
+		return
+	}
+
+	result := []promSeries{}
+	for _, s := range resultSeries(resp) {
+		values := make([][]any, len(s.Values))
+		for i, v := range s.Values {
+			values[i] = promSample(v)
+		}
+		result = append(result, promSeries{Metric: s.LabelMap(), Values: values})
+	}
+	writePromData(w, &promData{ResultType: "matrix", Result: result})
+}
+
+func (pp *PrometheusProxy) checkMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writePromError(w, http.StatusMethodNotAllowed, "bad_data", fmt.Errorf("method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+func (pp *PrometheusProxy) query(r *http.Request, promql string, start, end time.Time, step time.Duration) (*SignozQueryRangeResponse, error) {
+	if promql == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	klog.V(4).Infof("proxying promql query %q", promql)
+	return pp.signoz.Query(r.Context(), SignozQueryRangeOptions{
+		RequestType: "time_series",
+		Start:       start.UnixMilli(),
+		End:         end.UnixMilli(),
+		CompositeQuery: SignozCompositeQuery{
+			Queries: []SignozQuery{{
+				Type: "promql",
+				Spec: SignozQuerySpec{
+					Name:         "A",
+					Query:        promql,
+					StepInterval: int64(step.Seconds()),
+				},
+			}},
+		},
+	})
+}
+
+// resultSeries returns all series of the response.
+func resultSeries(resp *SignozQueryRangeResponse) []SignozResultSeries {
+	var series []SignozResultSeries
+	for _, qr := range resp.Data.Data.Results {
+		for _, agg := range qr.Aggregations {
+			series = append(series, agg.Series...)
+		}
+	}
+	return series
+}
+
+func promSample(v SignozSeriesValue) []any {
+	return []any{float64(v.Timestamp) / 1000, strconv.FormatFloat(float64(v.Value), 'f', -1, 64)}
+}
+
+// parsePromTime accepts RFC3339 or unix timestamps with optional fractions,
+// like the Prometheus API.
+func parsePromTime(s string) (time.Time, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parsePromDuration accepts Go durations or a number of seconds.
+func parsePromDuration(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+func writePromData(w http.ResponseWriter, data *promData) {
+	writePromResponse(w, http.StatusOK, promResponse{Status: "success", Data: data})
+}
+
+func writePromError(w http.ResponseWriter, code int, errorType string, err error) {
+	writePromResponse(w, code, promResponse{Status: "error", ErrorType: errorType, Error: err.Error()})
+}
+
+func writePromResponse(w http.ResponseWriter, code int, resp promResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		klog.Errorf("failed to write prometheus response: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// anyValue is the regexp substituted for the namespace and object when a
+// query is not made for a single one, e.g. by the poller.
+const anyValue = ".+"
+
+type queryScopeKey struct{}
+
+// queryScope is the namespace and object a metrics API request is made for,
+// substituted into query templates.
+type queryScope struct {
+	namespace string
+	object    string
+	// objects is set for requests about objects of the namespace, whose
+	// builder queries are restricted to its series.
+	objects bool
+}
+
+// withQueryScope returns ctx carrying the namespace and object of the
+// request. Empty values match any namespace or object.
+func withQueryScope(ctx context.Context, namespace, object string) context.Context {
+	return context.WithValue(ctx, queryScopeKey{}, queryScope{namespace: namespace, object: object})
+}
+
+// withObjectScope is withQueryScope for requests about objects of the
+// namespace, such as those of the custom metrics API.
+func withObjectScope(ctx context.Context, namespace, object string) context.Context {
+	return context.WithValue(ctx, queryScopeKey{}, queryScope{namespace: namespace, object: object, objects: true})
+}
+
+// objectNamespace returns the namespace whose objects the request is about,
+// or "" if it is not about objects of a namespace.
+func (s queryScope) objectNamespace() string {
+	if !s.objects {
+		return ""
+	}
+	return s.namespace
+}
+
+func queryScopeFrom(ctx context.Context) queryScope {
+	scope, _ := ctx.Value(queryScopeKey{}).(queryScope)
+	return scope
+}
+
+// regexpOrAny returns the regexp matching exactly value, or any value if it
+// is empty.
+func regexpOrAny(value string) string {
+	if value == "" {
+		return anyValue
+	}
+	return regexp.QuoteMeta(value)
+}
+
+// promQLQuery expands the PromQL template of the metric. The variables are:
+//
+//   - $namespace and $object (or $pod): regexps matching the namespace and
+//     object of the request, or any if the query is not made for one, for
+//     use with =~
+//   - $window: the query window as a PromQL duration, e.g. 300s
+//   - $selector: the metric selector as comma-separated label matchers
+//   - $<label>: the value of an equality requirement of the metric selector,
+//     with dots in the label replaced by underscores, e.g. $service_name
+//
+// Equality requirements on labels whose variable is one of the above, such
+// as namespace, fail the request, so that a caller cannot widen the query
+// beyond the namespace and object it is made for.
+func (p *signozProvider) promQLQuery(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector, r QueryRange) (SignozQueryRangeOptions, error) {
+	scope := queryScopeFrom(ctx)
+	w := window(metric, r)
+	vars := map[string]string{
+		"namespace": promQLEscape(regexpOrAny(scope.namespace)),
+		"object":    promQLEscape(regexpOrAny(scope.object)),
+		"pod":       promQLEscape(regexpOrAny(scope.object)),
+		"window":    strconv.FormatInt(int64(w.Seconds()), 10) + "s",
+	}
+
+	var matchers []string
+	if metricSelector != nil && !metricSelector.Empty() {
+		reqs, selectable := metricSelector.Requirements()
+		if !selectable {
+			return SignozQueryRangeOptions{}, apierr.NewBadRequest(fmt.Sprintf("metric selector %q can never match", metricSelector.String()))
+		}
+		for _, req := range reqs {
+			matcher, err := promQLMatcher(req)
+			if err != nil {
+				return SignozQueryRangeOptions{}, apierr.NewBadRequest(fmt.Sprintf("metric selector %q: %v", metricSelector.String(), err))
+			}
+			matchers = append(matchers, matcher)
+			if op := req.Operator(); op == selection.Equals || op == selection.DoubleEquals {
+				name, err := selectorVar(metricSelector, req, promQLVars)
+				if err != nil {
+					return SignozQueryRangeOptions{}, err
+				}
+				vars[name] = promQLEscape(req.Values().List()[0])
+			}
+		}
+	}
+	vars["selector"] = strings.Join(matchers, ", ")
+
+	query, err := expandTemplate(metric, metric.PromQL, vars)
+	if err != nil {
+		return SignozQueryRangeOptions{}, err
+	}
+
+	end := time.Now()
+	return SignozQueryRangeOptions{
+		RequestType: "time_series",
+		Start:       end.Add(-w).UnixMilli(),
+		End:         end.UnixMilli(),
+		CompositeQuery: SignozCompositeQuery{
+			Queries: []SignozQuery{{
+				Type: "promql",
+				Spec: SignozQuerySpec{
+					Name:         "A",
+					Query:        query,
+					StepInterval: step(metric, r),
+				},
+			}},
+		},
+	}, nil
+}
+
+// promQLVars are the variables promQLQuery sets itself.
+var promQLVars = []string{"namespace", "object", "pod", "window", "selector"}
+
+// selectorVar returns the template variable of an equality requirement of
+// the metric selector. Requirements whose variable is reserved are rejected.
+func selectorVar(metricSelector labels.Selector, req labels.Requirement, reserved []string) (string, error) {
+	name := strings.ReplaceAll(req.Key(), ".", "_")
+	if slices.Contains(reserved, name) {
+		return "", apierr.NewBadRequest(fmt.Sprintf("metric selector %q: label %s would override the $%s variable of the query", metricSelector.String(), req.Key(), name))
+	}
+	return name, nil
+}
+
+// promQLEscape escapes value for use inside a double-quoted PromQL string.
+func promQLEscape(value string) string {
+	quoted := strconv.Quote(value)
+	return quoted[1 : len(quoted)-1]
+}
+
+// expandTemplate substitutes the variables into a query template of the
+// metric. Variables the request does not set fail the request.
+func expandTemplate(metric *MetricConfig, template string, vars map[string]string) (string, error) {
+	var missing []string
+	query := os.Expand(template, func(name string) string {
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, "$"+name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", apierr.NewBadRequest(fmt.Sprintf("query of metric %s uses %s, which the request does not set", metric.Name, strings.Join(missing, ", ")))
+	}
+	return query, nil
+}
+
+// promQLMatcher translates a selector requirement into a PromQL label
+// matcher. Labels that are not valid PromQL identifiers, such as OTel
+// attributes with dots, are quoted.
+func promQLMatcher(req labels.Requirement) (string, error) {
+	name := req.Key()
+	if !promQLIdentifier.MatchString(name) {
+		name = strconv.Quote(name)
+	}
+	values := req.Values().List()
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = regexp.QuoteMeta(v)
+	}
+
+	switch req.Operator() {
+	case selection.Equals, selection.DoubleEquals:
+		return fmt.Sprintf("%s=%s", name, strconv.Quote(values[0])), nil
+	case selection.NotEquals:
+		return fmt.Sprintf("%s!=%s", name, strconv.Quote(values[0])), nil
+	case selection.In:
+		return fmt.Sprintf("%s=~%s", name, strconv.Quote(strings.Join(quoted, "|"))), nil
+	case selection.NotIn:
+		return fmt.Sprintf("%s!~%s", name, strconv.Quote(strings.Join(quoted, "|"))), nil
+	case selection.Exists:
+		return fmt.Sprintf(`%s!=""`, name), nil
+	case selection.DoesNotExist:
+		return fmt.Sprintf(`%s=""`, name), nil
+	default:
+		return "", fmt.Errorf("operator %q is not supported for PromQL metrics", req.Operator())
+	}
+}
+
+var promQLIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestPromQLQuerySelectorVars(t *testing.T) {
+	metric := &MetricConfig{
+		Name:   "requests",
+		PromQL: `sum(rate(http_requests_total{namespace=~"$namespace", pod=~"$pod", service="$service_name"}[$window]))`,
+	}
+	ctx := withObjectScope(context.Background(), "team-a", "")
+	r := QueryRange{Window: 5 * time.Minute}
+
+	tests := []struct {
+		selector string
+		query    string
+		invalid  bool
+	}{
+		{
+			selector: "service.name=api",
+			query:    `sum(rate(http_requests_total{namespace=~"team-a", pod=~".+", service="api"}[300s]))`,
+		},
+		{selector: "service.name=api,namespace=other", invalid: true},
+		{selector: "service.name=api,object=other", invalid: true},
+		{selector: "service.name=api,pod=other", invalid: true},
+		{selector: "service.name=api,window=30d", invalid: true},
+		{selector: "service.name=api,selector=x", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, err := (&signozProvider{}).promQLQuery(ctx, metric, selector, r)
+			if tt.invalid {
+				if !apierr.IsBadRequest(err) {
+					t.Fatalf("got error %v, want BadRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := opts.CompositeQuery.Queries[0].Spec.Query; got != tt.query {
+				t.Errorf("got query %s, want %s", got, tt.query)
+			}
+		})
+	}
+}
@@ -1,13 +1,19 @@
 package provider
 
 import (
+	"cmp"
 	"context"
+	"fmt"
 	"math"
-	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -24,23 +30,61 @@ import (
 
 const podLabelKey = "k8s.pod.name"
 
+const (
+	// stepsPerWindow is the number of points requested per series.
+	stepsPerWindow = 30
+	minStepSeconds = 10
+	maxStepSeconds = 300
+)
+
+// stepSeconds derives the query step from the window, so long windows don't
+// return points that are discarded and short windows still get enough
+// samples.
+func stepSeconds(window time.Duration) int64 {
+	step := int64(window.Seconds()) / stepsPerWindow
+	return min(max(step, minStepSeconds), maxStepSeconds)
+}
+
 type seriesValue struct {
 	Labels map[string]string
 	Value  float64
 }
 
+// Series returns the latest value of every series. Points without a value
+// are skipped, and series without any value are left out, so that a missing
+// series is never reported as zero.
 func (resp *SignozQueryRangeResponse) Series() []seriesValue {
-	var results []seriesValue
+	return resp.series(func(string) bool { return true }, latestValue)
+}
+
+// querySeries returns the series of the named query, reducing the points of
+// every series with reduce.
+func (resp *SignozQueryRangeResponse) querySeries(name string, reduce func([]SignozSeriesValue) (float64, bool)) []seriesValue {
+	return resp.series(func(queryName string) bool { return queryName == name }, reduce)
+}
+
+func (resp *SignozQueryRangeResponse) series(match func(queryName string) bool, reduce func([]SignozSeriesValue) (float64, bool)) []seriesValue {
+	var count int
 	for _, qr := range resp.Data.Data.Results {
+		for _, agg := range qr.Aggregations {
+			count += len(agg.Series)
+		}
+	}
+
+	results := make([]seriesValue, 0, count)
+	for _, qr := range resp.Data.Data.Results {
+		if !match(qr.QueryName) {
+			continue
+		}
 		for _, agg := range qr.Aggregations {
 			for _, s := range agg.Series {
-				if len(s.Values) == 0 {
+				value, ok := reduce(s.Values)
+				if !ok {
 					continue
 				}
-				last := s.Values[len(s.Values)-1]
 				results = append(results, seriesValue{
 					Labels: s.LabelMap(),
-					Value:  last.Value,
+					Value:  value,
 				})
 			}
 		}
@@ -48,106 +92,710 @@ func (resp *SignozQueryRangeResponse) Series() []seriesValue {
 	return results
 }
 
+// sumValues returns the sum of the points of values that have a value, the
+// increase over the window for queries of the per-step increase.
+func sumValues(values []SignozSeriesValue) (float64, bool) {
+	var sum float64
+	var found bool
+	for _, v := range values {
+		if value := float64(v.Value); !math.IsNaN(value) {
+			sum += value
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// latestValue returns the last point of values that has a value.
+func latestValue(values []SignozSeriesValue) (float64, bool) {
+	for i := len(values) - 1; i >= 0; i-- {
+		if value := float64(values[i].Value); !math.IsNaN(value) {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// dropZero removes series whose value is zero, for metrics that report zero
+// in place of missing data.
+func dropZero(series []seriesValue) []seriesValue {
+	return slices.DeleteFunc(series, func(s seriesValue) bool {
+		return s.Value == 0
+	})
+}
+
+// topK returns the k series with the highest values, ordered by value.
+// Ties are broken by labels, so the result is stable across queries.
+func topK(series []seriesValue, k int) []seriesValue {
+	if k <= 0 || len(series) <= k {
+		return series
+	}
+	slices.SortFunc(series, func(a, b seriesValue) int {
+		if c := cmp.Compare(b.Value, a.Value); c != 0 {
+			return c
+		}
+		return strings.Compare(labels.Set(a.Labels).String(), labels.Set(b.Labels).String())
+	})
+	return series[:k]
+}
+
+// seriesIndex groups query results by the described object, keyed by the
+// value of the object label qualified with the namespace of the series if it
+// carries one, so that looking up an object does not scan every series and
+// objects of the same name in different namespaces do not collide. It is
+// built once per query result.
+type seriesIndex struct {
+	series   []seriesValue
+	byObject map[string]float64
+	// uniform gives every object the value of the single series, for
+	// synthetic metrics.
+	uniform bool
+}
+
+func newSeriesIndex(series []seriesValue, metric *MetricConfig) *seriesIndex {
+	idx := &seriesIndex{
+		series:   series,
+		byObject: make(map[string]float64, len(series)),
+	}
+	values := map[string][]float64{}
+	objectLabels, namespaceLabel := metric.objectLabels(), metric.namespaceLabel()
+	for _, s := range series {
+		name, ok := lookupObject(s.Labels, objectLabels)
+		if !ok {
+			continue
+		}
+		var namespace string
+		if namespaceLabel != "" {
+			namespace, _ = lookupLabel(s.Labels, namespaceLabel)
+		}
+		key := objectKey(namespace, name)
+		values[key] = append(values[key], s.Value)
+	}
+	for key, v := range values {
+		idx.byObject[key] = combine(metric.valueMode(), v)
+	}
+	return idx
+}
+
+// objectKey returns the index key of the object, qualified with its
+// namespace if known.
+func objectKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// value returns the value of the object in namespace, falling back to series
+// that carry no namespace.
+func (idx *seriesIndex) value(namespace, object string) (float64, bool) {
+	if idx.uniform && len(idx.series) == 1 {
+		return idx.series[0].Value, true
+	}
+	if value, ok := idx.byObject[objectKey(namespace, object)]; ok {
+		return value, true
+	}
+	value, ok := idx.byObject[object]
+	return value, ok
+}
+
+// QueryRange is the time range and resolution of queries.
+type QueryRange struct {
+	// Window is the query time range.
+	Window time.Duration
+	// StepSeconds is the query step. Zero derives it from the window.
+	StepSeconds int64
+}
+
+// Options configures the SigNoz provider.
+type Options struct {
+	// Custom is the query range of the custom metrics API.
+	Custom QueryRange
+	// External is the query range of the external metrics API. Zero fields
+	// default to those of Custom.
+	External QueryRange
+	// Metrics are the metrics exposed by the provider.
+	Metrics []MetricConfig
+	// FilterExpression is added to the filter of every query.
+	FilterExpression string
+	// LabelFilters are added to the filter of every query.
+	LabelFilters []LabelFilter
+	// Poll configures the background poller.
+	Poll PollOptions
+	// Pods filters the pods metrics are served for.
+	Pods PodFilter
+	// PodLabelKeys are the candidate attributes naming pods in priority
+	// order, for metrics without an object label. Empty uses k8s.pod.name.
+	PodLabelKeys []string
+	// NamespaceLabelKey is the attribute holding the namespace of series.
+	// Custom metrics queries are restricted to the namespace of the request
+	// and series are matched by namespace and name. Empty matches by name
+	// only.
+	NamespaceLabelKey string
+	// RateLimit limits incoming metrics API requests.
+	RateLimit RateLimitOptions
+	// MetricTimeout bounds each query of a metric without its own
+	// timeoutSeconds. Zero leaves only the timeout of the SigNoz client.
+	MetricTimeout time.Duration
+	// QueryCacheTTL is how long SigNoz responses are reused for identical
+	// queries of metrics without their own cacheTTLSeconds. Zero disables
+	// the cache.
+	QueryCacheTTL time.Duration
+	// ServeStale answers queries failed fast by an open circuit breaker with
+	// the last successful response to the same query, if it is not older
+	// than BreakerStaleAge.
+	ServeStale bool
+	// MaxStaleAge is how long the values served for an object are kept to
+	// answer requests whose query failed or returned no series for it. Zero
+	// disables the fallback.
+	MaxStaleAge time.Duration
+	// Concurrency limits the metrics API requests served at once.
+	Concurrency ConcurrencyOptions
+	// Shadow compares a sample of queries against their shadow query.
+	Shadow ShadowOptions
+	// ExternalDenyNamespaces are glob patterns of namespaces that may not
+	// read external metrics.
+	ExternalDenyNamespaces []string
+	// MappingExporter, if set, receives the effective queries whenever the
+	// served metrics change.
+	MappingExporter *MappingExporter
+}
+
 type signozProvider struct {
 	defaults.DefaultExternalMetricsProvider
-	client           dynamic.Interface
-	mapper           apimeta.RESTMapper
-	timeRangeMinutes int64
-	signoz           SignozClient
-	metrics          []string
-	filterExpression string
+	opts      Options
+	lister    *objectLister
+	mapper    apimeta.RESTMapper
+	signoz    Querier
+	cache     *queryCache
+	flights   singleflight.Group
+	metrics   atomic.Pointer[[]MetricConfig]
+	settings  atomic.Pointer[QuerySettings]
+	poller    *seriesPoller
+	stale     *staleStore
+	discovery discoveryCache
+	health    *healthTracker
+	limiter   *requestLimiter
+	inflight  *concurrencyLimiter
 }
 
 var _ provider.MetricsProvider = &signozProvider{}
+var _ StatusReporter = &signozProvider{}
+var _ MetricUpdater = &signozProvider{}
 
-func NewSignozProvider(endpoint, apiKey string, timeRangeMinutes int64, metrics []string, filterExpression string, client dynamic.Interface, mapper apimeta.RESTMapper) provider.MetricsProvider {
-	return &signozProvider{
-		client:           client,
-		mapper:           mapper,
-		timeRangeMinutes: timeRangeMinutes,
-		metrics:          metrics,
-		filterExpression: filterExpression,
-		signoz: SignozClient{
-			Http:     http.Client{Timeout: 10 * time.Second},
-			Endpoint: endpoint,
-			ApiKey:   apiKey,
-		},
+// MetricUpdater is implemented by providers whose metrics can be replaced
+// while serving, e.g. by the SignozMetric controller.
+type MetricUpdater interface {
+	// SetMetrics replaces the served metrics. The metrics must be valid.
+	SetMetrics(metrics []MetricConfig)
+	// SetQuerySettings replaces the settings shared by all queries.
+	SetQuerySettings(settings QuerySettings)
+}
+
+// QuerySettings are the settings shared by all queries that can be replaced
+// while serving, see Options.
+type QuerySettings struct {
+	Custom           QueryRange
+	External         QueryRange
+	FilterExpression string
+	LabelFilters     []LabelFilter
+}
+
+func NewSignozProvider(signoz Querier, opts Options, client dynamic.Interface, mapper apimeta.RESTMapper) provider.MetricsProvider {
+	resolveResources(mapper, opts.Metrics)
+	applyLabelKeys(opts.Metrics, opts)
+
+	p := &signozProvider{
+		opts:     opts,
+		lister:   newObjectLister(client, mapper, 0, opts.Pods),
+		mapper:   mapper,
+		signoz:   signoz,
+		cache:    newQueryCache(),
+		stale:    newStaleStore(opts.MaxStaleAge),
+		health:   newHealthTracker(),
+		limiter:  newRequestLimiter(opts.RateLimit),
+		inflight: newConcurrencyLimiter(opts.Concurrency),
+	}
+	p.metrics.Store(&opts.Metrics)
+	resources := listedResources(opts.Metrics)
+	p.lister.allow(resources)
+	// Informers sync in the background. Requests wait for them until their
+	// sync deadline, and so does readiness, see InformersSynced.
+	p.lister.start(resources)
+	p.storeQuerySettings(QuerySettings{
+		Custom:           opts.Custom,
+		External:         opts.External,
+		FilterExpression: opts.FilterExpression,
+		LabelFilters:     opts.LabelFilters,
+	})
+	p.updateDiscovery()
+
+	// In polling mode custom metric requests without a metric selector and
+	// repeated external metric requests are answered from the latest
+	// snapshot instead of querying SigNoz.
+	if opts.Poll.Interval > 0 {
+		p.poller = newSeriesPoller(opts.Poll, opts.Metrics, func(ctx context.Context, metric *MetricConfig) ([]seriesValue, error) {
+			return p.fetchSeries(ctx, metric, labels.Everything(), p.query().Custom)
+		}, func(ctx context.Context, metric *MetricConfig, namespace string, metricSelector labels.Selector) ([]seriesValue, error) {
+			return p.fetchSeries(withQueryScope(ctx, namespace, ""), metric, metricSelector, p.query().External)
+		})
+		go p.poller.run(context.Background())
+	}
+
+	return p
+}
+
+// SetMetrics replaces the served metrics, updating API discovery and the
+// poller, and forgets the health of removed metrics. Requests in flight
+// finish with the metrics they started with.
+func (p *signozProvider) SetMetrics(metrics []MetricConfig) {
+	resolveResources(p.mapper, metrics)
+	applyLabelKeys(metrics, p.opts)
+	previous := p.metrics.Swap(&metrics)
+	if p.poller != nil {
+		p.poller.setMetrics(metrics)
 	}
+	if previous != nil {
+		served := make(map[string]bool, len(metrics))
+		for i := range metrics {
+			served[metrics[i].Name] = true
+		}
+		for i := range *previous {
+			if name := (*previous)[i].Name; !served[name] {
+				p.health.forget(name)
+			}
+		}
+	}
+	resources := listedResources(metrics)
+	p.lister.allow(resources)
+	p.lister.start(resources)
+	p.updateDiscovery()
+}
+
+// InformersSynced returns an error until the informers of the metrics'
+// resources synced or gave up on syncing.
+func (p *signozProvider) InformersSynced() error {
+	return p.lister.synced()
+}
+
+// listedResources returns the resources whose objects are listed for the
+// metrics, including pods for owner rollups.
+func listedResources(metrics []MetricConfig) []schema.GroupResource {
+	var resources []schema.GroupResource
+	for i := range metrics {
+		resources = append(resources, metrics[i].groupResource())
+		if metrics[i].OwnerRollup {
+			resources = append(resources, podsResource)
+		}
+	}
+	slices.SortFunc(resources, func(a, b schema.GroupResource) int { return strings.Compare(a.String(), b.String()) })
+	return slices.Compact(resources)
+}
+
+// SetQuerySettings replaces the settings shared by all queries. If they
+// changed, snapshots of the poller are dropped, as they were queried with the
+// old settings.
+func (p *signozProvider) SetQuerySettings(settings QuerySettings) {
+	previous := p.query()
+	p.storeQuerySettings(settings)
+	if p.query().equal(previous) {
+		return
+	}
+	if p.poller != nil {
+		p.poller.invalidate()
+	}
+	if p.opts.MappingExporter != nil {
+		go p.exportMappings()
+	}
+}
+
+func (s *QuerySettings) equal(o *QuerySettings) bool {
+	return s.Custom == o.Custom && s.External == o.External &&
+		s.FilterExpression == o.FilterExpression && slices.Equal(s.LabelFilters, o.LabelFilters)
 }
 
-func (p *signozProvider) isAllowedMetric(name string) bool {
-	for _, m := range p.metrics {
-		if m == name {
+// storeQuerySettings stores the settings, defaulting the external query range
+// to the custom one.
+func (p *signozProvider) storeQuerySettings(settings QuerySettings) {
+	if settings.External.Window == 0 {
+		settings.External.Window = settings.Custom.Window
+	}
+	if settings.External.StepSeconds == 0 {
+		settings.External.StepSeconds = settings.Custom.StepSeconds
+	}
+	p.settings.Store(&settings)
+}
+
+// query returns the settings shared by all queries.
+func (p *signozProvider) query() *QuerySettings {
+	return p.settings.Load()
+}
+
+// metricList returns the served metrics. The slice must not be modified.
+func (p *signozProvider) metricList() []MetricConfig {
+	return *p.metrics.Load()
+}
+
+// applyLabelKeys sets the attributes naming pods and namespaces of the
+// metrics.
+func applyLabelKeys(metrics []MetricConfig, opts Options) {
+	for i := range metrics {
+		metrics[i].podLabels = opts.PodLabelKeys
+		metrics[i].namespaceKey = opts.NamespaceLabelKey
+	}
+}
+
+// resolveResources canonicalizes the resources of the metrics through the
+// REST mapper, so custom resources can be named by kind or singular, e.g.
+// Fleet.agones.dev for fleets.agones.dev, and takes their scope from the
+// cluster unless namespaced is set. Resources the cluster does not know are
+// left as configured.
+func resolveResources(mapper apimeta.RESTMapper, metrics []MetricConfig) {
+	for i := range metrics {
+		m := &metrics[i]
+		if m.Resource == "" {
+			continue
+		}
+		gr := schema.ParseGroupResource(strings.ToLower(m.Resource))
+		gvr, err := mapper.ResourceFor(gr.WithVersion(""))
+		if err != nil {
+			klog.Warningf("unable to resolve resource %q of metric %s, using it as configured: %v", m.Resource, m.Name, err)
+			continue
+		}
+		if resolved := gvr.GroupResource().String(); resolved != m.Resource {
+			klog.V(2).Infof("resolved resource %q of metric %s to %s", m.Resource, m.Name, resolved)
+			m.Resource = resolved
+		}
+		if m.Namespaced != nil {
+			continue
+		}
+		gvk, err := mapper.KindFor(gvr)
+		if err != nil {
+			continue
+		}
+		if mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			namespaced := mapping.Scope.Name() == apimeta.RESTScopeNameNamespace
+			m.Namespaced = &namespaced
+		}
+	}
+}
+
+// externalDenied reports whether namespace matches one of the external
+// metrics denylist patterns.
+func (p *signozProvider) externalDenied(namespace string) bool {
+	for _, pattern := range p.opts.ExternalDenyNamespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
 			return true
 		}
 	}
 	return false
 }
 
-func (p *signozProvider) buildQuery(metricName string) SignozQueryRangeOptions {
+func (p *signozProvider) metricConfig(name string) (*MetricConfig, bool) {
+	metrics := p.metricList()
+	for i := range metrics {
+		if metrics[i].Name == name {
+			return &metrics[i], true
+		}
+	}
+	return nil, false
+}
+
+// window returns the query window of the metric.
+func window(metric *MetricConfig, r QueryRange) time.Duration {
+	if metric.WindowSeconds > 0 {
+		return time.Duration(metric.WindowSeconds) * time.Second
+	}
+	return r.Window
+}
+
+// step returns the query step of the metric in seconds.
+func step(metric *MetricConfig, r QueryRange) int64 {
+	if metric.StepSeconds > 0 {
+		return metric.StepSeconds
+	}
+	if r.StepSeconds > 0 {
+		return r.StepSeconds
+	}
+	return stepSeconds(window(metric, r))
+}
+
+// metricQuery returns the query of the metric, from its template for PromQL
+// and ClickHouse metrics or else built from its config.
+func (p *signozProvider) metricQuery(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector, r QueryRange) (SignozQueryRangeOptions, error) {
+	if metric.PromQL != "" {
+		return p.promQLQuery(ctx, metric, metricSelector, r)
+	}
+	if metric.ClickHouseSQL != "" {
+		return p.clickHouseQuery(ctx, metric, metricSelector, r)
+	}
+	return p.buildQuery(ctx, metric, metricSelector, r)
+}
+
+func (p *signozProvider) buildQuery(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector, r QueryRange) (SignozQueryRangeOptions, error) {
+	selectorExpression, err := selectorToFilterExpression(metricSelector)
+	if err != nil {
+		return SignozQueryRangeOptions{}, err
+	}
+
+	end := time.Now()
+
+	metricName := metric.Name
+	if metric.Metric != "" {
+		metricName = metric.Metric
+	}
+	labelFilters := metric.LabelFilters
+	timeAggregation := metric.stepAggregation
+	if metric.Function == FunctionIncrease {
+		timeAggregation = "increase"
+	}
+	if agg, ok := timeAggregations[metric.TimeAggregation]; ok {
+		timeAggregation = agg.step
+	}
+	if timeAggregation == "" {
+		timeAggregation = "latest"
+	}
+	if override := metric.scheduleOverride(end); override != nil {
+		if override.Metric != "" {
+			metricName = override.Metric
+		}
+		labelFilters = append(slices.Clone(labelFilters), override.LabelFilters...)
+	}
+
 	query := SignozQuery{
 		Type: "builder_query",
 		Spec: SignozQuerySpec{
 			Name:         "A",
 			Signal:       "metrics",
-			StepInterval: 60,
+			StepInterval: step(metric, r),
 			Aggregations: []SignozMetricAggregation{
 				{
 					MetricName:       metricName,
-					TimeAggregation:  "latest",
-					SpaceAggregation: "sum",
-				},
-			},
-			GroupBy: []SignozQueryGroupBy{
-				{
-					Name:          podLabelKey,
-					FieldDataType: "string",
-					FieldContext:  "resource",
+					TimeAggregation:  timeAggregation,
+					SpaceAggregation: metric.spaceAggregation(),
 				},
 			},
 		},
 	}
 
-	if p.filterExpression != "" {
-		query.Spec.Filter = &SignozQueryFilter{Expression: p.filterExpression}
+	if signal := metric.signal(); signal != SignalMetrics {
+		query.Spec.Signal = signal
+		query.Spec.Aggregations = []SignozMetricAggregation{{Expression: metric.aggregation()}}
+	}
+
+	for _, key := range metric.objectLabelVariants() {
+		query.Spec.GroupBy = append(query.Spec.GroupBy, SignozQueryGroupBy{
+			Name:          key,
+			FieldDataType: "string",
+			FieldContext:  "resource",
+		})
+	}
+	for _, key := range metric.groupByKeys() {
+		query.Spec.GroupBy = append(query.Spec.GroupBy, SignozQueryGroupBy{
+			Name:          key,
+			FieldDataType: "string",
+		})
+	}
+
+	settings := p.query()
+	filter := joinFilterExpressions(
+		settings.FilterExpression,
+		labelFiltersExpression(settings.LabelFilters),
+		metric.FilterExpression,
+		metric.namespaceFilter(queryScopeFrom(ctx)),
+		labelFiltersExpression(labelFilters),
+		selectorExpression,
+	)
+	if filter != "" {
+		query.Spec.Filter = &SignozQueryFilter{Expression: filter}
+	}
+
+	if metric.Apdex != nil {
+		query = metric.Apdex.apdexQuery(query)
+	}
+
+	queries := []SignozQuery{query}
+	if metric.Formula != nil {
+		queries = metric.Formula.formulaQueries(query)
 	}
 
 	return SignozQueryRangeOptions{
 		RequestType: "time_series",
-		Start:       time.Now().Add(-time.Duration(p.timeRangeMinutes) * time.Minute).UnixMilli(),
-		End:         time.Now().UnixMilli(),
+		Start:       end.Add(-window(metric, r)).UnixMilli(),
+		End:         end.UnixMilli(),
 		CompositeQuery: SignozCompositeQuery{
-			Queries: []SignozQuery{query},
+			Queries: queries,
 		},
+	}, nil
+}
+
+// timeout returns the query budget of the metric.
+func (p *signozProvider) timeout(metric *MetricConfig) time.Duration {
+	if metric.TimeoutSeconds > 0 {
+		return time.Duration(metric.TimeoutSeconds) * time.Second
 	}
+	return p.opts.MetricTimeout
 }
 
-func (p *signozProvider) GetMetricByName(_ context.Context, name types.NamespacedName, info provider.CustomMetricInfo, _ labels.Selector) (*custom_metrics.MetricValue, error) {
-	if !p.isAllowedMetric(info.Metric) {
-		return nil, provider.NewMetricNotFoundForError(info.GroupResource, info.Metric, name.Name)
+// fetchSeries queries SigNoz for the metric and returns the relabeled series,
+// widening the window once if the gap-fill policy asks for it, rolled up to
+// the owners of the pods for metrics with ownerRollup.
+func (p *signozProvider) fetchSeries(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector, r QueryRange) ([]seriesValue, error) {
+	if timeout := p.timeout(metric); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	queryResponse, err := p.signoz.Query(p.buildQuery(info.Metric))
+	series, err := p.fetchWindow(ctx, metric, metricSelector, r)
+	if err == nil && len(series) == 0 {
+		if wider := metric.widened(window(metric, r)); wider != nil {
+			klog.V(2).Infof("no datapoints for %s in %s, widening the window to %s", metric.Name, window(metric, r), window(wider, r))
+			series, err = p.fetchWindow(ctx, wider, metricSelector, r)
+		}
+	}
+	if err == nil && metric.OwnerRollup {
+		return p.rollupOwners(ctx, metric, series)
+	}
+	return series, err
+}
+
+// fetchWindow queries the metric over its window.
+func (p *signozProvider) fetchWindow(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector, r QueryRange) ([]seriesValue, error) {
+	if metric.Synthetic != nil {
+		series := syntheticSeries(metric)
+		p.health.record(metric.Name, SignozQueryRangeOptions{}, len(series), nil)
+		return scheduleSeries(metric, series), nil
+	}
+	if metric.derived() {
+		series, err := p.derivedSeries(ctx, metric, metricSelector, r)
+		p.health.record(metric.Name, SignozQueryRangeOptions{}, len(series), err)
+		return scheduleSeries(metric, series), err
+	}
+
+	query, err := p.metricQuery(ctx, metric, metricSelector, r)
 	if err != nil {
 		return nil, err
 	}
 
-	series := queryResponse.Series()
-	var total float64
-	var found bool
+	queryResponse, staleAge, err := p.cachedQuery(ctx, metric, query)
+	if err != nil {
+		p.health.record(metric.Name, query, 0, err)
+		return nil, toAPIError(err)
+	}
 
-	for _, s := range series {
-		if s.Labels[podLabelKey] == name.Name {
-			total += s.Value
-			found = true
+	if unit := queryResponse.responseUnit(); unit != "" {
+		p.health.recordUnit(metric.Name, unit)
+	}
+
+	var series []seriesValue
+	reduce := metric.reduce()
+	all := func(string) bool { return true }
+	if metric.Formula != nil {
+		series = metric.Formula.formulaSeries(queryResponse, reduce, metric.formulaReduce())
+	} else if metric.Apdex != nil {
+		series = metric.Apdex.apdexSeries(queryResponse.series(all, reduce))
+	} else {
+		series = queryResponse.series(all, reduce)
+	}
+	series = relabelSeries(series, metric.Relabel)
+	if metric.ZeroIsMissing {
+		series = dropZero(series)
+	}
+	series = topK(series, metric.TopK)
+	if staleAge > 0 {
+		return scheduleSeries(metric, series), nil
+	}
+	p.health.record(metric.Name, query, len(series), nil)
+	if p.shadowSampled(metric) {
+		go p.shadowCompare(metric, query, slices.Clone(series))
+	}
+	return scheduleSeries(metric, series), nil
+}
+
+// index returns the indexed series for the metric, from the poller snapshot
+// when possible.
+func (p *signozProvider) index(ctx context.Context, metric *MetricConfig, metricSelector labels.Selector) (*seriesIndex, error) {
+	if metric.Synthetic != nil {
+		series, err := p.fetchSeries(ctx, metric, metricSelector, p.query().Custom)
+		if err != nil {
+			return nil, err
+		}
+		return &seriesIndex{series: series, uniform: true}, nil
+	}
+	if p.poller != nil && (metricSelector == nil || metricSelector.Empty()) {
+		if snapshot, ok := p.poller.get(metric.Name); ok {
+			return snapshot.index, nil
+		}
+	}
+
+	series, err := p.fetchSeries(ctx, metric, metricSelector, p.query().Custom)
+	if err != nil {
+		return nil, err
+	}
+	return newSeriesIndex(series, metric), nil
+}
+
+func (p *signozProvider) GetMetricByName(ctx context.Context, name types.NamespacedName, info provider.CustomMetricInfo, metricSelector labels.Selector) (*custom_metrics.MetricValue, error) {
+	attribute(ctx, "custom", info.Metric, name.Namespace)
+	ctx = withObjectScope(ctx, name.Namespace, name.Name)
+	if err := p.limiter.allow(ctx, "custom", name.Namespace); err != nil {
+		return nil, err
+	}
+	release, err := p.inflight.acquire(ctx, "custom")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	metric, ok := p.metricConfig(info.Metric)
+	if !ok || metric.groupResource() != info.GroupResource || !metric.servedIn(name.Namespace) {
+		return nil, provider.NewMetricNotFoundForError(info.GroupResource, info.Metric, name.Name)
+	}
+
+	key := staleKey(metric.Name, name.Namespace, name.Name, metricSelector)
+	index, err := p.index(ctx, metric, metricSelector)
+	if err != nil {
+		if series, fetched, ok := p.recallStale(metric, key, err); ok {
+			return p.metricValue(metric, name, info, series[0].Value, metav1.NewTime(fetched))
+		}
+		return nil, err
+	}
+
+	if len(index.series) == 0 {
+		fallback, ok := metric.fallback()
+		if !ok {
+			if series, fetched, ok := p.recallStale(metric, key, nil); ok {
+				return p.metricValue(metric, name, info, series[0].Value, metav1.NewTime(fetched))
+			}
+			return nil, provider.NewMetricNotFoundForError(info.GroupResource, info.Metric, name.Name)
 		}
+		return p.metricValue(metric, name, info, fallback, metav1.Now())
 	}
+
+	total, found := index.value(name.Namespace, name.Name)
 	if !found {
-		for _, s := range series {
-			total += s.Value
+		if series, fetched, ok := p.recallStale(metric, key, nil); ok {
+			return p.metricValue(metric, name, info, series[0].Value, metav1.NewTime(fetched))
+		}
+		if missing, ok, _ := metric.missingValue(); ok {
+			return p.metricValue(metric, name, info, missing, metav1.Now())
+		}
+		if metric.MissingValuePolicy != missingAggregate {
+			return nil, provider.NewMetricNotFoundForError(info.GroupResource, info.Metric, name.Name)
+		}
+		values := make([]float64, len(index.series))
+		for i, s := range index.series {
+			values[i] = s.Value
 		}
+		total = combine(metric.valueMode(), values)
 	}
+	p.stale.remember(key, []seriesValue{{Value: total}})
 
+	return p.metricValue(metric, name, info, total, metav1.Now())
+}
+
+// metricValue returns the custom metric value of the object.
+func (p *signozProvider) metricValue(metric *MetricConfig, name types.NamespacedName, info provider.CustomMetricInfo, value float64, timestamp metav1.Time) (*custom_metrics.MetricValue, error) {
 	objRef, err := helpers.ReferenceFor(p.mapper, name, info)
 	if err != nil {
 		return nil, err
@@ -156,46 +804,93 @@ func (p *signozProvider) GetMetricByName(_ context.Context, name types.Namespace
 	return &custom_metrics.MetricValue{
 		DescribedObject: objRef,
 		Metric:          custom_metrics.MetricIdentifier{Name: info.Metric},
-		Timestamp:       metav1.Now(),
-		Value:           *resource.NewQuantity(int64(math.Round(total)), resource.DecimalSI),
+		Timestamp:       timestamp,
+		Value:           p.quantity(metric, value),
 	}, nil
 }
 
-func (p *signozProvider) GetMetricBySelector(_ context.Context, namespace string, selector labels.Selector, info provider.CustomMetricInfo, _ labels.Selector) (*custom_metrics.MetricValueList, error) {
-	if !p.isAllowedMetric(info.Metric) {
-		return &custom_metrics.MetricValueList{}, nil
+// recallStale returns the values last served for key, if the stale-value
+// fallback is enabled and they are recent enough. err is the failure of the
+// query, nil if it returned no series.
+func (p *signozProvider) recallStale(metric *MetricConfig, key string, err error) ([]seriesValue, time.Time, bool) {
+	series, fetched, ok := p.stale.recall(key)
+	if !ok {
+		return nil, time.Time{}, false
 	}
+	staleValues.WithLabelValues(metric.Name).Inc()
+	if err != nil {
+		klog.V(2).Infof("serving values of metric %s from %s ago: %v", metric.Name, time.Since(fetched).Round(time.Second), err)
+	}
+	return series, fetched, true
+}
 
-	queryResponse, err := p.signoz.Query(p.buildQuery(info.Metric))
+func (p *signozProvider) GetMetricBySelector(ctx context.Context, namespace string, selector labels.Selector, info provider.CustomMetricInfo, metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+	attribute(ctx, "custom", info.Metric, namespace)
+	ctx = withObjectScope(ctx, namespace, "")
+	if err := p.limiter.allow(ctx, "custom", namespace); err != nil {
+		return nil, err
+	}
+	release, err := p.inflight.acquire(ctx, "custom")
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+	metric, ok := p.metricConfig(info.Metric)
+	if !ok || metric.groupResource() != info.GroupResource || !metric.servedIn(namespace) {
+		return &custom_metrics.MetricValueList{}, nil
+	}
 
-	series := queryResponse.Series()
+	index, queryErr := p.index(ctx, metric, metricSelector)
+	fresh := queryErr == nil
+	if queryErr != nil {
+		if p.stale == nil {
+			return nil, queryErr
+		}
+		// Answer with the stale values of the objects, if any.
+		index = &seriesIndex{}
+	} else if len(index.series) == 0 {
+		fallback, ok := metric.fallback()
+		if !ok && p.stale == nil {
+			return nil, provider.NewMetricNotFoundError(info.GroupResource, info.Metric)
+		}
+		if ok {
+			index = &seriesIndex{series: []seriesValue{{Value: fallback}}, uniform: true}
+			fresh = false
+		}
+	}
 
-	podNames, err := helpers.ListObjectNames(p.mapper, p.client, namespace, selector, info)
+	objectNames, err := p.lister.ListObjectNames(ctx, namespace, selector, info)
 	if err != nil {
 		return nil, err
 	}
 
-	klog.V(2).Infof("matched %d pods, got %d series from signoz", len(podNames), len(series))
+	klog.V(2).Infof("matched %d %s, got %d series from signoz", len(objectNames), info.GroupResource.String(), len(index.series))
 
-	byPod := map[string]float64{}
-	for _, s := range series {
-		if pod, ok := s.Labels[podLabelKey]; ok {
-			byPod[pod] += s.Value
-		}
-	}
+	missing, fillMissing, _ := metric.missingValue()
+	fillMissing = fillMissing && fresh && len(index.series) > 0
 
 	var items []custom_metrics.MetricValue
-	for _, podName := range podNames {
-		value, ok := byPod[podName]
-		if !ok {
-			klog.V(2).Infof("no signoz series for pod %s, skipping", podName)
+	var stale, filled int
+	for _, objectName := range objectNames {
+		key := staleKey(metric.Name, namespace, objectName, metricSelector)
+		timestamp := metav1.Now()
+		value, ok := index.value(namespace, objectName)
+		if ok {
+			if fresh {
+				p.stale.remember(key, []seriesValue{{Value: value}})
+			}
+		} else if series, fetched, found := p.recallStale(metric, key, queryErr); found {
+			value, timestamp = series[0].Value, metav1.NewTime(fetched)
+			stale++
+		} else if fillMissing {
+			value = missing
+			filled++
+		} else {
+			klog.V(2).Infof("no signoz series for %s %s, skipping", info.GroupResource.String(), objectName)
 			continue
 		}
 
-		name := types.NamespacedName{Name: podName, Namespace: namespace}
+		name := types.NamespacedName{Name: objectName, Namespace: namespace}
 		objRef, err := helpers.ReferenceFor(p.mapper, name, info)
 		if err != nil {
 			return nil, err
@@ -204,36 +899,149 @@ func (p *signozProvider) GetMetricBySelector(_ context.Context, namespace string
 		items = append(items, custom_metrics.MetricValue{
 			DescribedObject: objRef,
 			Metric:          custom_metrics.MetricIdentifier{Name: info.Metric},
-			Timestamp:       metav1.Now(),
-			Value:           *resource.NewQuantity(int64(math.Round(value)), resource.DecimalSI),
+			Timestamp:       timestamp,
+			Value:           p.quantity(metric, value),
 		})
 	}
+	if queryErr != nil && len(items) == 0 {
+		return nil, queryErr
+	}
+	if len(index.series) == 0 && len(items) == 0 {
+		return nil, provider.NewMetricNotFoundError(info.GroupResource, info.Metric)
+	}
+	p.health.recordCoverage(metric.Name, len(objectNames), len(items)-stale-filled)
 
 	return &custom_metrics.MetricValueList{Items: items}, nil
 }
 
+// updateDiscovery recomputes the metric lists served to API discovery from
+// the configured metrics.
+func (p *signozProvider) updateDiscovery() {
+	var custom []provider.CustomMetricInfo
+	var external []provider.ExternalMetricInfo
+	for _, m := range p.metricList() {
+		custom = append(custom, provider.CustomMetricInfo{
+			GroupResource: m.groupResource(),
+			Metric:        m.Name,
+			Namespaced:    m.namespaced(),
+		})
+		external = append(external, provider.ExternalMetricInfo{Metric: m.Name})
+	}
+	if p.discovery.update(custom, external) && p.opts.MappingExporter != nil {
+		go p.exportMappings()
+	}
+}
+
+// exportMappings writes the effective query of every metric to the mapping
+// exporter.
+func (p *signozProvider) exportMappings() {
+	mappings := map[string]metricMapping{}
+	metrics := p.metricList()
+	for i := range metrics {
+		metric := &metrics[i]
+		if metric.derived() {
+			mappings[metric.Name] = metricMapping{Expression: metric.Expression}
+			continue
+		}
+		if metric.Synthetic != nil {
+			mappings[metric.Name] = metricMapping{Synthetic: metric.Synthetic}
+			continue
+		}
+		query, err := p.metricQuery(context.Background(), metric, labels.Everything(), p.query().Custom)
+		if err != nil {
+			klog.Errorf("failed to build query for metric %s: %v", metric.Name, err)
+			continue
+		}
+		mappings[metric.Name] = metricMapping{
+			Window:         window(metric, p.query().Custom).String(),
+			CompositeQuery: query.CompositeQuery,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := p.opts.MappingExporter.Export(ctx, mappings); err != nil {
+		klog.Errorf("failed to export metric mappings: %v", err)
+	}
+}
+
 func (p *signozProvider) ListAllMetrics() []provider.CustomMetricInfo {
-	var infos []provider.CustomMetricInfo
-	for _, m := range p.metrics {
-		infos = append(infos, provider.CustomMetricInfo{
-			GroupResource: schema.GroupResource{Group: "", Resource: "pods"},
-			Metric:        m,
-			Namespaced:    true,
+	return p.discovery.customMetrics()
+}
+
+// GetExternalMetric returns one value per series of the metric. Each value
+// carries the labels of the series that produced it, so HPA selectors and
+// humans can verify which series they are scaling on.
+func (p *signozProvider) GetExternalMetric(ctx context.Context, namespace string, metricSelector labels.Selector, info provider.ExternalMetricInfo) (*external_metrics.ExternalMetricValueList, error) {
+	attribute(ctx, "external", info.Metric, namespace)
+	ctx = withQueryScope(ctx, namespace, "")
+	if err := p.limiter.allow(ctx, "external", namespace); err != nil {
+		return nil, err
+	}
+	release, err := p.inflight.acquire(ctx, "external")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if p.externalDenied(namespace) {
+		return nil, apierr.NewForbidden(schema.GroupResource{Group: external_metrics.GroupName, Resource: info.Metric}, "",
+			fmt.Errorf("namespace %q may not read external metrics", namespace))
+	}
+	metric, ok := p.metricConfig(info.Metric)
+	if !ok || !metric.servedIn(namespace) {
+		return nil, provider.NewMetricNotFoundError(schema.GroupResource{Group: external_metrics.GroupName}, info.Metric)
+	}
+
+	key := staleKey(metric.Name, namespace, "", metricSelector)
+	now := metav1.Now()
+	series, err := p.externalSeries(ctx, metric, namespace, metricSelector)
+	series = metric.combineExternal(series)
+	if err != nil {
+		stale, fetched, ok := p.recallStale(metric, key, err)
+		if !ok {
+			return nil, err
+		}
+		series, now = stale, metav1.NewTime(fetched)
+	} else if len(series) == 0 {
+		fallback, ok := metric.fallback()
+		if ok {
+			series = []seriesValue{{Value: fallback}}
+		} else if stale, fetched, ok := p.recallStale(metric, key, nil); ok {
+			series, now = stale, metav1.NewTime(fetched)
+		} else {
+			return nil, provider.NewMetricNotFoundError(schema.GroupResource{Group: external_metrics.GroupName}, info.Metric)
+		}
+	} else {
+		p.stale.remember(key, series)
+	}
+
+	items := make([]external_metrics.ExternalMetricValue, 0, len(series))
+	for _, s := range series {
+		items = append(items, external_metrics.ExternalMetricValue{
+			MetricName:   info.Metric,
+			MetricLabels: s.Labels,
+			Timestamp:    now,
+			Value:        p.quantity(metric, s.Value),
 		})
 	}
-	return infos
+	slices.SortFunc(items, func(a, b external_metrics.ExternalMetricValue) int {
+		return strings.Compare(labels.Set(a.MetricLabels).String(), labels.Set(b.MetricLabels).String())
+	})
+
+	return &external_metrics.ExternalMetricValueList{Items: items}, nil
 }
 
-func (p *signozProvider) GetExternalMetric(_ context.Context, _ string, _ labels.Selector, info provider.ExternalMetricInfo) (*external_metrics.ExternalMetricValueList, error) {
-	return &external_metrics.ExternalMetricValueList{
-		Items: []external_metrics.ExternalMetricValue{},
-	}, nil
+// externalSeries returns the series of the external metric, from the poller
+// snapshot when possible.
+func (p *signozProvider) externalSeries(ctx context.Context, metric *MetricConfig, namespace string, metricSelector labels.Selector) ([]seriesValue, error) {
+	if p.poller != nil && metric.Synthetic == nil {
+		if snapshot, ok := p.poller.getExternal(metric.Name, namespace, metricSelector); ok {
+			return slices.Clone(snapshot.series), nil
+		}
+	}
+	return p.fetchSeries(ctx, metric, metricSelector, p.query().External)
 }
 
 func (p *signozProvider) ListAllExternalMetrics() []provider.ExternalMetricInfo {
-	var infos []provider.ExternalMetricInfo
-	for _, m := range p.metrics {
-		infos = append(infos, provider.ExternalMetricInfo{Metric: m})
-	}
-	return infos
+	return p.discovery.externalMetrics()
 }
@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BreakerStaleAge bounds the age of last-known-good responses served while
+// the circuit breaker is open.
+const BreakerStaleAge = 10 * time.Minute
+
+// queryCache holds SigNoz responses for a short time, so HPAs requesting the
+// same metric within the TTL share one query. Entries are keyed by the
+// composite query and the length of its window rather than its start and
+// end, which move with every request. It also keeps the last successful
+// response of every query, to be served while SigNoz is unavailable.
+type queryCache struct {
+	mu       sync.Mutex
+	entries  map[string]queryCacheEntry
+	lastGood map[string]queryCacheEntry
+}
+
+type queryCacheEntry struct {
+	response *SignozQueryRangeResponse
+	fetched  time.Time
+	expiry   time.Time
+}
+
+func newQueryCache() *queryCache {
+	return &queryCache{entries: map[string]queryCacheEntry{}, lastGood: map[string]queryCacheEntry{}}
+}
+
+// queryCacheKey returns the cache key of query, or false if it cannot be
+// encoded.
+func queryCacheKey(query SignozQueryRangeOptions) (string, bool) {
+	data, err := json.Marshal(query.CompositeQuery)
+	if err != nil {
+		return "", false
+	}
+	return query.RequestType + "/" + strconv.FormatInt(query.End-query.Start, 10) + "/" + string(data), true
+}
+
+// get returns the unexpired response cached for key.
+func (c *queryCache) get(key string) (*SignozQueryRangeResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !time.Now().Before(entry.expiry) {
+		return nil, false
+	}
+	return entry.response, true
+}
+
+// put caches response for key for ttl, dropping expired entries.
+func (c *queryCache) put(key string, response *SignozQueryRangeResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expiry) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = queryCacheEntry{response: response, fetched: now, expiry: now.Add(ttl)}
+}
+
+// keep stores response as the last-known-good response of key, dropping
+// those older than maxAge.
+func (c *queryCache) keep(key string, response *SignozQueryRangeResponse, maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.lastGood {
+		if !now.Before(entry.expiry) {
+			delete(c.lastGood, k)
+		}
+	}
+	c.lastGood[key] = queryCacheEntry{response: response, fetched: now, expiry: now.Add(maxAge)}
+}
+
+// lastKnownGood returns the last successful response of key and its age, if
+// it is not older than the age it was kept for.
+func (c *queryCache) lastKnownGood(key string) (*SignozQueryRangeResponse, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.lastGood[key]
+	if !ok || !time.Now().Before(entry.expiry) {
+		return nil, 0, false
+	}
+	return entry.response, time.Since(entry.fetched), true
+}
+
+// cacheTTL returns how long responses of the metric are cached.
+func (p *signozProvider) cacheTTL(metric *MetricConfig) time.Duration {
+	if metric.CacheTTLSeconds > 0 {
+		return time.Duration(metric.CacheTTLSeconds) * time.Second
+	}
+	return p.opts.QueryCacheTTL
+}
+
+// cachedQuery sends query to SigNoz unless a response to the same query is
+// cached. Failed queries are not cached. If the query failed fast because
+// the circuit breaker is open, the last successful response is returned
+// with its age when serving stale responses is enabled.
+func (p *signozProvider) cachedQuery(ctx context.Context, metric *MetricConfig, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, time.Duration, error) {
+	key, ok := queryCacheKey(query)
+	if !ok {
+		response, err := p.signoz.Query(ctx, query)
+		return response, 0, err
+	}
+	ttl := p.cacheTTL(metric)
+	if ttl > 0 {
+		if response, ok := p.cache.get(key); ok {
+			queryCacheHits.WithLabelValues(metric.Name).Inc()
+			return response, 0, nil
+		}
+		queryCacheMisses.WithLabelValues(metric.Name).Inc()
+	}
+
+	response, err := p.sharedQuery(ctx, metric, key, query)
+	if err != nil {
+		if p.opts.ServeStale && errors.Is(err, ErrCircuitOpen) {
+			if stale, age, ok := p.cache.lastKnownGood(key); ok {
+				staleResponses.WithLabelValues(metric.Name).Inc()
+				p.health.recordStale(metric.Name, age, err)
+				return stale, age, nil
+			}
+		}
+		return nil, 0, err
+	}
+	if ttl > 0 {
+		p.cache.put(key, response, ttl)
+	}
+	if p.opts.ServeStale {
+		p.cache.keep(key, response, BreakerStaleAge)
+	}
+	return response, 0, nil
+}
+
+// sharedQuery sends query to SigNoz, or waits for the identical query
+// already in flight, so concurrent requests of HPAs scaling on the same
+// metric cause one upstream query. The query is not cancelled when the
+// request that started it is, as others may be waiting for it, but it is
+// still bounded by the timeout of the metric.
+func (p *signozProvider) sharedQuery(ctx context.Context, metric *MetricConfig, key string, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error) {
+	results := p.flights.DoChan(key, func() (any, error) {
+		queryCtx := context.WithoutCancel(ctx)
+		if timeout := p.timeout(metric); timeout > 0 {
+			var cancel context.CancelFunc
+			queryCtx, cancel = context.WithTimeout(queryCtx, timeout)
+			defer cancel()
+		}
+		return p.signoz.Query(queryCtx, query)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Shared {
+			coalescedQueries.WithLabelValues(metric.Name).Inc()
+		}
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*SignozQueryRangeResponse), nil
+	}
+}
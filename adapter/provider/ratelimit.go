@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// RateLimitOptions limits the rate of metrics API requests per requesting
+// namespace or user.
+type RateLimitOptions struct {
+	// QPS is the sustained number of requests per second allowed per key.
+	// Zero disables rate limiting.
+	QPS float64
+	// Burst is the number of requests allowed at once per key.
+	Burst int
+	// By selects the key requests are limited by, namespace or user.
+	By string
+}
+
+// limiterIdleTimeout drops the limiter of a key that made no requests for
+// this long.
+const limiterIdleTimeout = 10 * time.Minute
+
+type keyedLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// requestLimiter applies a token bucket per namespace or user, so a runaway
+// controller is throttled without affecting other clients.
+type requestLimiter struct {
+	opts RateLimitOptions
+
+	mu        sync.Mutex
+	limiters  map[string]*keyedLimiter
+	lastPrune time.Time
+}
+
+func newRequestLimiter(opts RateLimitOptions) *requestLimiter {
+	return &requestLimiter{opts: opts, limiters: map[string]*keyedLimiter{}}
+}
+
+// allow returns a TooManyRequests error if the namespace or user of the
+// request exceeded its rate.
+func (l *requestLimiter) allow(ctx context.Context, api, namespace string) error {
+	if l == nil || l.opts.QPS <= 0 {
+		return nil
+	}
+
+	key := namespace
+	if l.opts.By == "user" {
+		key = requester(ctx)
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	entry, ok := l.limiters[key]
+	if !ok {
+		entry = &keyedLimiter{limiter: rate.NewLimiter(rate.Limit(l.opts.QPS), l.opts.Burst)}
+		l.limiters[key] = entry
+	}
+	entry.lastSeen = now
+	l.prune(now)
+	allowed := entry.limiter.AllowN(now, 1)
+	l.mu.Unlock()
+
+	if allowed {
+		return nil
+	}
+	rateLimitedRequests.WithLabelValues(api).Inc()
+	retryAfter := int(math.Ceil(1 / l.opts.QPS))
+	return apierr.NewTooManyRequests(fmt.Sprintf("rate limit of %g requests per second exceeded for %s %q", l.opts.QPS, l.opts.By, key), retryAfter)
+}
+
+// prune drops idle limiters, at most once per idle timeout. It must be
+// called with mu held.
+func (l *requestLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < limiterIdleTimeout {
+		return
+	}
+	l.lastPrune = now
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) > limiterIdleTimeout {
+			delete(l.limiters, key)
+		}
+	}
+}
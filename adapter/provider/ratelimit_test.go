@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	hpa := request.WithUser(context.Background(), &user.DefaultInfo{Name: "system:serviceaccount:kube-system:horizontal-pod-autoscaler"})
+	operator := request.WithUser(context.Background(), &user.DefaultInfo{Name: "operator"})
+	type call struct {
+		ctx       context.Context
+		namespace string
+		allowed   bool
+	}
+	tests := []struct {
+		name  string
+		opts  RateLimitOptions
+		calls []call
+	}{
+		{
+			name: "disabled",
+			opts: RateLimitOptions{Burst: 1, By: "namespace"},
+			calls: []call{
+				{ctx: hpa, namespace: "a", allowed: true},
+				{ctx: hpa, namespace: "a", allowed: true},
+			},
+		},
+		{
+			name: "per namespace",
+			opts: RateLimitOptions{QPS: 0.01, Burst: 2, By: "namespace"},
+			calls: []call{
+				{ctx: hpa, namespace: "a", allowed: true},
+				{ctx: operator, namespace: "a", allowed: true},
+				{ctx: hpa, namespace: "a"},
+				{ctx: hpa, namespace: "b", allowed: true},
+			},
+		},
+		{
+			name: "per user",
+			opts: RateLimitOptions{QPS: 0.01, Burst: 1, By: "user"},
+			calls: []call{
+				{ctx: hpa, namespace: "a", allowed: true},
+				{ctx: hpa, namespace: "b"},
+				{ctx: operator, namespace: "a", allowed: true},
+				{ctx: context.Background(), namespace: "a", allowed: true},
+				{ctx: context.Background(), namespace: "b"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRequestLimiter(tt.opts)
+			for i, c := range tt.calls {
+				err := l.allow(c.ctx, "custom", c.namespace)
+				if c.allowed && err != nil {
+					t.Fatalf("call %d: got %v, want allowed", i, err)
+				}
+				if !c.allowed && !apierr.IsTooManyRequests(err) {
+					t.Fatalf("call %d: got %v, want too many requests", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLimiterRetryAfter(t *testing.T) {
+	l := newRequestLimiter(RateLimitOptions{QPS: 0.5, Burst: 1, By: "namespace"})
+	l.allow(context.Background(), "custom", "a")
+	err := l.allow(context.Background(), "custom", "a")
+	if delay, ok := apierr.SuggestsClientDelay(err); !ok || delay != 2 {
+		t.Fatalf("got retry after %d, %v, want 2s", delay, ok)
+	}
+}
+
+func TestRequestLimiterPrunesIdleKeys(t *testing.T) {
+	l := newRequestLimiter(RateLimitOptions{QPS: 1, Burst: 1, By: "namespace"})
+	l.allow(context.Background(), "custom", "a")
+	l.allow(context.Background(), "custom", "b")
+
+	l.mu.Lock()
+	l.limiters["a"].lastSeen = time.Now().Add(-2 * limiterIdleTimeout)
+	l.lastPrune = time.Now().Add(-2 * limiterIdleTimeout)
+	l.mu.Unlock()
+	l.allow(context.Background(), "custom", "c")
+
+	if _, ok := l.limiters["a"]; ok {
+		t.Fatal("idle limiter kept")
+	}
+	if len(l.limiters) != 2 {
+		t.Fatalf("got %d limiters, want b and c", len(l.limiters))
+	}
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RelabelConfig is a Prometheus-style relabeling rule applied to the labels
+// of SigNoz series.
+type RelabelConfig struct {
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+	Separator    string   `json:"separator,omitempty"`   // defaults to ";"
+	Regex        string   `json:"regex,omitempty"`       // defaults to "(.*)"
+	TargetLabel  string   `json:"targetLabel,omitempty"` // required for replace
+	Replacement  string   `json:"replacement,omitempty"` // defaults to "$1"
+	Action       string   `json:"action,omitempty"`      // replace, keep, drop, labelmap, labeldrop, labelkeep
+
+	regex *regexp.Regexp
+}
+
+func (r *RelabelConfig) compile() error {
+	if r.Separator == "" {
+		r.Separator = ";"
+	}
+	if r.Regex == "" {
+		r.Regex = "(.*)"
+	}
+	if r.Replacement == "" {
+		r.Replacement = "$1"
+	}
+	if r.Action == "" {
+		r.Action = "replace"
+	}
+
+	switch r.Action {
+	case "replace":
+		if r.TargetLabel == "" {
+			return fmt.Errorf("targetLabel is required for action replace")
+		}
+	case "keep", "drop":
+		if len(r.SourceLabels) == 0 {
+			return fmt.Errorf("sourceLabels are required for action %s", r.Action)
+		}
+	case "labelmap", "labeldrop", "labelkeep":
+	default:
+		return fmt.Errorf("unknown relabel action %q", r.Action)
+	}
+
+	regex, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+	}
+	r.regex = regex
+	return nil
+}
+
+// relabel applies the rules in order and returns the resulting labels, or
+// false if the series was dropped.
+func relabel(labels map[string]string, rules []RelabelConfig) (map[string]string, bool) {
+	if len(rules) == 0 {
+		return labels, true
+	}
+
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		values := make([]string, len(r.SourceLabels))
+		for j, name := range r.SourceLabels {
+			values[j] = out[name]
+		}
+		value := strings.Join(values, r.Separator)
+
+		switch r.Action {
+		case "keep":
+			if !r.regex.MatchString(value) {
+				return nil, false
+			}
+		case "drop":
+			if r.regex.MatchString(value) {
+				return nil, false
+			}
+		case "replace":
+			indexes := r.regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			target := string(r.regex.ExpandString(nil, r.TargetLabel, value, indexes))
+			replacement := string(r.regex.ExpandString(nil, r.Replacement, value, indexes))
+			if replacement == "" {
+				delete(out, target)
+			} else {
+				out[target] = replacement
+			}
+		case "labelmap":
+			mapped := map[string]string{}
+			for k, v := range out {
+				if r.regex.MatchString(k) {
+					mapped[r.regex.ReplaceAllString(k, r.Replacement)] = v
+				}
+			}
+			for k, v := range mapped {
+				out[k] = v
+			}
+		case "labeldrop":
+			for k := range out {
+				if r.regex.MatchString(k) {
+					delete(out, k)
+				}
+			}
+		case "labelkeep":
+			for k := range out {
+				if !r.regex.MatchString(k) {
+					delete(out, k)
+				}
+			}
+		}
+	}
+
+	return out, true
+}
+
+// relabelSeries applies the rules to every series, dropping series that are
+// filtered out by keep/drop actions.
+func relabelSeries(series []seriesValue, rules []RelabelConfig) []seriesValue {
+	if len(rules) == 0 {
+		return series
+	}
+
+	results := series[:0]
+	for _, s := range series {
+		labels, ok := relabel(s.Labels, rules)
+		if !ok {
+			continue
+		}
+		s.Labels = labels
+		results = append(results, s)
+	}
+	return results
+}
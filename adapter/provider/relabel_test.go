@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestRelabel(t *testing.T) {
+	labels := map[string]string{"k8s.pod.name": "api-7d9f-x2x", "k8s.namespace.name": "prod", "env": "blue"}
+	tests := []struct {
+		name  string
+		rules []RelabelConfig
+		want  map[string]string // nil if the series is dropped
+	}{
+		{
+			name:  "no rules",
+			rules: nil,
+			want:  labels,
+		},
+		{
+			name:  "replace with capture",
+			rules: []RelabelConfig{{SourceLabels: []string{"k8s.pod.name"}, Regex: "(.*)-[^-]+-[^-]+", TargetLabel: "app"}},
+			want:  map[string]string{"k8s.pod.name": "api-7d9f-x2x", "k8s.namespace.name": "prod", "env": "blue", "app": "api"},
+		},
+		{
+			name:  "replace joins source labels",
+			rules: []RelabelConfig{{SourceLabels: []string{"k8s.namespace.name", "env"}, Separator: "/", TargetLabel: "deployment", Replacement: "$1-primary"}},
+			want:  map[string]string{"k8s.pod.name": "api-7d9f-x2x", "k8s.namespace.name": "prod", "env": "blue", "deployment": "prod/blue-primary"},
+		},
+		{
+			name:  "replace without match",
+			rules: []RelabelConfig{{SourceLabels: []string{"env"}, Regex: "green", TargetLabel: "env", Replacement: "g"}},
+			want:  labels,
+		},
+		{
+			name:  "empty replacement deletes target",
+			rules: []RelabelConfig{{SourceLabels: []string{"env"}, Regex: "blue", TargetLabel: "env", Replacement: "${2}"}},
+			want:  map[string]string{"k8s.pod.name": "api-7d9f-x2x", "k8s.namespace.name": "prod"},
+		},
+		{
+			name:  "keep matching",
+			rules: []RelabelConfig{{SourceLabels: []string{"k8s.namespace.name"}, Regex: "prod|staging", Action: "keep"}},
+			want:  labels,
+		},
+		{
+			name:  "keep not matching",
+			rules: []RelabelConfig{{SourceLabels: []string{"k8s.namespace.name"}, Regex: "staging", Action: "keep"}},
+		},
+		{
+			name:  "keep is anchored",
+			rules: []RelabelConfig{{SourceLabels: []string{"k8s.namespace.name"}, Regex: "pro", Action: "keep"}},
+		},
+		{
+			name:  "drop matching",
+			rules: []RelabelConfig{{SourceLabels: []string{"env"}, Regex: "blue", Action: "drop"}},
+		},
+		{
+			name:  "drop not matching",
+			rules: []RelabelConfig{{SourceLabels: []string{"env"}, Regex: "green", Action: "drop"}},
+			want:  labels,
+		},
+		{
+			name:  "labelmap",
+			rules: []RelabelConfig{{Regex: "k8s\\.(.*)\\.name", Action: "labelmap"}},
+			want:  map[string]string{"k8s.pod.name": "api-7d9f-x2x", "k8s.namespace.name": "prod", "env": "blue", "pod": "api-7d9f-x2x", "namespace": "prod"},
+		},
+		{
+			name:  "labeldrop",
+			rules: []RelabelConfig{{Regex: "k8s\\..*", Action: "labeldrop"}},
+			want:  map[string]string{"env": "blue"},
+		},
+		{
+			name:  "labelkeep",
+			rules: []RelabelConfig{{Regex: "k8s\\..*", Action: "labelkeep"}},
+			want:  map[string]string{"k8s.pod.name": "api-7d9f-x2x", "k8s.namespace.name": "prod"},
+		},
+		{
+			name: "rules apply in order",
+			rules: []RelabelConfig{
+				{SourceLabels: []string{"env"}, TargetLabel: "color"},
+				{Regex: "env", Action: "labeldrop"},
+				{SourceLabels: []string{"color"}, Regex: "blue", Action: "keep"},
+			},
+			want: map[string]string{"k8s.pod.name": "api-7d9f-x2x", "k8s.namespace.name": "prod", "color": "blue"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := tt.rules
+			for i := range rules {
+				if err := rules[i].compile(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			in := maps.Clone(labels)
+			got, ok := relabel(in, rules)
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("got %v, want the series dropped", got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("series dropped")
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if !maps.Equal(in, labels) {
+				t.Fatalf("input labels modified: %v", in)
+			}
+		})
+	}
+}
+
+func TestRelabelConfigCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule RelabelConfig
+		err  bool
+	}{
+		{name: "defaults to replace", rule: RelabelConfig{TargetLabel: "app"}},
+		{name: "replace without target", rule: RelabelConfig{SourceLabels: []string{"env"}}, err: true},
+		{name: "keep without source labels", rule: RelabelConfig{Action: "keep"}, err: true},
+		{name: "drop without source labels", rule: RelabelConfig{Action: "drop"}, err: true},
+		{name: "labeldrop", rule: RelabelConfig{Regex: "env", Action: "labeldrop"}},
+		{name: "unknown action", rule: RelabelConfig{Action: "hashmod"}, err: true},
+		{name: "invalid regex", rule: RelabelConfig{TargetLabel: "app", Regex: "("}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.compile()
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRelabelSeries(t *testing.T) {
+	rules := []RelabelConfig{{SourceLabels: []string{"env"}, Regex: "blue", Action: "keep"}}
+	if err := rules[0].compile(); err != nil {
+		t.Fatal(err)
+	}
+	series := []seriesValue{
+		{Labels: map[string]string{"env": "blue"}, Value: 1},
+		{Labels: map[string]string{"env": "green"}, Value: 2},
+		{Labels: map[string]string{"env": "blue"}, Value: 3},
+	}
+	got := relabelSeries(series, rules)
+	if len(got) != 2 || got[0].Value != 1 || got[1].Value != 3 {
+		t.Fatalf("got %v, want the blue series", got)
+	}
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// maxRetryDelay caps the exponential backoff between attempts. A
+// Retry-After sent by SigNoz is not capped, waiting on it is bounded only by
+// the request's context.
+const maxRetryDelay = 5 * time.Second
+
+// MaxRetryAttempts bounds RetryPolicy.MaxAttempts, so a failing SigNoz is not
+// retried for longer than requests wait.
+const MaxRetryAttempts = 10
+
+// RetryPolicy configures how failed SigNoz requests are retried. Requests
+// are retried when they fail to reach SigNoz, time out, or fail with one of
+// StatusCodes.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first. Values
+	// below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubling for every
+	// further retry up to maxRetryDelay, unless SigNoz sent a Retry-After.
+	BaseDelay time.Duration
+	// StatusCodes are the HTTP status codes retried.
+	StatusCodes []int
+}
+
+// retryable reports whether a request that failed with err is retried.
+func (r RetryPolicy) retryable(err error) bool {
+	var (
+		unavailable *UnavailableError
+		rateLimited *RateLimitedError
+	)
+	switch {
+	case errors.As(err, &unavailable):
+		return unavailable.StatusCode == 0 || slices.Contains(r.StatusCodes, unavailable.StatusCode)
+	case errors.As(err, &rateLimited):
+		return slices.Contains(r.StatusCodes, 429)
+	default:
+		return false
+	}
+}
+
+// delay returns the backoff before the given retry, counting from 1, with
+// jitter spreading it between half and all of the exponential delay. A
+// Retry-After sent by SigNoz takes precedence and is not capped.
+func (r RetryPolicy) delay(retry int, err error) time.Duration {
+	var rateLimited *RateLimitedError
+	if errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0 {
+		return rateLimited.RetryAfter
+	}
+	if r.BaseDelay <= 0 {
+		return 0
+	}
+	// Doubling stops at the cap, so large retry counts cannot overflow.
+	d := min(r.BaseDelay, maxRetryDelay)
+	for i := 1; i < retry && d < maxRetryDelay; i++ {
+		d = min(2*d, maxRetryDelay)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// do calls query until it succeeds, fails with an error that is not
+// retried, or runs out of attempts. Backoffs end early when ctx is done.
+func (r RetryPolicy) do(ctx context.Context, endpoint string, query func() (*SignozQueryRangeResponse, error)) (*SignozQueryRangeResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := query()
+		if err == nil || attempt >= r.MaxAttempts || !r.retryable(err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := r.delay(attempt, err)
+		klog.V(2).Infof("retrying query to %s in %s after attempt %d: %v", endpoint, delay, attempt, err)
+		queryRetries.WithLabelValues(errorCategory(err)).Inc()
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond}
+	unavailable := &UnavailableError{StatusCode: http.StatusServiceUnavailable}
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		retry    int
+		err      error
+		min, max time.Duration
+	}{
+		{name: "first retry", policy: policy, retry: 1, err: unavailable, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{name: "third retry", policy: policy, retry: 3, err: unavailable, min: 400 * time.Millisecond, max: 800 * time.Millisecond},
+		{name: "capped", policy: policy, retry: 10, err: unavailable, min: maxRetryDelay / 2, max: maxRetryDelay},
+		{name: "shift overflow", policy: policy, retry: 40, err: unavailable, min: maxRetryDelay / 2, max: maxRetryDelay},
+		{name: "large retry", policy: policy, retry: 1 << 20, err: unavailable, min: maxRetryDelay / 2, max: maxRetryDelay},
+		{name: "base above cap", policy: RetryPolicy{BaseDelay: time.Minute}, retry: 1, err: unavailable, min: maxRetryDelay / 2, max: maxRetryDelay},
+		{name: "no base delay", policy: RetryPolicy{}, retry: 3, err: unavailable},
+		{name: "retry after", policy: policy, retry: 1, err: &RateLimitedError{RetryAfter: 30 * time.Second}, min: 30 * time.Second, max: 30 * time.Second},
+		{name: "no retry after", policy: policy, retry: 1, err: &RateLimitedError{}, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				if got := tt.policy.delay(tt.retry, tt.err); got < tt.min || got > tt.max {
+					t.Fatalf("got %s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	policy := RetryPolicy{StatusCodes: []int{http.StatusBadGateway, http.StatusTooManyRequests}}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "transport error", err: &UnavailableError{Err: errors.New("connection reset")}, want: true},
+		{name: "listed status", err: &UnavailableError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "unlisted status", err: &UnavailableError{StatusCode: http.StatusServiceUnavailable}},
+		{name: "rate limited", err: &RateLimitedError{}, want: true},
+		{name: "rejected query", err: &QueryInvalidError{StatusCode: http.StatusBadRequest}},
+		{name: "rejected key", err: &AuthError{StatusCode: http.StatusUnauthorized}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.retryable(tt.err); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// rollupOwners aggregates the per-pod series of a metric with ownerRollup to
+// the owners of the pods of the metric's resource. Series of pods that are
+// not in the informer cache or have no such owner are dropped.
+func (p *signozProvider) rollupOwners(ctx context.Context, metric *MetricConfig, series []seriesValue) ([]seriesValue, error) {
+	target := metric.groupResource()
+	podLabels, namespaceLabel := metric.queryLabels(), metric.namespaceLabel()
+
+	values := map[string][]float64{}
+	var dropped int
+	for _, s := range series {
+		pod, ok := lookupObject(s.Labels, podLabels)
+		if !ok {
+			dropped++
+			continue
+		}
+		// Without a namespace on the series only the pods of the requested
+		// namespace can be found.
+		namespace := queryScopeFrom(ctx).objectNamespace()
+		if namespaceLabel != "" {
+			if ns, ok := lookupLabel(s.Labels, namespaceLabel); ok {
+				namespace = ns
+			}
+		}
+		if namespace == "" {
+			dropped++
+			continue
+		}
+		owner, ok, err := p.lister.ownerOf(ctx, namespace, pod, target)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			dropped++
+			continue
+		}
+		key := objectKey(namespace, owner)
+		values[key] = append(values[key], s.Value)
+	}
+	if dropped > 0 {
+		klog.V(4).Infof("dropped %d series of metric %s without a pod owned by %s", dropped, metric.Name, target.String())
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	objectLabel := metric.objectLabels()[0]
+	rolled := make([]seriesValue, 0, len(keys))
+	for _, key := range keys {
+		namespace, name, _ := strings.Cut(key, "/")
+		labels := map[string]string{objectLabel: name}
+		if namespaceLabel != "" {
+			labels[namespaceLabel] = namespace
+		}
+		rolled = append(rolled, seriesValue{Labels: labels, Value: combine(metric.spaceAggregation(), values[key])})
+	}
+	return rolled, nil
+}
+
+// combine aggregates values by sum, avg, max or min, summing them for any
+// other aggregation.
+func combine(aggregation string, values []float64) float64 {
+	switch aggregation {
+	case "max":
+		return slices.Max(values)
+	case "min":
+		return slices.Min(values)
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	if aggregation == "avg" {
+		return sum / float64(len(values))
+	}
+	return sum
+}
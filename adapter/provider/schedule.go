@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleOverride changes a metric while its schedule matches, e.g. to
+// scale more aggressively during business hours.
+type ScheduleOverride struct {
+	// Schedule is a cron expression with minute, hour, day of month, month
+	// and day of week fields. The override is active during every minute
+	// the expression matches, e.g. "* 9-17 * * 1-5" for business hours.
+	Schedule string `json:"schedule"`
+	// TimeZone is the IANA time zone the schedule is evaluated in.
+	// Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Multiplier scales the values of the metric.
+	Multiplier *float64 `json:"multiplier,omitempty"`
+	// Metric queries another SigNoz metric instead of the configured one.
+	Metric string `json:"metric,omitempty"`
+	// LabelFilters are added to the label filters of the metric.
+	LabelFilters []LabelFilter `json:"labelFilters,omitempty"`
+
+	schedule *cronSchedule
+	location *time.Location
+}
+
+// compile parses the schedule and loads the time zone.
+func (o *ScheduleOverride) compile() error {
+	s, err := parseCron(o.Schedule)
+	if err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	o.schedule = s
+
+	o.location = time.UTC
+	if o.TimeZone != "" {
+		loc, err := time.LoadLocation(o.TimeZone)
+		if err != nil {
+			return fmt.Errorf("timeZone: %w", err)
+		}
+		o.location = loc
+	}
+	return nil
+}
+
+// active reports whether the schedule matches t.
+func (o *ScheduleOverride) active(t time.Time) bool {
+	return o.schedule != nil && o.schedule.matches(t.In(o.location))
+}
+
+// scheduleOverride returns the first override of the metric that is active
+// at t, or nil.
+func (m *MetricConfig) scheduleOverride(t time.Time) *ScheduleOverride {
+	for i := range m.Schedules {
+		if m.Schedules[i].active(t) {
+			return &m.Schedules[i]
+		}
+	}
+	return nil
+}
+
+// scheduleSeries applies the multiplier of the active override of the
+// metric, if any, to the series.
+func scheduleSeries(metric *MetricConfig, series []seriesValue) []seriesValue {
+	override := metric.scheduleOverride(time.Now())
+	if override == nil || override.Multiplier == nil {
+		return series
+	}
+	for i := range series {
+		series[i].Value *= *override.Multiplier
+	}
+	return series
+}
+
+// cronSchedule is a parsed five-field cron expression.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether the day fields were *, as cron
+	// matches either day field when both are restricted.
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCron parses a cron expression. Fields support *, numbers, ranges,
+// lists and steps, e.g. */15 or 1-5. Day of week 7 is Sunday, like 0.
+func parseCron(expression string) (*cronSchedule, error) {
+	parts := strings.Fields(expression)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(cronFields), len(parts))
+	}
+
+	bits := make([]uint64, len(parts))
+	for i, part := range parts {
+		b, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cronFields[i].name, err)
+		}
+		bits[i] = b
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(s string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := field.min, field.max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseCronValue(loStr, field); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseCronValue(hiStr, field); err != nil {
+					return 0, err
+				}
+				if hi < lo {
+					return 0, fmt.Errorf("invalid range %q", rng)
+				}
+			} else if hasStep {
+				hi = field.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, field cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < field.min || v > field.max {
+		return 0, fmt.Errorf("invalid value %q, must be between %d and %d", s, field.min, field.max)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// SecretFile is a secret read from a file, as provided by projected Secret
+// volumes. The file is re-read whenever its modification time changes, so a
+// rotated secret is picked up without restarting the adapter.
+type SecretFile struct {
+	path string
+
+	mu      sync.Mutex
+	value   string
+	modTime time.Time
+}
+
+// NewSecretFile reads the secret at path. It fails if the file cannot be
+// read or is empty.
+func NewSecretFile(path string) (*SecretFile, error) {
+	f := &SecretFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadSecretFile returns the trimmed contents of the file at path.
+func ReadSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return value, nil
+}
+
+func (f *SecretFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	value, err := ReadSecretFile(f.path)
+	if err != nil {
+		return err
+	}
+	if f.value != "" && value != f.value {
+		klog.Infof("reloaded secret from %s", f.path)
+	}
+	f.value = value
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// Value returns the current secret. If the file cannot be read, the last
+// value is kept.
+func (f *SecretFile) Value() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reload(); err != nil {
+		klog.Errorf("failed to reload secret from %s, using previous value: %v", f.path, err)
+	}
+	return f.value
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// SecretWatcher authenticates with an API key read from a Kubernetes
+// Secret. The Secret is watched, so a rotated key is used by the next
+// request without restarting the adapter or waiting for the kubelet to
+// update a mounted volume. It can also provide a client certificate from the
+// same Secret, which new connections pick up the same way.
+type SecretWatcher struct {
+	// ClientCertificate also reads a client certificate from the tls.crt
+	// and tls.key keys of the Secret. It must be set before Start.
+	ClientCertificate bool
+
+	namespace string
+	name      string
+	key       string
+	informer  cache.SharedIndexInformer
+	apiKey    atomic.Pointer[string]
+	cert      atomic.Pointer[tls.Certificate]
+}
+
+// NewSecretWatcher returns an Authenticator using the given key of the
+// Secret namespace/name. It only watches that Secret, so it needs no access
+// to other Secrets in the namespace.
+func NewSecretWatcher(client kubernetes.Interface, namespace, name, key string) *SecretWatcher {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = "metadata.name=" + name
+		}),
+	)
+	w := &SecretWatcher{
+		namespace: namespace,
+		name:      name,
+		key:       key,
+		informer:  factory.Core().V1().Secrets().Informer(),
+	}
+	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { w.update(obj) },
+		UpdateFunc: func(_, obj any) { w.update(obj) },
+		DeleteFunc: func(any) {
+			klog.Warningf("secret %s/%s was deleted, keeping the last API key", w.namespace, w.name)
+		},
+	})
+	return w
+}
+
+// Start watches the Secret until stopCh is closed and waits for the first
+// list, so the key and certificate are known before the first request.
+func (w *SecretWatcher) Start(stopCh <-chan struct{}) error {
+	go w.informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, w.informer.HasSynced) {
+		return fmt.Errorf("failed to sync secret %s/%s", w.namespace, w.name)
+	}
+	if w.apiKey.Load() == nil {
+		return fmt.Errorf("secret %s/%s not found or has no key %q", w.namespace, w.name, w.key)
+	}
+	if w.ClientCertificate && w.cert.Load() == nil {
+		return fmt.Errorf("secret %s/%s has no valid client certificate in %s and %s", w.namespace, w.name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	return nil
+}
+
+func (w *SecretWatcher) update(obj any) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+	if w.ClientCertificate {
+		w.updateCertificate(secret)
+	}
+	value := strings.TrimSpace(string(secret.Data[w.key]))
+	if value == "" {
+		klog.Errorf("secret %s/%s has no key %q, keeping the last API key", w.namespace, w.name, w.key)
+		return
+	}
+	if old := w.apiKey.Swap(&value); old != nil && *old != value {
+		klog.Infof("reloaded API key from secret %s/%s", w.namespace, w.name)
+	}
+}
+
+func (w *SecretWatcher) updateCertificate(secret *corev1.Secret) {
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		klog.Errorf("secret %s/%s has no valid client certificate, keeping the last one: %v", w.namespace, w.name, err)
+		return
+	}
+	if old := w.cert.Swap(&cert); old != nil && !bytes.Equal(old.Certificate[0], cert.Certificate[0]) {
+		klog.Infof("reloaded client certificate from secret %s/%s", w.namespace, w.name)
+	}
+}
+
+// GetClientCertificate returns the current client certificate, for use as
+// tls.Config.GetClientCertificate.
+func (w *SecretWatcher) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := w.cert.Load(); cert != nil {
+		return cert, nil
+	}
+	return &tls.Certificate{}, nil
+}
+
+// APIKey returns the current API key.
+func (w *SecretWatcher) APIKey() (string, error) {
+	apiKey := w.apiKey.Load()
+	if apiKey == nil {
+		return "", fmt.Errorf("no API key loaded from secret %s/%s", w.namespace, w.name)
+	}
+	return *apiKey, nil
+}
+
+func (w *SecretWatcher) Authenticate(ctx context.Context, request *http.Request) error {
+	apiKey, err := w.APIKey()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Signoz-Api-Key", apiKey)
+	return nil
+}
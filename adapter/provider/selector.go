@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// selectorToFilterExpression translates a Kubernetes metric label selector into
+// a SigNoz filter expression. Equality requirements become `=` or `!=`
+// comparisons, set-based requirements become `IN`/`NOT IN`, existence
+// requirements become `EXISTS`/`NOT EXISTS` and `gt`/`lt` become numeric
+// comparisons.
+func selectorToFilterExpression(selector labels.Selector) (string, error) {
+	if selector == nil || selector.Empty() {
+		return "", nil
+	}
+
+	reqs, selectable := selector.Requirements()
+	if !selectable {
+		return "", apierr.NewBadRequest(fmt.Sprintf("metric selector %q can never match", selector.String()))
+	}
+
+	var parts []string
+	for _, req := range reqs {
+		values := req.Values().List()
+		switch req.Operator() {
+		case selection.Equals, selection.DoubleEquals:
+			parts = append(parts, fmt.Sprintf("%s = %s", req.Key(), quoteFilterValue(values[0])))
+		case selection.NotEquals:
+			parts = append(parts, fmt.Sprintf("%s != %s", req.Key(), quoteFilterValue(values[0])))
+		case selection.In:
+			parts = append(parts, fmt.Sprintf("%s IN %s", req.Key(), quoteFilterValues(values)))
+		case selection.NotIn:
+			parts = append(parts, fmt.Sprintf("%s NOT IN %s", req.Key(), quoteFilterValues(values)))
+		case selection.Exists:
+			parts = append(parts, fmt.Sprintf("%s EXISTS", req.Key()))
+		case selection.DoesNotExist:
+			parts = append(parts, fmt.Sprintf("%s NOT EXISTS", req.Key()))
+		case selection.GreaterThan:
+			// The selector parser only admits integers here.
+			parts = append(parts, fmt.Sprintf("%s > %s", req.Key(), values[0]))
+		case selection.LessThan:
+			parts = append(parts, fmt.Sprintf("%s < %s", req.Key(), values[0]))
+		default:
+			return "", apierr.NewBadRequest(fmt.Sprintf("unsupported operator %q in metric selector %q", req.Operator(), selector.String()))
+		}
+	}
+
+	return strings.Join(parts, " AND "), nil
+}
+
+// joinFilterExpressions combines the non-empty expressions with AND.
+func joinFilterExpressions(exprs ...string) string {
+	var parts []string
+	for _, e := range exprs {
+		if e != "" {
+			parts = append(parts, e)
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	for i := range parts {
+		parts[i] = "(" + parts[i] + ")"
+	}
+	return strings.Join(parts, " AND ")
+}
+
+func quoteFilterValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+func quoteFilterValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quoteFilterValue(v)
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"testing"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+func TestSelectorToFilterExpression(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{selector: "", want: ""},
+		{selector: "env=prod", want: "env = 'prod'"},
+		{selector: "env==prod", want: "env = 'prod'"},
+		{selector: "env!=prod", want: "env != 'prod'"},
+		{selector: "env in (prod,dev,staging)", want: "env IN ('dev', 'prod', 'staging')"},
+		{selector: "env notin (dev)", want: "env NOT IN ('dev')"},
+		{selector: "canary", want: "canary EXISTS"},
+		{selector: "!canary", want: "canary NOT EXISTS"},
+		{selector: "shard>3", want: "shard > 3"},
+		{selector: "shard<10", want: "shard < 10"},
+		{selector: "region in (eu,us),env=prod", want: "env = 'prod' AND region IN ('eu', 'us')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := selectorToFilterExpression(selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectorToFilterExpressionNothing(t *testing.T) {
+	if got, err := selectorToFilterExpression(nil); got != "" || err != nil {
+		t.Fatalf("got %q, %v, want no expression", got, err)
+	}
+	if _, err := selectorToFilterExpression(labels.Nothing()); !apierr.IsBadRequest(err) {
+		t.Fatalf("got %v, want a bad request", err)
+	}
+	req, err := labels.NewRequirement("env", selection.In, []string{"prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := selectorToFilterExpression(labels.NewSelector().Add(*req)); got != "env IN ('prod')" || err != nil {
+		t.Fatalf("got %q, %v, want env IN ('prod')", got, err)
+	}
+}
+
+func TestJoinFilterExpressions(t *testing.T) {
+	tests := []struct {
+		exprs []string
+		want  string
+	}{
+		{exprs: nil, want: ""},
+		{exprs: []string{"", ""}, want: ""},
+		{exprs: []string{"a = 'b'", ""}, want: "a = 'b'"},
+		{exprs: []string{"a = 'b' OR c = 'd'", "e EXISTS"}, want: "(a = 'b' OR c = 'd') AND (e EXISTS)"},
+	}
+	for _, tt := range tests {
+		if got := joinFilterExpressions(tt.exprs...); got != tt.want {
+			t.Errorf("joinFilterExpressions(%q) = %q, want %q", tt.exprs, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteFilterValue(t *testing.T) {
+	tests := map[string]string{
+		"prod":    "'prod'",
+		"it's":    `'it\'s'`,
+		`C:\path`: `'C:\\path'`,
+		`\'`:      `'\\\''`,
+	}
+	for value, want := range tests {
+		if got := quoteFilterValue(value); got != want {
+			t.Errorf("quoteFilterValue(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// ShadowOptions configures shadow comparisons of metrics that define a
+// shadowQuery, to de-risk migrating PromQL queries to the builder API.
+type ShadowOptions struct {
+	// SampleRate is the fraction of queries that are compared against the
+	// shadow query. Zero disables shadow comparisons.
+	SampleRate float64
+	// Tolerance is the relative divergence up to which values match.
+	Tolerance float64
+}
+
+// shadowTimeout bounds a shadow query, which runs in the background.
+const shadowTimeout = 30 * time.Second
+
+// Shadow comparison results.
+const (
+	shadowMatch    = "match"
+	shadowDiverged = "diverged"
+	shadowMissing  = "missing"
+	shadowError    = "error"
+)
+
+// shadowSampled reports whether a query of the metric should be compared
+// against its shadow query.
+func (p *signozProvider) shadowSampled(metric *MetricConfig) bool {
+	return metric.ShadowQuery != "" && p.opts.Shadow.SampleRate > 0 && rand.Float64() < p.opts.Shadow.SampleRate
+}
+
+// shadowCompare runs the PromQL shadow query of the metric over the range
+// of query and compares its values per object with series, the result of
+// the builder query. The outcome is logged and counted; it never affects
+// the served values.
+func (p *signozProvider) shadowCompare(metric *MetricConfig, query SignozQueryRangeOptions, series []seriesValue) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+
+	resp, err := p.signoz.Query(ctx, SignozQueryRangeOptions{
+		RequestType: query.RequestType,
+		Start:       query.Start,
+		End:         query.End,
+		CompositeQuery: SignozCompositeQuery{
+			Queries: []SignozQuery{{
+				Type: "promql",
+				Spec: SignozQuerySpec{
+					Name:         "A",
+					Query:        metric.ShadowQuery,
+					StepInterval: query.CompositeQuery.Queries[0].Spec.StepInterval,
+				},
+			}},
+		},
+	})
+	if err != nil {
+		shadowComparisons.WithLabelValues(metric.Name, shadowError).Inc()
+		klog.Warningf("shadow query of metric %s failed: %v", metric.Name, err)
+		return
+	}
+
+	primary := newSeriesIndex(series, metric)
+	shadow := newSeriesIndex(relabelSeries(resp.Series(), metric.Relabel), metric)
+
+	var compared, diverged, missing int
+	var maxDivergence float64
+	for object, value := range primary.byObject {
+		shadowValue, ok := shadow.byObject[object]
+		if !ok {
+			missing++
+			continue
+		}
+		compared++
+		divergence := relativeDivergence(value, shadowValue)
+		shadowDivergence.WithLabelValues(metric.Name).Observe(divergence)
+		maxDivergence = max(maxDivergence, divergence)
+		if divergence > p.opts.Shadow.Tolerance {
+			diverged++
+		}
+	}
+	for object := range shadow.byObject {
+		if _, ok := primary.byObject[object]; !ok {
+			missing++
+		}
+	}
+
+	shadowComparisons.WithLabelValues(metric.Name, shadowMatch).Add(float64(compared - diverged))
+	shadowComparisons.WithLabelValues(metric.Name, shadowDiverged).Add(float64(diverged))
+	shadowComparisons.WithLabelValues(metric.Name, shadowMissing).Add(float64(missing))
+	if diverged > 0 || missing > 0 {
+		klog.Warningf("shadow query of metric %s diverged for %d of %d objects, %d objects missing from one side, max divergence %.2f%%", metric.Name, diverged, compared, missing, maxDivergence*100)
+	} else {
+		klog.V(2).Infof("shadow query of metric %s matched for %d objects", metric.Name, compared)
+	}
+}
+
+// relativeDivergence returns the difference of a and b relative to the
+// larger of the two.
+func relativeDivergence(a, b float64) float64 {
+	scale := max(math.Abs(a), math.Abs(b))
+	if scale == 0 {
+		return 0
+	}
+	return math.Abs(a-b) / scale
+}
@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SigNoz signals metrics can be queried from.
+const (
+	SignalMetrics = "metrics"
+	SignalTraces  = "traces"
+	SignalLogs    = "logs"
+)
+
+func (m *MetricConfig) signal() string {
+	if m.Signal == "" {
+		return SignalMetrics
+	}
+	return m.Signal
+}
+
+func (m *MetricConfig) aggregation() string {
+	if m.Aggregation == "" {
+		return "count()"
+	}
+	return m.Aggregation
+}
+
+// signalReduce returns how the points of a traces or logs series are reduced without
+// a time aggregation: counts and sums per step add up to the total over the
+// window, other aggregations such as percentiles are averaged.
+func (m *MetricConfig) signalReduce() func([]SignozSeriesValue) (float64, bool) {
+	agg := strings.ToLower(m.aggregation())
+	if strings.HasPrefix(agg, "count") || strings.HasPrefix(agg, "sum") {
+		return sumValues
+	}
+	return avgValues
+}
+
+func (m *MetricConfig) validateSignal() error {
+	switch m.signal() {
+	case SignalMetrics:
+		if m.Aggregation != "" {
+			return fmt.Errorf("aggregation requires signal traces or logs")
+		}
+		return nil
+	case SignalTraces, SignalLogs:
+	default:
+		return fmt.Errorf("signal must be metrics, traces or logs, got %q", m.Signal)
+	}
+	if m.Metric != "" || m.Function != "" || m.SpaceAggregation != "" || m.Formula != nil || m.Expression != "" || m.Synthetic != nil ||
+		m.Apdex != nil || m.PromQL != "" || m.ClickHouseSQL != "" || m.ShadowQuery != "" {
+		return fmt.Errorf("signal %s cannot be combined with metric, function, spaceAggregation, formula, expression, synthetic, apdex, promql, clickhouseSQL or shadowQuery", m.signal())
+	}
+	for _, o := range m.Schedules {
+		if o.Metric != "" {
+			return fmt.Errorf("schedules cannot override the metric of signal %s", m.signal())
+		}
+	}
+	return nil
+}
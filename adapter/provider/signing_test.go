@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequestSignerSign(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewSecretFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		algorithm string
+		method    string
+		url       string
+		body      string
+		want      string
+	}{
+		{
+			algorithm: SigningHMACSHA256, method: http.MethodPost, url: "https://signoz.example.com/api/v5/query_range", body: `{"start":0}`,
+			want: "2fa0a277a94a5bb515070e5887421c9bc3e7fa48ca9a7c322f9411ab7a3fd123",
+		},
+		{
+			algorithm: SigningHMACSHA256, method: http.MethodGet, url: "https://signoz.example.com/api/v1/labels?metric=requests",
+			want: "ea0145f384b81162e54e50492a3a2b17140bb963422ebe28d56941f7dba7b7b7",
+		},
+		{
+			algorithm: SigningHMACSHA512, method: http.MethodPost, url: "https://signoz.example.com/api/v5/query_range", body: `{"start":0}`,
+			want: "d3a05b02bcfe482d8378cb0c4eb6e6e06d060bc6bd08011c558f57e24cfacb223a1f9c35cf58bf3aeb989082edfa3c7659dd1abda9ae26e466ae05819a205479",
+		},
+		{
+			algorithm: SigningHMACSHA512, method: http.MethodGet, url: "https://signoz.example.com/api/v1/labels?metric=requests",
+			want: "7cb5b47b3543ee2e18af8ed5f2c4a5f6d2b1acdbf50aae8b4c22f0ba2c3fff291c42f2e7aead4858c9970c7a653437385dc8bee443be5304650a2777c8511ced",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm+" "+tt.method, func(t *testing.T) {
+			signer, err := NewRequestSigner(tt.algorithm, key, []string{"Host", " Content-Type "}, "X-Signature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			request, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.body != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			signer.sign(request, []byte(tt.body), "1700000000")
+
+			if got := request.Header.Get("X-Signature"); got != tt.algorithm+"="+tt.want {
+				t.Errorf("signature = %s, want %s=%s", got, tt.algorithm, tt.want)
+			}
+			if got := request.Header.Get("X-Signature-Timestamp"); got != "1700000000" {
+				t.Errorf("timestamp = %s, want 1700000000", got)
+			}
+			if got := request.Header.Get("X-Signature-Headers"); got != "host;content-type" {
+				t.Errorf("signed headers = %s, want host;content-type", got)
+			}
+		})
+	}
+}
+
+func TestNewRequestSignerRejectsUnknownAlgorithm(t *testing.T) {
+	if _, err := NewRequestSigner("hmac-md5", nil, nil, "X-Signature"); err == nil {
+		t.Fatal("got no error, want an unsupported algorithm error")
+	}
+}
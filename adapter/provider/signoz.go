@@ -2,31 +2,98 @@ package provider
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+// DefaultQueryPath is the path of the SigNoz query_range API.
+const DefaultQueryPath = "/api/v5/query_range"
+
+// DefaultQueryTimeout bounds requests whose context has no deadline.
+const DefaultQueryTimeout = 10 * time.Second
+
 type SignozClient struct {
 	Http     http.Client
 	Endpoint string
 	ApiKey   string
+	// ApiKeyFile, if set, provides the API key instead of ApiKey.
+	ApiKeyFile *SecretFile
+	// Auth, if set, authenticates requests instead of the API key.
+	Auth Authenticator
+	// QueryPath is the path of the query_range API, appended to the path of
+	// Endpoint so that endpoints behind a path-routing gateway keep their
+	// prefix. Defaults to DefaultQueryPath.
+	QueryPath string
+	// UserAgent is sent with every request.
+	UserAgent string
+	// Headers are added to every request, e.g. for attribution by a WAF.
+	Headers http.Header
+	// Signer, if set, signs every request.
+	Signer *RequestSigner
+	// Flavor is the kind of SigNoz deployment Endpoint points at, used to
+	// explain failed requests.
+	Flavor Flavor
+	// Retry retries transient failures. The zero value does not retry.
+	Retry RetryPolicy
+	// Breaker, if set, fails requests fast while the endpoint is down.
+	Breaker *CircuitBreaker
+	// Timeout bounds each request whose context has no deadline, e.g. one
+	// set by the timeout of the queried metric. Zero does not bound them.
+	Timeout time.Duration
+}
+
+// NewSignozClient returns a client for the SigNoz query API. A nil transport
+// uses http.DefaultTransport.
+func NewSignozClient(endpoint, apiKey string, transport http.RoundTripper) *SignozClient {
+	return &SignozClient{
+		Http:     http.Client{Transport: transport, CheckRedirect: sameHostRedirect},
+		Endpoint: endpoint,
+		ApiKey:   apiKey,
+		Timeout:  DefaultQueryTimeout,
+	}
+}
+
+// queryURL returns the URL of the query_range API.
+func (client *SignozClient) queryURL() (string, error) {
+	u, err := url.Parse(client.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	path := client.QueryPath
+	if path == "" {
+		path = DefaultQueryPath
+	}
+	return u.JoinPath(path).String(), nil
 }
 
-// not suitable when querying logs/traces
+func (client *SignozClient) apiKey() string {
+	if client.ApiKeyFile != nil {
+		return client.ApiKeyFile.Value()
+	}
+	return client.ApiKey
+}
+
+// queries of logs and traces only set Expression
 type SignozMetricAggregation struct {
-	MetricName       string `json:"metricName"`
-	Temporality      string `json:"temporality,omitempty"` // Cumulative, Delta, Unspecified
-	TimeAggregation  string `json:"timeAggregation"`       // rate, latest, sum, avg, min, max, count, count_distinct, increase
-	SpaceAggregation string `json:"spaceAggregation"`      // sum, avg, min, max, count, p50, p75, p90, p95, p99
-	ReduceTo         string `json:"reduceTo,omitempty"`    // last, sum, avg, min, max, count, median
+	MetricName       string `json:"metricName,omitempty"`
+	Temporality      string `json:"temporality,omitempty"`      // Cumulative, Delta, Unspecified
+	TimeAggregation  string `json:"timeAggregation,omitempty"`  // rate, latest, sum, avg, min, max, count, count_distinct, increase
+	SpaceAggregation string `json:"spaceAggregation,omitempty"` // sum, avg, min, max, count, p50, p75, p90, p95, p99
+	ReduceTo         string `json:"reduceTo,omitempty"`         // last, sum, avg, min, max, count, median
+	Expression       string `json:"expression,omitempty"`       // logs and traces, e.g. count(), p99(duration_nano)
 }
 
 type SignozQueryGroupBy struct {
 	Name          string `json:"name"`
-	FieldDataType string `json:"fieldDataType"` // string, int64, float64, bool, array(string), array(int64), array(float64), array(bool)
-	FieldContext  string `json:"fieldContext"`  // resource, attribute, scope, span, log
+	FieldDataType string `json:"fieldDataType"`          // string, int64, float64, bool, array(string), array(int64), array(float64), array(bool)
+	FieldContext  string `json:"fieldContext,omitempty"` // resource, attribute, scope, span, log
 }
 
 type SignozQueryFilter struct {
@@ -35,15 +102,17 @@ type SignozQueryFilter struct {
 
 type SignozQuerySpec struct {
 	Name         string                    `json:"name"`
-	Signal       string                    `json:"signal"`
-	StepInterval int64                    `json:"stepInterval"`
+	Signal       string                    `json:"signal,omitempty"`
+	StepInterval int64                     `json:"stepInterval,omitempty"`
 	Disabled     *bool                     `json:"disabled,omitempty"`
-	Aggregations []SignozMetricAggregation `json:"aggregations"`
+	Aggregations []SignozMetricAggregation `json:"aggregations,omitempty"`
 	GroupBy      []SignozQueryGroupBy      `json:"groupBy,omitempty"`
 	Filter       *SignozQueryFilter        `json:"filter,omitempty"`
 	Having       *SignozQueryFilter        `json:"having,omitempty"`
 	Limit        int                       `json:"limit,omitempty"`
 	Offset       int                       `json:"offset,omitempty"`
+	Query        string                    `json:"query,omitempty"`      // promql and clickhouse_sql queries
+	Expression   string                    `json:"expression,omitempty"` // builder_formula queries
 }
 
 type SignozQuery struct {
@@ -106,21 +175,54 @@ type SignozLabel struct {
 }
 
 type SignozResultSeries struct {
-	Labels []SignozLabel      `json:"labels,omitempty"`
+	Labels []SignozLabel       `json:"labels,omitempty"`
 	Values []SignozSeriesValue `json:"values"`
 }
 
 func (s *SignozResultSeries) LabelMap() map[string]string {
 	m := make(map[string]string, len(s.Labels))
 	for _, l := range s.Labels {
+		if l.Value == nil {
+			continue
+		}
 		m[l.Key.Name] = fmt.Sprintf("%v", l.Value)
 	}
 	return m
 }
 
 type SignozSeriesValue struct {
-	Timestamp int64   `json:"timestamp"`
-	Value     float64 `json:"value"`
+	Timestamp int64       `json:"timestamp"`
+	Value     SignozFloat `json:"value"`
+}
+
+// SignozFloat is the value of a point. It decodes null and strings such as
+// "NaN" as NaN, so a missing value is not mistaken for zero, and quoted
+// numbers as their value.
+type SignozFloat float64
+
+func (f *SignozFloat) UnmarshalJSON(data []byte) error {
+	switch {
+	case string(data) == "null":
+		*f = SignozFloat(math.NaN())
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		s, err := strconv.Unquote(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid value %s: %w", data, err)
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: %w", s, err)
+		}
+		*f = SignozFloat(v)
+		return nil
+	}
+	v, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %s: %w", data, err)
+	}
+	*f = SignozFloat(v)
+	return nil
 }
 
 type SignozResponseMeta struct {
@@ -134,38 +236,84 @@ type SignozResponseWarning struct {
 	URL     string `json:"url,omitempty"`
 }
 
-func (client *SignozClient) Query(query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error) {
+// maxErrorBodySize limits how much of a non-OK response is kept for the error.
+const maxErrorBodySize = 4 << 10
+
+// Query runs a query_range request, retrying transient failures according
+// to the retry policy unless the circuit breaker is open. Failures are
+// returned as one of the typed errors in errors.go.
+func (client *SignozClient) Query(ctx context.Context, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error) {
+	probe, err := client.Breaker.allow()
+	if err != nil {
+		queryErrors.WithLabelValues(errorCategory(err)).Inc()
+		return nil, err
+	}
+	resp, err := client.Retry.do(ctx, client.Endpoint, func() (*SignozQueryRangeResponse, error) {
+		return client.query(ctx, query)
+	})
+	client.Breaker.record(ctx, probe, err)
+	if err != nil {
+		queryErrors.WithLabelValues(errorCategory(err)).Inc()
+	}
+	return resp, err
+}
+
+func (client *SignozClient) query(ctx context.Context, query SignozQueryRangeOptions) (*SignozQueryRangeResponse, error) {
+	if _, ok := ctx.Deadline(); !ok && client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+	}
+
+	// The body is not pooled, as the transport may still read it after Do
+	// returns, or again to follow a redirect. json.Marshal already reuses
+	// its encoding buffers and only allocates the result.
 	body, err := json.Marshal(&query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal query: %w", err)
 	}
 
-	endpointUrl := client.Endpoint + "/api/v5/query_range"
-	request, err := http.NewRequest("POST", endpointUrl, bytes.NewBuffer(body))
+	endpointUrl, err := client.queryURL()
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", endpointUrl, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
-	request.Header.Set("Signoz-Api-Key", client.ApiKey)
+	for name, values := range client.Headers {
+		request.Header[name] = values
+	}
+	if client.UserAgent != "" {
+		request.Header.Set("User-Agent", client.UserAgent)
+	}
+	if client.Auth != nil {
+		if err := client.Auth.Authenticate(ctx, request); err != nil {
+			return nil, err
+		}
+	} else {
+		request.Header.Set("Signoz-Api-Key", client.apiKey())
+	}
 	request.Header.Set("Content-Type", "application/json")
+	if client.Signer != nil {
+		client.Signer.Sign(request, body)
+	}
 
 	response, err := client.Http.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed post signoz query: %w", err)
+		return nil, &UnavailableError{Err: err}
 	}
 	defer response.Body.Close()
 
-	bodyBytes, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
 	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("signoz returned non-OK status code: %d, body: %s", response.StatusCode, string(bodyBytes))
+		bodyBytes, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return nil, statusError(response, string(bodyBytes), client.Flavor)
 	}
 
+	// The response is decoded as the body is read, not read in full first.
 	var responseData SignozQueryRangeResponse
-	if err := json.Unmarshal(bodyBytes, &responseData); err != nil {
-		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	if err := json.NewDecoder(response.Body).Decode(&responseData); err != nil {
+		return nil, &DecodeError{Err: err}
 	}
 
 	return &responseData, nil
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignozSeriesValueUnmarshal(t *testing.T) {
+	tests := []struct {
+		json string
+		want float64
+		err  bool
+	}{
+		{json: `{"timestamp": 1, "value": 1.5}`, want: 1.5},
+		{json: `{"timestamp": 1, "value": -2e3}`, want: -2000},
+		{json: `{"timestamp": 1, "value": "42"}`, want: 42},
+		{json: `{"timestamp": 1, "value": "NaN"}`, want: math.NaN()},
+		{json: `{"timestamp": 1, "value": null}`, want: math.NaN()},
+		{json: `{"timestamp": 1, "value": "x"}`, err: true},
+		{json: `{"timestamp": 1, "value": true}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var v SignozSeriesValue
+			err := json.Unmarshal([]byte(tt.json), &v)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", v.Value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Timestamp != 1 {
+				t.Errorf("timestamp = %d, want 1", v.Timestamp)
+			}
+			if got := float64(v.Value); got != tt.want && !(math.IsNaN(got) && math.IsNaN(tt.want)) {
+				t.Errorf("value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// benchmarkResponse returns a query_range response with the given number of
+// series and points per series.
+func benchmarkResponse(series, points int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"status":"success","data":{"type":"time_series","data":{"results":[{"queryName":"A","aggregations":[{"index":0,"series":[`)
+	for s := range series {
+		if s > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"labels":[{"key":{"name":"k8s.pod.name"},"value":"pod-%d"}],"values":[`, s)
+		for p := range points {
+			if p > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, `{"timestamp":%d,"value":%d.25}`, 1700000000000+p*60000, p)
+		}
+		buf.WriteString(`]}`)
+	}
+	buf.WriteString(`]}]}]}}}`)
+	return buf.Bytes()
+}
+
+func BenchmarkDecodeResponse(b *testing.B) {
+	body := benchmarkResponse(500, 10)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for b.Loop() {
+		var resp SignozQueryRangeResponse
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignozClientQuery(b *testing.B) {
+	body := benchmarkResponse(500, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := NewSignozClient(server.URL, "key", nil)
+	query := SignozQueryRangeOptions{
+		End:         60_000,
+		RequestType: "time_series",
+		CompositeQuery: SignozCompositeQuery{Queries: []SignozQuery{{
+			Type: "builder_query",
+			Spec: SignozQuerySpec{Name: "A", Aggregations: []SignozMetricAggregation{{MetricName: "m"}}},
+		}}},
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := client.Query(context.Background(), query); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
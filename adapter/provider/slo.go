@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultSLOWindows are the burn-rate windows of the multiwindow alerting
+// strategy of the Google SRE workbook.
+var defaultSLOWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// SLOConfig is a shorthand for the burn-rate metrics of a service level
+// objective. Every window becomes a metric named <name>_burn_rate_<window>,
+// the error rate in the window relative to the error budget: 1 consumes
+// the budget exactly over the SLO period, 14.4 consumes 2% of a 30 day
+// budget in an hour.
+type SLOConfig struct {
+	// Name prefixes the names of the burn-rate metrics.
+	Name string `json:"name"`
+	// Good is the SigNoz counter of good events, e.g. successful requests.
+	// Exactly one of Good and Bad is required.
+	Good string `json:"good,omitempty"`
+	// Bad is the SigNoz counter of bad events, e.g. failed requests.
+	Bad string `json:"bad,omitempty"`
+	// Total is the SigNoz counter of all events.
+	Total string `json:"total"`
+	// Objective is the target fraction of good events, e.g. 0.999.
+	Objective float64 `json:"objective"`
+	// Windows are the windows burn rates are computed over. Defaults to
+	// 5m, 30m, 1h and 6h.
+	Windows []metav1.Duration `json:"windows,omitempty"`
+	// LabelFilters, GroupBy and Resource are passed on to the burn-rate
+	// metrics. Resource defaults to namespaces.
+	LabelFilters []LabelFilter `json:"labelFilters,omitempty"`
+	GroupBy      []string      `json:"groupBy,omitempty"`
+	Resource     string        `json:"resource,omitempty"`
+}
+
+func (s *SLOConfig) validate() error {
+	var errs []error
+	if s.Name == "" {
+		errs = append(errs, fmt.Errorf("name is required"))
+	}
+	if (s.Good == "") == (s.Bad == "") {
+		errs = append(errs, fmt.Errorf("exactly one of good and bad is required"))
+	}
+	if s.Total == "" {
+		errs = append(errs, fmt.Errorf("total is required"))
+	}
+	if s.Objective <= 0 || s.Objective >= 1 {
+		errs = append(errs, fmt.Errorf("objective must be between 0 and 1, got %g", s.Objective))
+	}
+	for i, w := range s.Windows {
+		if w.Duration < time.Minute {
+			errs = append(errs, fmt.Errorf("windows[%d]: must be at least 1m, got %s", i, w.Duration))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *SLOConfig) windows() []time.Duration {
+	if len(s.Windows) == 0 {
+		return defaultSLOWindows
+	}
+	windows := make([]time.Duration, len(s.Windows))
+	for i, w := range s.Windows {
+		windows[i] = w.Duration
+	}
+	return windows
+}
+
+// metrics returns the burn-rate metrics of the SLO. Each is a formula over
+// the increase of the counters in its window, evaluated by the adapter, as
+// the ratio of the totals differs from the ratios per step.
+func (s *SLOConfig) metrics() []MetricConfig {
+	budget := strconv.FormatFloat(1-s.Objective, 'g', -1, 64)
+	expression := "(1 - good / total) / " + budget
+	queries := []FormulaQuery{{Name: "good", Metric: s.Good}, {Name: "total", Metric: s.Total}}
+	if s.Bad != "" {
+		expression = "bad / total / " + budget
+		queries[0] = FormulaQuery{Name: "bad", Metric: s.Bad}
+	}
+
+	resource := s.Resource
+	if resource == "" {
+		resource = "namespaces"
+	}
+
+	var metrics []MetricConfig
+	for _, window := range s.windows() {
+		seconds := int64(window.Seconds())
+		metrics = append(metrics, MetricConfig{
+			Name:          s.Name + "_burn_rate_" + shortDuration(window),
+			LabelFilters:  slices.Clone(s.LabelFilters),
+			GroupBy:       slices.Clone(s.GroupBy),
+			Resource:      resource,
+			WindowSeconds: seconds,
+			Unit:          "1",
+			Formula: &FormulaConfig{
+				Expression: expression,
+				Queries:    slices.Clone(queries),
+				Evaluation: FormulaEvaluationClient,
+			},
+			stepAggregation: "increase",
+		})
+	}
+	return metrics
+}
+
+// shortDuration formats d without zero minutes and seconds, e.g. 1h
+// instead of 1h0m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// ExpandSLOs validates the SLOs and returns their burn-rate metrics.
+func ExpandSLOs(slos []SLOConfig) ([]MetricConfig, error) {
+	var metrics []MetricConfig
+	var errs []error
+	for i := range slos {
+		if err := slos[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("slos[%d]: %w", i, err))
+			continue
+		}
+		metrics = append(metrics, slos[i].metrics()...)
+	}
+	return metrics, errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// staleStore remembers the values last served for each object, so a failed
+// query or a missing series can be answered with them instead of an error or
+// an omitted object, keeping the HPA from falling back during brief SigNoz
+// hiccups. A nil store remembers nothing.
+type staleStore struct {
+	maxAge time.Duration
+
+	mu     sync.Mutex
+	values map[string]staleEntry
+	pruned time.Time
+}
+
+type staleEntry struct {
+	series  []seriesValue
+	fetched time.Time
+}
+
+func newStaleStore(maxAge time.Duration) *staleStore {
+	if maxAge <= 0 {
+		return nil
+	}
+	return &staleStore{maxAge: maxAge, values: map[string]staleEntry{}}
+}
+
+// staleKey identifies the values of a metric served for an object, or for
+// all series of the namespace if object is empty, under a metric selector.
+func staleKey(metric, namespace, object string, metricSelector labels.Selector) string {
+	var selector string
+	if metricSelector != nil {
+		selector = metricSelector.String()
+	}
+	return strings.Join([]string{metric, namespace, object, selector}, "\x00")
+}
+
+// remember stores the series served for key, dropping values older than the
+// maximum age once per maximum age.
+func (s *staleStore) remember(key string, series []seriesValue) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.pruned) > s.maxAge {
+		for k, entry := range s.values {
+			if now.Sub(entry.fetched) > s.maxAge {
+				delete(s.values, k)
+			}
+		}
+		s.pruned = now
+	}
+	s.values[key] = staleEntry{series: series, fetched: now}
+}
+
+// recall returns the series last served for key and when they were fetched,
+// if they are not older than the maximum age.
+func (s *staleStore) recall(key string) ([]seriesValue, time.Time, bool) {
+	if s == nil {
+		return nil, time.Time{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.values[key]
+	if !ok || time.Since(entry.fetched) > s.maxAge {
+		return nil, time.Time{}, false
+	}
+	return entry.series, entry.fetched, true
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// MetricStatus is the status of a single exposed metric as served by
+// /statusz.
+type MetricStatus struct {
+	Name string `json:"name"`
+	MetricHealth
+	// CacheAge is the age of the polled snapshot, empty when the metric is
+	// not served from the poller.
+	CacheAge string `json:"cacheAge,omitempty"`
+	// ServedUnit is the unit values are served in after conversion.
+	ServedUnit string `json:"servedUnit,omitempty"`
+	// ActiveSchedule is the schedule of the active override, if any.
+	ActiveSchedule string `json:"activeSchedule,omitempty"`
+}
+
+// StatusReporter is implemented by providers that report per-metric status.
+type StatusReporter interface {
+	Status() []MetricStatus
+}
+
+// SyncReporter is implemented by providers that cache cluster objects, so
+// readiness can wait for their caches.
+type SyncReporter interface {
+	// InformersSynced returns an error while the caches are syncing.
+	InformersSynced() error
+}
+
+// MetricChecker is implemented by providers that can query a single metric
+// on demand, for self-checks.
+type MetricChecker interface {
+	// CheckMetric queries the metric over the custom metrics window and
+	// returns the number of series.
+	CheckMetric(ctx context.Context, name string) (int, error)
+}
+
+func (p *signozProvider) CheckMetric(ctx context.Context, name string) (int, error) {
+	metric, ok := p.metricConfig(name)
+	if !ok {
+		return 0, fmt.Errorf("metric %s is not configured", name)
+	}
+	series, err := p.fetchSeries(ctx, metric, labels.Everything(), p.query().Custom)
+	return len(series), err
+}
+
+// Status returns the status of every configured metric, in configuration
+// order.
+func (p *signozProvider) Status() []MetricStatus {
+	metrics := p.metricList()
+	status := make([]MetricStatus, 0, len(metrics))
+	for _, m := range metrics {
+		s := MetricStatus{Name: m.Name, MetricHealth: p.health.get(m.Name)}
+		s.ServedUnit = servedUnit(p.unit(&m), m.ServedUnit)
+		if override := m.scheduleOverride(time.Now()); override != nil {
+			s.ActiveSchedule = override.Schedule
+		}
+		if p.poller != nil {
+			if age, ok := p.poller.age(m.Name); ok {
+				s.CacheAge = age.Round(time.Second).String()
+			}
+		}
+		status = append(status, s)
+	}
+	return status
+}
+
+// StatusHandler serves the status of all metrics as JSON. It is installed on
+// the API server, so requests are authenticated and authorized like any
+// other non-resource URL.
+type StatusHandler struct {
+	reporter StatusReporter
+}
+
+func NewStatusHandler(reporter StatusReporter) *StatusHandler {
+	return &StatusHandler{reporter: reporter}
+}
+
+// Install registers the handler at /statusz on the given mux.
+func (h *StatusHandler) Install(mux interface {
+	Handle(path string, handler http.Handler)
+}) {
+	mux.Handle("/statusz", h)
+}
+
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"metrics": h.reporter.Status()}); err != nil {
+		klog.Errorf("failed to write status response: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Synthetic metric types.
+const (
+	SyntheticConstant = "constant"
+	SyntheticRamp     = "ramp"
+	SyntheticSine     = "sine"
+)
+
+// SyntheticConfig generates the values of a metric instead of querying
+// SigNoz, to rehearse HPA behavior in staging. Every object of the resource
+// gets the same value. Values are derived from the wall clock, so all
+// replicas of the adapter serve the same value at the same time.
+type SyntheticConfig struct {
+	// Type is constant, ramp or sine.
+	Type string `json:"type"`
+	// Value is the value of a constant metric.
+	Value float64 `json:"value,omitempty"`
+	// Min and Max bound the values of ramp and sine metrics. A ramp rises
+	// from Min to Max once per period and then starts over; a sine
+	// oscillates between them.
+	Min float64 `json:"min,omitempty"`
+	Max float64 `json:"max,omitempty"`
+	// PeriodSeconds is the period of ramp and sine metrics.
+	PeriodSeconds int64 `json:"periodSeconds,omitempty"`
+}
+
+func (s *SyntheticConfig) validate() error {
+	switch s.Type {
+	case SyntheticConstant:
+		return nil
+	case SyntheticRamp, SyntheticSine:
+	default:
+		return fmt.Errorf("type must be constant, ramp or sine, got %q", s.Type)
+	}
+	if s.PeriodSeconds <= 0 {
+		return fmt.Errorf("periodSeconds must be positive for %s metrics", s.Type)
+	}
+	if s.Max < s.Min {
+		return fmt.Errorf("max must not be less than min")
+	}
+	return nil
+}
+
+// value returns the value of the metric at t.
+func (s *SyntheticConfig) value(t time.Time) float64 {
+	period := time.Duration(s.PeriodSeconds) * time.Second
+	var phase float64
+	if period > 0 {
+		phase = float64(t.UnixNano()%int64(period)) / float64(period)
+	}
+
+	switch s.Type {
+	case SyntheticRamp:
+		return s.Min + (s.Max-s.Min)*phase
+	case SyntheticSine:
+		return s.Min + (s.Max-s.Min)*(1+math.Sin(2*math.Pi*phase))/2
+	default:
+		return s.Value
+	}
+}
+
+// syntheticSeries returns the single, unlabeled series of a synthetic
+// metric.
+func syntheticSeries(metric *MetricConfig) []seriesValue {
+	return []seriesValue{{Labels: map[string]string{}, Value: metric.Synthetic.value(time.Now())}}
+}
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"math"
+	"slices"
+)
+
+// Time aggregations, reducing the points of a series over the query window.
+const (
+	TimeAggregationLast = "last"
+	TimeAggregationAvg  = "avg"
+	TimeAggregationMax  = "max"
+	TimeAggregationMin  = "min"
+	TimeAggregationSum  = "sum"
+	TimeAggregationP95  = "p95"
+)
+
+// timeAggregations maps each time aggregation to its reducer and to the
+// aggregation SigNoz applies within a step, so every step contributes the
+// matching value of its samples.
+var timeAggregations = map[string]struct {
+	reduce func([]SignozSeriesValue) (float64, bool)
+	step   string
+}{
+	TimeAggregationLast: {latestValue, "latest"},
+	TimeAggregationAvg:  {avgValues, "avg"},
+	TimeAggregationMax:  {maxValue, "max"},
+	TimeAggregationMin:  {minValue, "min"},
+	TimeAggregationSum:  {sumValues, "sum"},
+	TimeAggregationP95:  {p95Value, "latest"},
+}
+
+// points returns the values of the points that have a value.
+func points(values []SignozSeriesValue) []float64 {
+	var points []float64
+	for _, v := range values {
+		if value := float64(v.Value); !math.IsNaN(value) {
+			points = append(points, value)
+		}
+	}
+	return points
+}
+
+func avgValues(values []SignozSeriesValue) (float64, bool) {
+	sum, ok := sumValues(values)
+	if !ok {
+		return 0, false
+	}
+	return sum / float64(len(points(values))), true
+}
+
+func maxValue(values []SignozSeriesValue) (float64, bool) {
+	p := points(values)
+	if len(p) == 0 {
+		return 0, false
+	}
+	return slices.Max(p), true
+}
+
+func minValue(values []SignozSeriesValue) (float64, bool) {
+	p := points(values)
+	if len(p) == 0 {
+		return 0, false
+	}
+	return slices.Min(p), true
+}
+
+// p95Value returns the 95th percentile of the points, interpolating between
+// the two nearest ranks.
+func p95Value(values []SignozSeriesValue) (float64, bool) {
+	p := points(values)
+	if len(p) == 0 {
+		return 0, false
+	}
+	slices.Sort(p)
+	rank := 0.95 * float64(len(p)-1)
+	lower := int(rank)
+	if lower+1 >= len(p) {
+		return p[lower], true
+	}
+	return p[lower] + (rank-float64(lower))*(p[lower+1]-p[lower]), true
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// TLSFiles are the CA bundle and client certificate used to connect to
+// SigNoz, read from files as provided by Secret volumes. The files are
+// re-read on every new connection whose files changed, so rotated
+// certificates are picked up without restarting the adapter. Established
+// connections keep the certificate they were made with.
+type TLSFiles struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	pool    *x509.CertPool
+	cert    *tls.Certificate
+	modTime map[string]time.Time
+}
+
+// NewTLSFiles reads the CA bundle at caFile and the client certificate at
+// certFile and keyFile. Empty paths are skipped; certFile and keyFile must be
+// set together.
+func NewTLSFiles(caFile, certFile, keyFile string) (*TLSFiles, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	t := &TLSFiles{caFile: caFile, certFile: certFile, keyFile: keyFile, modTime: map[string]time.Time{}}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// reload re-reads the files if one of them changed. It must be called with
+// mu held or before the files are shared.
+func (t *TLSFiles) reload() error {
+	modTime := map[string]time.Time{}
+	changed := false
+	for _, path := range []string{t.caFile, t.certFile, t.keyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTime[path] = info.ModTime()
+		if !info.ModTime().Equal(t.modTime[path]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	var pool *x509.CertPool
+	if t.caFile != "" {
+		data, err := os.ReadFile(t.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s contains no PEM certificates", t.caFile)
+		}
+	}
+	var cert *tls.Certificate
+	if t.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &pair
+	}
+
+	if len(t.modTime) > 0 {
+		klog.Infof("reloaded SigNoz TLS files")
+	}
+	t.pool, t.cert, t.modTime = pool, cert, modTime
+	return nil
+}
+
+// current returns the CA pool and client certificate, reloading them if the
+// files changed. If they cannot be read, the last ones are kept.
+func (t *TLSFiles) current() (*x509.CertPool, *tls.Certificate) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.reload(); err != nil {
+		klog.Errorf("failed to reload SigNoz TLS files, using previous ones: %v", err)
+	}
+	return t.pool, t.cert
+}
+
+// Config returns a TLS config verifying SigNoz against the CA bundle, or the
+// system roots if there is none, and presenting the client certificate.
+// insecureSkipVerify disables verification of the server.
+func (t *TLSFiles) Config(insecureSkipVerify bool) *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if _, cert := t.current(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+	if insecureSkipVerify {
+		config.InsecureSkipVerify = true
+		return config
+	}
+	if t.caFile == "" {
+		return config
+	}
+
+	// The server is verified against the current CA bundle by hand, as the
+	// RootCAs of a config cannot change once it is in use.
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		pool, _ := t.current()
+		opts := x509.VerifyOptions{
+			Roots:         pool,
+			DNSName:       state.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("signoz presented no certificate")
+		}
+		for _, cert := range state.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := state.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return config
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	jwtTokenType           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchange authenticates with a bearer token obtained by exchanging the
+// projected ServiceAccount token of the adapter (RFC 8693), so no long-lived
+// API key has to be stored in the cluster. The exchanged token is cached
+// until shortly before it expires.
+type TokenExchange struct {
+	url      string
+	audience string
+	subject  *SecretFile
+	http     http.Client
+	cache    tokenCache
+}
+
+// NewTokenExchange returns an Authenticator that exchanges the token read
+// from subject at the given URL. A nil transport uses http.DefaultTransport.
+func NewTokenExchange(exchangeURL, audience string, subject *SecretFile, transport http.RoundTripper) *TokenExchange {
+	return &TokenExchange{
+		url:      exchangeURL,
+		audience: audience,
+		subject:  subject,
+		http:     http.Client{Timeout: 10 * time.Second, Transport: transport, CheckRedirect: sameHostRedirect},
+	}
+}
+
+func (t *TokenExchange) Authenticate(ctx context.Context, request *http.Request) error {
+	token, err := t.cache.get(ctx, t.exchange)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+type tokenExchangeResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (t *TokenExchange) exchange(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {t.subject.Value()},
+		"subject_token_type": {jwtTokenType},
+	}
+	if t.audience != "" {
+		form.Set("audience", t.audience)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", t.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid token exchange request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := t.http.Do(request)
+	if err != nil {
+		return "", 0, &UnavailableError{Err: fmt.Errorf("token exchange: %w", err)}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		return "", 0, &AuthError{StatusCode: response.StatusCode, Body: string(body), Hint: "the token exchange endpoint rejected the ServiceAccount token"}
+	}
+
+	var data tokenExchangeResponse
+	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
+		return "", 0, &DecodeError{Err: fmt.Errorf("token exchange: %w", err)}
+	}
+	if data.AccessToken == "" {
+		return "", 0, &DecodeError{Err: fmt.Errorf("token exchange: response has no access_token")}
+	}
+
+	lifetime := defaultTokenLifetime
+	if data.ExpiresIn > 0 {
+		lifetime = time.Duration(data.ExpiresIn) * time.Second
+	}
+	return data.AccessToken, lifetime, nil
+}
@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"math"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// unitKind groups units that share a base unit and a quantity format.
+type unitKind int
+
+const (
+	unitNone unitKind = iota
+	unitSeconds
+	unitBytes
+	unitRatio
+)
+
+// unitConversion describes how values in a unit are converted to the base
+// unit of its kind.
+type unitConversion struct {
+	kind   unitKind
+	factor float64
+}
+
+// units maps OTel (UCUM) units to their base unit: seconds for durations,
+// bytes for sizes and fractions for ratios.
+var units = map[string]unitConversion{
+	"ns":    {unitSeconds, 1e-9},
+	"us":    {unitSeconds, 1e-6},
+	"ms":    {unitSeconds, 1e-3},
+	"s":     {unitSeconds, 1},
+	"min":   {unitSeconds, 60},
+	"h":     {unitSeconds, 3600},
+	"By":    {unitBytes, 1},
+	"KBy":   {unitBytes, 1e3},
+	"MBy":   {unitBytes, 1e6},
+	"GBy":   {unitBytes, 1e9},
+	"KiBy":  {unitBytes, 1 << 10},
+	"MiBy":  {unitBytes, 1 << 20},
+	"GiBy":  {unitBytes, 1 << 30},
+	"1":     {unitRatio, 1},
+	"%":     {unitRatio, 0.01},
+	"ratio": {unitRatio, 1},
+}
+
+// baseUnits names the unit values are served in, per kind.
+var baseUnits = map[unitKind]string{
+	unitSeconds: "s",
+	unitBytes:   "By",
+	unitRatio:   "1",
+}
+
+// normalizeUnit strips the annotations OTel allows in units, so
+// {requests} is treated as the dimensionless unit 1.
+func normalizeUnit(unit string) string {
+	stripped := unit
+	for {
+		start := strings.IndexByte(stripped, '{')
+		end := strings.IndexByte(stripped, '}')
+		if start < 0 || end < start {
+			break
+		}
+		stripped = stripped[:start] + stripped[end+1:]
+	}
+	if stripped == "" && unit != "" {
+		return "1"
+	}
+	return stripped
+}
+
+// servedUnit returns the unit values of the given unit are served in, the
+// target unit if it is of the same kind and the base unit of the kind
+// otherwise.
+func servedUnit(unit, target string) string {
+	c, ok := units[normalizeUnit(unit)]
+	if !ok {
+		return unit
+	}
+	if t, ok := units[target]; ok && t.kind == c.kind {
+		return target
+	}
+	return baseUnits[c.kind]
+}
+
+// unit returns the configured unit of the metric, or the unit SigNoz
+// reported for it.
+func (p *signozProvider) unit(metric *MetricConfig) string {
+	if metric.Unit != "" {
+		return metric.Unit
+	}
+	if metric.Apdex != nil {
+		return "1"
+	}
+	return p.health.get(metric.Name).Unit
+}
+
+// quantity converts a value of the metric to a quantity in its served unit.
+func (p *signozProvider) quantity(metric *MetricConfig, value float64) resource.Quantity {
+	if metric.Scale != 0 {
+		value *= metric.Scale
+	}
+	return quantityFor(value, p.unit(metric), metric.ServedUnit, metric.Precision)
+}
+
+// quantityFor converts value, in the given unit, to a quantity that reads
+// naturally in HPA targets: durations in seconds with milli precision (250m
+// is 250ms), sizes in bytes with binary suffixes (512Mi) and ratios with
+// milli precision (750m is 75%). Values of other units are rounded to
+// integers.
+//
+// A target unit of the same kind serves values in that unit instead, e.g.
+// ms or MiBy, as plain numbers. precision, if set, overrides the number of
+// decimal digits served.
+func quantityFor(value float64, unit, target string, precision *int) resource.Quantity {
+	digits, format := 0, resource.DecimalSI
+	if c, ok := units[normalizeUnit(unit)]; ok {
+		value *= c.factor
+		switch t, ok := units[target]; {
+		case ok && t.kind == c.kind:
+			value /= t.factor
+			if c.kind != unitBytes {
+				digits = 3
+			}
+		case c.kind == unitBytes:
+			format = resource.BinarySI
+		default:
+			digits = 3
+		}
+	}
+	if precision != nil {
+		digits = *precision
+	}
+	return scaledQuantity(value, digits, format)
+}
+
+// scaledQuantity rounds value to the given number of decimal digits. Digits
+// are dropped as far as needed for the scaled value to fit into an int64, so
+// large counters lose precision instead of overflowing.
+func scaledQuantity(value float64, digits int, format resource.Format) resource.Quantity {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return *resource.NewQuantity(0, format)
+	}
+	scaled := math.Round(value * math.Pow10(digits))
+	for math.Abs(scaled) >= math.MaxInt64 {
+		digits--
+		scaled = math.Round(value * math.Pow10(digits))
+	}
+	if digits == 0 {
+		return *resource.NewQuantity(int64(scaled), format)
+	}
+	q := resource.NewScaledQuantity(int64(scaled), resource.Scale(-digits))
+	if digits < 0 {
+		// SI suffixes end at E, larger values need an exponent.
+		q.Format = resource.DecimalExponent
+	}
+	return *q
+}
+
+// responseUnit returns the unit SigNoz reports for the metric in the
+// aggregation metadata of the response, if any.
+func (resp *SignozQueryRangeResponse) responseUnit() string {
+	for _, qr := range resp.Data.Data.Results {
+		for _, agg := range qr.Aggregations {
+			if unit, ok := agg.Meta["unit"].(string); ok && unit != "" {
+				return unit
+			}
+		}
+	}
+	return ""
+}
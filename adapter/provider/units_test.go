@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"math"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestScaledQuantity(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  float64
+		digits int
+		want   string
+	}{
+		{name: "milli", value: 1.2345, digits: 3, want: "1235m"},
+		{name: "whole", value: 42.4, digits: 0, want: "42"},
+		{name: "negative", value: -0.5, digits: 3, want: "-500m"},
+		{name: "micro", value: 0.000002, digits: 6, want: "2u"},
+		{name: "rounded to zero", value: 0.0004, digits: 3, want: "0"},
+		{name: "NaN", value: math.NaN(), digits: 3, want: "0"},
+		{name: "infinity", value: math.Inf(1), digits: 3, want: "0"},
+		{name: "large counter drops digits", value: 1e17, digits: 3, want: "100P"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := scaledQuantity(tt.value, tt.digits, resource.DecimalSI)
+			if got := q.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaledQuantityDoesNotOverflow(t *testing.T) {
+	for _, value := range []float64{1e18, 9.3e18, 1e30, -1e30} {
+		q := scaledQuantity(value, 3, resource.DecimalSI)
+		if got := q.AsApproximateFloat64(); math.Abs(got-value) > math.Abs(value)*1e-9 {
+			t.Errorf("%g: got %g", value, got)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package provider
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// version returns the module version of the adapter binary, or the VCS
+// revision for development builds.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+	return "devel"
+}
+
+// DefaultUserAgent identifies the adapter, its version and, if set, the
+// cluster it runs in to SigNoz and any gateway in front of it.
+func DefaultUserAgent(cluster string) string {
+	ua := "signoz-metrics-adapter/" + version()
+	if cluster != "" {
+		ua += fmt.Sprintf(" (cluster=%s)", cluster)
+	}
+	return ua
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+const (
+	vpaFeedPrefix    = "/vpa/v1/namespaces/"
+	containerNameKey = "k8s.container.name"
+)
+
+// VPAFeed serves per-container resource usage derived from SigNoz in the
+// PodMetricsList format of metrics.k8s.io, so a VPA custom recommender can be
+// fed without metrics-server. Usage is served at
+// /vpa/v1/namespaces/<namespace>/pods.
+type VPAFeed struct {
+	signoz       Querier
+	cpuMetric    string
+	memoryMetric string
+	window       time.Duration
+	podLabels    []string
+}
+
+// NewVPAFeed returns a feed reporting the given SigNoz metrics as CPU (in
+// cores) and memory (in bytes) usage, averaged over window. Pods are
+// identified by the first of podLabels set on a series, k8s.pod.name if
+// empty.
+func NewVPAFeed(signoz Querier, cpuMetric, memoryMetric string, window time.Duration, podLabels []string) *VPAFeed {
+	if len(podLabels) == 0 {
+		podLabels = []string{podLabelKey}
+	}
+	return &VPAFeed{
+		signoz:       signoz,
+		cpuMetric:    cpuMetric,
+		memoryMetric: memoryMetric,
+		window:       window,
+		podLabels:    podLabels,
+	}
+}
+
+// Install registers the feed on the given mux.
+func (f *VPAFeed) Install(mux interface {
+	HandlePrefix(path string, handler http.Handler)
+}) {
+	mux.HandlePrefix(vpaFeedPrefix, f)
+}
+
+func (f *VPAFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespace, rest, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, vpaFeedPrefix), "/")
+	if !ok || namespace == "" || rest != "pods" {
+		http.NotFound(w, r)
+		return
+	}
+
+	list, err := f.podMetrics(r, namespace)
+	if err != nil {
+		klog.Errorf("failed to query vpa usage for namespace %s: %v", namespace, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		klog.Errorf("failed to write vpa response: %v", err)
+	}
+}
+
+// groupBy groups usage by the pod labels and the container.
+func (f *VPAFeed) groupBy() []SignozQueryGroupBy {
+	var groupBy []SignozQueryGroupBy
+	for _, key := range f.podLabels {
+		groupBy = append(groupBy, SignozQueryGroupBy{Name: key, FieldDataType: "string", FieldContext: "resource"})
+	}
+	return append(groupBy, SignozQueryGroupBy{Name: containerNameKey, FieldDataType: "string", FieldContext: "resource"})
+}
+
+func (f *VPAFeed) usageQuery(name, metric, namespace string) SignozQuery {
+	return SignozQuery{
+		Type: "builder_query",
+		Spec: SignozQuerySpec{
+			Name:         name,
+			Signal:       "metrics",
+			StepInterval: stepSeconds(f.window),
+			Aggregations: []SignozMetricAggregation{{
+				MetricName:       metric,
+				TimeAggregation:  "avg",
+				SpaceAggregation: "sum",
+			}},
+			GroupBy: f.groupBy(),
+			Filter: &SignozQueryFilter{
+				Expression: fmt.Sprintf("k8s.namespace.name = %s", quoteFilterValue(namespace)),
+			},
+		},
+	}
+}
+
+func (f *VPAFeed) podMetrics(r *http.Request, namespace string) (*metricsv1beta1.PodMetricsList, error) {
+	end := time.Now()
+	resp, err := f.signoz.Query(r.Context(), SignozQueryRangeOptions{
+		RequestType: "time_series",
+		Start:       end.Add(-f.window).UnixMilli(),
+		End:         end.UnixMilli(),
+		CompositeQuery: SignozCompositeQuery{
+			Queries: []SignozQuery{
+				f.usageQuery("cpu", f.cpuMetric, namespace),
+				f.usageQuery("memory", f.memoryMetric, namespace),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usage := map[string]map[string]corev1.ResourceList{}
+	for _, qr := range resp.Data.Data.Results {
+		for _, agg := range qr.Aggregations {
+			for _, s := range agg.Series {
+				if len(s.Values) == 0 {
+					continue
+				}
+				labels := s.LabelMap()
+				pod, ok := lookupObject(labels, f.podLabels)
+				if !ok {
+					continue
+				}
+				container, ok := lookupLabel(labels, containerNameKey)
+				if !ok {
+					continue
+				}
+				if usage[pod] == nil {
+					usage[pod] = map[string]corev1.ResourceList{}
+				}
+				if usage[pod][container] == nil {
+					usage[pod][container] = corev1.ResourceList{}
+				}
+
+				value := float64(s.Values[len(s.Values)-1].Value)
+				switch qr.QueryName {
+				case "cpu":
+					usage[pod][container][corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI)
+				case "memory":
+					usage[pod][container][corev1.ResourceMemory] = *resource.NewQuantity(int64(math.Round(value)), resource.BinarySI)
+				}
+			}
+		}
+	}
+
+	list := &metricsv1beta1.PodMetricsList{
+		TypeMeta: metav1.TypeMeta{Kind: "PodMetricsList", APIVersion: metricsv1beta1.SchemeGroupVersion.String()},
+		Items:    []metricsv1beta1.PodMetrics{},
+	}
+	for pod, containers := range usage {
+		item := metricsv1beta1.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{Name: pod, Namespace: namespace},
+			Timestamp:  metav1.NewTime(end),
+			Window:     metav1.Duration{Duration: f.window},
+		}
+		for container, resources := range containers {
+			item.Containers = append(item.Containers, metricsv1beta1.ContainerMetrics{Name: container, Usage: resources})
+		}
+		sort.Slice(item.Containers, func(i, j int) bool { return item.Containers[i].Name < item.Containers[j].Name })
+		list.Items = append(list.Items, item)
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+
+	return list, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	signozprov "github.com/brainpodnl/signoz-metrics-adapter/adapter/provider"
+)
+
+// queryFlags are the settings of the queries as set by flags and environment
+// variables, before the config file is applied. A reload starts from them,
+// so settings removed from the config file fall back to their flag.
+type queryFlags struct {
+	filterExpression     string
+	timerangeMinutes     int64
+	window               string
+	hpaSyncPeriod        time.Duration
+	autoWindowMultiplier int
+	stepSeconds          int64
+	externalWindow       time.Duration
+	externalStepSeconds  int64
+	labelFilters         string
+	presets              []string
+}
+
+func (a *SignozAdapter) saveQueryFlags() {
+	a.queryFlags = a.currentQueryFlags()
+}
+
+// currentQueryFlags returns the current values of the fields saved by
+// saveQueryFlags.
+func (a *SignozAdapter) currentQueryFlags() queryFlags {
+	return queryFlags{
+		filterExpression:     a.SignozFilterExpression,
+		timerangeMinutes:     a.SignozTimerangeMinutes,
+		window:               a.SignozWindow,
+		hpaSyncPeriod:        a.HPASyncPeriod,
+		autoWindowMultiplier: a.AutoWindowMultiplier,
+		stepSeconds:          a.SignozStepSeconds,
+		externalWindow:       a.ExternalWindow,
+		externalStepSeconds:  a.ExternalStepSeconds,
+		labelFilters:         a.SignozLabelFilters,
+		presets:              a.Presets,
+	}
+}
+
+func (a *SignozAdapter) restoreQueryFlags() {
+	a.setQueryFlags(a.queryFlags)
+	a.labelFilters = nil
+	a.metricConfigs = nil
+}
+
+func (a *SignozAdapter) setQueryFlags(f queryFlags) {
+	a.SignozFilterExpression = f.filterExpression
+	a.SignozTimerangeMinutes = f.timerangeMinutes
+	a.SignozWindow = f.window
+	a.HPASyncPeriod = f.hpaSyncPeriod
+	a.AutoWindowMultiplier = f.autoWindowMultiplier
+	a.SignozStepSeconds = f.stepSeconds
+	a.ExternalWindow = f.externalWindow
+	a.ExternalStepSeconds = f.externalStepSeconds
+	a.SignozLabelFilters = f.labelFilters
+	a.Presets = f.presets
+}
+
+// queryState is everything reloadQuery derives, kept to roll back a reload
+// that turns out to be invalid.
+type queryState struct {
+	flags         queryFlags
+	config        *AdapterConfig
+	window        time.Duration
+	labelFilters  []signozprov.LabelFilter
+	metricConfigs []signozprov.MetricConfig
+}
+
+func (a *SignozAdapter) saveQueryState() queryState {
+	return queryState{
+		flags:         a.currentQueryFlags(),
+		config:        a.config,
+		window:        a.window,
+		labelFilters:  a.labelFilters,
+		metricConfigs: a.metricConfigs,
+	}
+}
+
+func (a *SignozAdapter) restoreQueryState(s queryState) {
+	a.setQueryFlags(s.flags)
+	a.config = s.config
+	a.window = s.window
+	a.labelFilters = s.labelFilters
+	a.metricConfigs = s.metricConfigs
+}
+
+// reloadQuery re-reads the config sources and derives the settings of the
+// queries from them again. If they are invalid the previous settings are
+// kept.
+func (a *SignozAdapter) reloadQuery() error {
+	var config *AdapterConfig
+	if a.Config != "" {
+		var err error
+		if config, err = loadAdapterConfig(a.Config); err != nil {
+			return err
+		}
+	}
+
+	previous := a.saveQueryState()
+	a.restoreQueryFlags()
+	if config != nil {
+		a.config = config
+		a.applyQueryConfig(config)
+	}
+	if err := a.completeQuery(); err != nil {
+		a.restoreQueryState(previous)
+		return err
+	}
+	return nil
+}
+
+// configReloader watches the --config and --signoz-metrics-config files and
+// applies the metrics, filters and query ranges of a changed file to the
+// running provider, so a ConfigMap update takes effect without restarting
+// the adapter and interrupting HPA evaluations. Other settings, e.g. the
+// endpoints and credentials, only change on restart. An invalid file is
+// logged and ignored, the adapter keeps serving the last valid settings and
+// checks the file again until it changes to valid contents, including the
+// last valid ones.
+type configReloader struct {
+	adapter  *SignozAdapter
+	interval time.Duration
+	updater  signozprov.MetricUpdater
+	// setMetrics replaces the configured metrics, through the SignozMetric
+	// controller if there is one.
+	setMetrics func([]signozprov.MetricConfig)
+
+	// contents are the contents of the files last applied.
+	contents []byte
+	// invalid are the contents of the files last rejected, so they are only
+	// logged once.
+	invalid []byte
+}
+
+func newConfigReloader(a *SignozAdapter, updater signozprov.MetricUpdater, setMetrics func([]signozprov.MetricConfig)) *configReloader {
+	r := &configReloader{adapter: a, interval: a.ConfigReloadInterval, updater: updater, setMetrics: setMetrics}
+	r.contents, _ = r.read()
+	return r
+}
+
+// paths returns the files the settings of the queries are read from.
+func (r *configReloader) paths() []string {
+	var paths []string
+	for _, path := range []string{r.adapter.Config, r.adapter.SignozMetricsConfig} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// read returns the concatenated contents of the watched files. Reading the
+// contents rather than comparing modification times also catches ConfigMap
+// volumes, which are updated by swapping a symlink.
+func (r *configReloader) read() ([]byte, error) {
+	var contents []byte
+	for _, path := range r.paths() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, data...)
+		contents = append(contents, 0)
+	}
+	return contents, nil
+}
+
+// Run checks the files every interval until ctx is done.
+func (r *configReloader) Run(ctx context.Context) {
+	if len(r.paths()) == 0 {
+		return
+	}
+	wait.UntilWithContext(ctx, func(context.Context) { r.check() }, r.interval)
+}
+
+func (r *configReloader) check() {
+	contents, err := r.read()
+	if err != nil {
+		klog.Errorf("failed to read config for reload: %v", err)
+		return
+	}
+	if bytes.Equal(contents, r.contents) {
+		return
+	}
+
+	a := r.adapter
+	if err := a.reloadQuery(); err != nil {
+		if !bytes.Equal(contents, r.invalid) {
+			klog.Errorf("ignoring invalid config, keeping the last valid settings:\n%v", err)
+		}
+		r.invalid = contents
+		return
+	}
+	r.contents = contents
+	r.invalid = nil
+	opts := a.providerOptions()
+	r.updater.SetQuerySettings(signozprov.QuerySettings{
+		Custom:           opts.Custom,
+		External:         opts.External,
+		FilterExpression: opts.FilterExpression,
+		LabelFilters:     opts.LabelFilters,
+	})
+	r.setMetrics(opts.Metrics)
+	klog.Infof("reloaded config: %d metrics, window=%s", len(opts.Metrics), a.window)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	signozprov "github.com/brainpodnl/signoz-metrics-adapter/adapter/provider"
+)
+
+type fakeUpdater struct {
+	metrics  []signozprov.MetricConfig
+	settings []signozprov.QuerySettings
+}
+
+func (u *fakeUpdater) SetMetrics(metrics []signozprov.MetricConfig) { u.metrics = metrics }
+
+func (u *fakeUpdater) SetQuerySettings(settings signozprov.QuerySettings) {
+	u.settings = append(u.settings, settings)
+}
+
+func TestConfigReloaderInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.yaml")
+	write := func(contents string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valid := "metrics:\n  - name: requests\n"
+	write(valid)
+
+	a := &SignozAdapter{SignozMetricsConfig: path, SignozTimerangeMinutes: 5}
+	a.saveQueryFlags()
+	if err := a.completeQuery(); err != nil {
+		t.Fatal(err)
+	}
+	updater := &fakeUpdater{}
+	r := newConfigReloader(a, updater, updater.SetMetrics)
+
+	write("metrics:\n  - name: requests\n    timeAggregation: median\n")
+	r.check()
+	if len(updater.settings) != 0 {
+		t.Fatal("invalid config applied")
+	}
+	if len(a.metricConfigs) != 1 || a.window == 0 {
+		t.Fatalf("invalid config changed the settings: %d metrics, window %s", len(a.metricConfigs), a.window)
+	}
+
+	// Reverting to the last valid contents keeps the settings; changing to
+	// other valid contents applies them.
+	write(valid)
+	r.check()
+	if len(updater.settings) != 0 {
+		t.Fatal("unchanged config applied")
+	}
+	write("metrics:\n  - name: requests\n  - name: errors\n")
+	r.check()
+	if len(updater.metrics) != 2 {
+		t.Fatalf("valid config not applied: %d metrics", len(updater.metrics))
+	}
+
+	write("metrics: [")
+	r.check()
+	write("metrics:\n  - name: requests\n  - name: errors\n")
+	r.check()
+	if len(updater.settings) != 1 {
+		t.Fatalf("config applied %d times, want once", len(updater.settings))
+	}
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+
+	signozprov "github.com/brainpodnl/signoz-metrics-adapter/adapter/provider"
+)
+
+// configPaths maps flags to the config file fields that set them, so errors
+// point at the place the value came from.
+var configPaths = map[string]string{
+	"signoz-endpoint":                  "signoz.endpoints",
+	"signoz-endpoint-file":             "signoz.endpointFile",
+	"signoz-api-path":                  "signoz.apiPath",
+	"signoz-token-exchange-url":        "signoz.tokenExchange.url",
+	"signoz-token-exchange-audience":   "signoz.tokenExchange.audience",
+	"signoz-token-file":                "signoz.tokenExchange.tokenFile",
+	"signoz-exec-command":              "signoz.exec.command",
+	"signoz-exec-arg":                  "signoz.exec.args",
+	"signoz-flavor":                    "signoz.flavor",
+	"signoz-api-key":                   "signoz.apiKey",
+	"signoz-api-key-file":              "signoz.apiKeyFile",
+	"signoz-auth-mode":                 "signoz.authMode",
+	"signoz-oauth2-token-url":          "signoz.oauth2.tokenURL",
+	"signoz-oauth2-client-id":          "signoz.oauth2.clientID",
+	"signoz-oauth2-client-secret":      "signoz.oauth2.clientSecret",
+	"signoz-oauth2-client-secret-file": "signoz.oauth2.clientSecretFile",
+	"signoz-oauth2-scopes":             "signoz.oauth2.scopes",
+	"signoz-ca-file":                   "signoz.tls.caFile",
+	"signoz-cert-file":                 "signoz.tls.certFile",
+	"signoz-key-file":                  "signoz.tls.keyFile",
+	"signoz-insecure-skip-verify":      "signoz.tls.insecureSkipVerify",
+	"signoz-api-key-secret":            "signoz.apiKeySecret.name",
+	"signoz-api-key-secret-key":        "signoz.apiKeySecret.key",
+	"signoz-api-key-secret-cert":       "signoz.apiKeySecret.clientCertificate",
+	"cluster-name":                     "signoz.clusterName",
+	"signoz-user-agent":                "signoz.userAgent",
+	"signoz-header":                    "signoz.headers",
+	"signoz-proxy-url":                 "signoz.proxyURL",
+	"pod-label-keys":                   "pods.labelKeys",
+	"namespace-label-key":              "signoz.namespaceLabelKey",
+	"signoz-signing-key-file":          "signoz.signing.keyFile",
+	"signoz-signing-algorithm":         "signoz.signing.algorithm",
+	"signoz-signing-headers":           "signoz.signing.headers",
+	"signoz-signature-header":          "signoz.signing.header",
+	"signoz-endpoint-allowlist":        "signoz.endpointAllowlist",
+	"signoz-endpoint-ips":              "signoz.endpointIPs",
+	"signoz-dns-servers":               "dns.servers",
+	"signoz-host-alias":                "dns.hostAliases",
+	"partial-response":                 "signoz.partialResponse",
+	"signoz-timerange-minutes":         "signoz.timeRangeMinutes",
+	"signoz-window":                    "signoz.window",
+	"hpa-sync-period":                  "signoz.hpaSyncPeriod",
+	"auto-window-multiplier":           "signoz.autoWindowMultiplier",
+	"signoz-step-seconds":              "signoz.stepSeconds",
+	"signoz-external-window":           "signoz.external.window",
+	"signoz-external-step-seconds":     "signoz.external.stepSeconds",
+	"signoz-label-filters":             "signoz.labelFilters",
+	"signoz-dns-cache-ttl":             "dns.cacheTTL",
+	"signoz-dns-negative-ttl":          "dns.negativeTTL",
+	"signoz-poll-interval":             "poll.interval",
+	"signoz-poll-workers":              "poll.workers",
+	"signoz-poll-idle-timeout":         "poll.idleTimeout",
+	"signoz-poll-jitter":               "poll.jitter",
+	"signoz-query-timeout":             "signoz.queryTimeout",
+	"signoz-metric-timeout":            "signoz.metricTimeout",
+	"query-cache-ttl":                  "signoz.queryCacheTTL",
+	"query-batch-window":               "signoz.queryBatchWindow",
+	"max-stale-age":                    "signoz.maxStaleAge",
+	"signoz-retry-max-attempts":        "signoz.retry.maxAttempts",
+	"signoz-retry-base-delay":          "signoz.retry.baseDelay",
+	"signoz-retry-status-codes":        "signoz.retry.statusCodes",
+	"circuit-breaker-failures":         "signoz.circuitBreaker.failures",
+	"circuit-breaker-open-duration":    "signoz.circuitBreaker.openDuration",
+	"circuit-breaker-serve-stale":      "signoz.circuitBreaker.serveStale",
+	"external-metrics-deny-namespaces": "signoz.external.denyNamespaces",
+	"rate-limit-qps":                   "rateLimit.qps",
+	"rate-limit-burst":                 "rateLimit.burst",
+	"rate-limit-by":                    "rateLimit.by",
+	"max-inflight-requests":            "concurrency.maxInflight",
+	"max-queued-requests":              "concurrency.maxQueued",
+	"inflight-queue-timeout":           "concurrency.queueTimeout",
+	"inflight-priority-users":          "concurrency.priorityUsers",
+	"shadow-sample-rate":               "shadow.sampleRate",
+	"shadow-tolerance":                 "shadow.tolerance",
+	"export-configmap":                 "exportConfigMap",
+	"preset":                           "presets",
+	"vpa-cpu-metric":                   "vpa.cpuMetric",
+	"vpa-memory-metric":                "vpa.memoryMetric",
+	"manage-apiservices":               "apiServices.manage",
+	"apiservice-service":               "apiServices.service",
+	"apiservice-cert-secret":           "apiServices.certSecret",
+	"apiservice-owner":                 "apiServices.owner",
+	"enable-metric-crd":                "metricCRD",
+	"config-reload-interval":           "reloadInterval",
+}
+
+// fieldPath names the setting behind a flag: the config file field if the
+// value came from --config, the flag otherwise.
+func (a *SignozAdapter) fieldPath(flag string) string {
+	if a.config != nil && !a.Flags().Changed(flag) {
+		if path, ok := configPaths[flag]; ok {
+			return fmt.Sprintf("%s (%s, %s)", path, a.Config, nodePosition(a.config.node, path))
+		}
+	}
+	return "--" + flag
+}
+
+// minAutoWindow keeps the auto window long enough to contain a couple of
+// samples at common scrape intervals.
+const minAutoWindow = time.Minute
+
+// autoWindow sizes the query window to cover the given number of HPA sync
+// periods, so every sync sees fresh data without reacting to a single
+// sample.
+func autoWindow(syncPeriod time.Duration, multiplier int) time.Duration {
+	return max(syncPeriod*time.Duration(multiplier), minAutoWindow)
+}
+
+// complete validates all settings and derives the values the adapter is
+// built from. Every problem is reported at once rather than only the first.
+func (a *SignozAdapter) complete() error {
+	var errs []error
+	fail := func(flag string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", a.fieldPath(flag), fmt.Sprintf(format, args...)))
+	}
+
+	if a.SignozEndpointFile != "" {
+		if a.SignozEndpoint != "" {
+			fail("signoz-endpoint-file", "cannot be combined with --signoz-endpoint")
+		} else if endpoint, err := signozprov.ReadSecretFile(a.SignozEndpointFile); err != nil {
+			fail("signoz-endpoint-file", "%v", err)
+		} else {
+			a.SignozEndpoint = endpoint
+		}
+	}
+	if a.SignozAPIKeyFile != "" {
+		if a.SignozAPIKey != "" {
+			fail("signoz-api-key-file", "cannot be combined with --signoz-api-key")
+		} else if f, err := signozprov.NewSecretFile(a.SignozAPIKeyFile); err != nil {
+			fail("signoz-api-key-file", "%v", err)
+		} else {
+			a.apiKeyFile = f
+		}
+	}
+	if a.SignozCAFile != "" || a.SignozCertFile != "" || a.SignozKeyFile != "" || a.SignozInsecure {
+		if a.SignozCAFile != "" && a.SignozInsecure {
+			fail("signoz-insecure-skip-verify", "cannot be combined with --signoz-ca-file")
+		} else if (a.SignozCertFile == "") != (a.SignozKeyFile == "") {
+			fail("signoz-cert-file", "must be set together with --signoz-key-file")
+		} else if files, err := signozprov.NewTLSFiles(a.SignozCAFile, a.SignozCertFile, a.SignozKeyFile); err != nil {
+			fail("signoz-ca-file", "%v", err)
+		} else {
+			a.tlsFiles = files
+		}
+	}
+
+	for _, e := range strings.Split(a.SignozEndpoint, ",") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		u, err := url.Parse(e)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			if _, rest, ok := strings.Cut(e, "://"); ok && strings.Count(strings.Split(rest, "/")[0], ":") > 1 && !strings.HasPrefix(rest, "[") {
+				fail("signoz-endpoint", "invalid endpoint %q, IPv6 addresses must be enclosed in brackets, e.g. http://[fd00::1]:8080", e)
+			} else {
+				fail("signoz-endpoint", "invalid endpoint %q, must be an http(s) URL", e)
+			}
+			continue
+		}
+		a.endpoints = append(a.endpoints, e)
+	}
+	switch flavor := signozprov.Flavor(a.SignozFlavor); flavor {
+	case signozprov.FlavorAuto, signozprov.FlavorCloud, signozprov.FlavorSelfHosted:
+		for _, e := range a.endpoints {
+			if signozprov.ResolveFlavor(flavor, e) == signozprov.FlavorCloud && !strings.HasPrefix(e, "https://") {
+				fail("signoz-endpoint", "SigNoz Cloud endpoint %q must use https", e)
+			}
+		}
+	default:
+		fail("signoz-flavor", "must be auto, cloud or self-hosted, got %q", a.SignozFlavor)
+	}
+	if a.SignozEndpoint == "" && a.SignozEndpointFile == "" {
+		fail("signoz-endpoint", "required")
+	}
+	if a.APIKeySecret != "" {
+		if namespace, name, ok := strings.Cut(a.APIKeySecret, "/"); !ok || namespace == "" || name == "" {
+			fail("signoz-api-key-secret", "must be namespace/name, got %q", a.APIKeySecret)
+		}
+		if a.APIKeySecretKey == "" {
+			fail("signoz-api-key-secret-key", "required")
+		}
+		if a.SignozAPIKey != "" || a.SignozAPIKeyFile != "" || a.TokenExchangeURL != "" || a.ExecCommand != "" {
+			fail("signoz-api-key-secret", "cannot be combined with another API key, --signoz-token-exchange-url or --signoz-exec-command")
+		}
+	}
+	if a.APIKeySecretCert {
+		if a.APIKeySecret == "" {
+			fail("signoz-api-key-secret-cert", "requires --signoz-api-key-secret")
+		} else if a.SignozCertFile != "" {
+			fail("signoz-api-key-secret-cert", "cannot be combined with --signoz-cert-file")
+		}
+	}
+	if a.ExecCommand != "" {
+		if a.SignozAPIKey != "" || a.SignozAPIKeyFile != "" || a.TokenExchangeURL != "" {
+			fail("signoz-exec-command", "cannot be combined with an API key or --signoz-token-exchange-url")
+		}
+	} else if a.TokenExchangeURL != "" {
+		if u, err := url.Parse(a.TokenExchangeURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("signoz-token-exchange-url", "invalid URL %q, must be an http(s) URL", a.TokenExchangeURL)
+		}
+		if a.SignozAPIKey != "" || a.SignozAPIKeyFile != "" {
+			fail("signoz-token-exchange-url", "cannot be combined with an API key")
+		}
+		if f, err := signozprov.NewSecretFile(a.ServiceAccountTokenFile); err != nil {
+			fail("signoz-token-file", "%v", err)
+		} else {
+			a.serviceAccountToken = f
+		}
+	} else if a.AuthMode != signozprov.AuthModeOAuth2 && a.SignozAPIKey == "" && a.SignozAPIKeyFile == "" && a.APIKeySecret == "" {
+		fail("signoz-api-key", "required")
+	}
+	switch a.AuthMode {
+	case signozprov.AuthModeAPIKey:
+	case signozprov.AuthModeBearer:
+		if a.TokenExchangeURL != "" || a.ExecCommand != "" {
+			fail("signoz-auth-mode", "bearer cannot be combined with --signoz-token-exchange-url or --signoz-exec-command")
+		}
+	case signozprov.AuthModeOAuth2:
+		if a.SignozAPIKey != "" || a.SignozAPIKeyFile != "" || a.APIKeySecret != "" || a.TokenExchangeURL != "" || a.ExecCommand != "" {
+			fail("signoz-auth-mode", "oauth2 cannot be combined with an API key, --signoz-token-exchange-url or --signoz-exec-command")
+		}
+		if u, err := url.Parse(a.OAuth2TokenURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("signoz-oauth2-token-url", "invalid URL %q, must be an http(s) URL", a.OAuth2TokenURL)
+		}
+		if a.OAuth2ClientID == "" {
+			fail("signoz-oauth2-client-id", "required")
+		}
+		switch {
+		case a.OAuth2ClientSecretFile == "" && a.OAuth2ClientSecret == "":
+			fail("signoz-oauth2-client-secret", "required")
+		case a.OAuth2ClientSecretFile == "":
+		case a.OAuth2ClientSecret != "":
+			fail("signoz-oauth2-client-secret-file", "cannot be combined with --signoz-oauth2-client-secret")
+		default:
+			if f, err := signozprov.NewSecretFile(a.OAuth2ClientSecretFile); err != nil {
+				fail("signoz-oauth2-client-secret-file", "%v", err)
+			} else {
+				a.oauth2ClientSecret = f
+			}
+		}
+	default:
+		fail("signoz-auth-mode", "must be api-key, bearer or oauth2, got %q", a.AuthMode)
+	}
+	if u, err := url.Parse(a.SignozAPIPath); err != nil || !strings.HasPrefix(a.SignozAPIPath, "/") || u.Path != a.SignozAPIPath {
+		fail("signoz-api-path", "invalid path %q, must be an absolute path without query", a.SignozAPIPath)
+	}
+	if err := a.completeQuery(); err != nil {
+		errs = append(errs, err)
+	}
+	if a.PartialResponse != "allow" && a.PartialResponse != "deny" {
+		fail("partial-response", "must be allow or deny, got %q", a.PartialResponse)
+	}
+
+	if a.SignozEndpointIPs != "" {
+		var ips []string
+		for _, ip := range strings.Split(a.SignozEndpointIPs, ",") {
+			ip = strings.TrimSpace(ip)
+			if net.ParseIP(ip) == nil {
+				fail("signoz-endpoint-ips", "invalid IP address %q", ip)
+				continue
+			}
+			ips = append(ips, ip)
+		}
+		if len(a.endpoints) != 1 {
+			fail("signoz-endpoint-ips", "requires a single signoz endpoint")
+		} else {
+			u, _ := url.Parse(a.endpoints[0])
+			a.staticIPs = map[string][]string{u.Hostname(): ips}
+		}
+	}
+
+	for _, server := range a.SignozDNSServers {
+		server = strings.TrimSpace(server)
+		if _, err := netip.ParseAddr(server); err == nil {
+			a.dnsServers = append(a.dnsServers, net.JoinHostPort(server, "53"))
+			continue
+		}
+		host, port, err := net.SplitHostPort(server)
+		if err == nil {
+			_, err = netip.ParseAddr(host)
+		}
+		if err == nil {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil {
+			fail("signoz-dns-servers", "invalid DNS server %q, must be an IP address with optional port, e.g. 10.0.0.10 or [fd00::a]:53", server)
+			continue
+		}
+		a.dnsServers = append(a.dnsServers, server)
+	}
+	for _, alias := range a.SignozHostAliases {
+		host, ip, ok := strings.Cut(strings.TrimSpace(alias), "=")
+		if _, err := netip.ParseAddr(ip); !ok || host == "" || err != nil {
+			fail("signoz-host-alias", "invalid host alias %q, must be host=IP", alias)
+			continue
+		}
+		if a.staticIPs == nil {
+			a.staticIPs = map[string][]string{}
+		}
+		a.staticIPs[host] = append(a.staticIPs[host], ip)
+	}
+
+	if a.UserAgent == "" {
+		a.UserAgent = signozprov.DefaultUserAgent(a.ClusterName)
+	}
+	a.headers = http.Header{}
+	for _, h := range a.SignozHeaders {
+		name, value, ok := strings.Cut(h, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(value) {
+			fail("signoz-header", "invalid header %q, must be 'Name: value'", h)
+			continue
+		}
+		a.headers.Add(name, value)
+	}
+
+	if len(a.PodLabelKeys) == 0 || slices.Contains(a.PodLabelKeys, "") {
+		fail("pod-label-keys", "must list attributes, got %q", a.PodLabelKeys)
+	}
+
+	if a.ProxyURL != "" {
+		if u, err := url.Parse(a.ProxyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			fail("signoz-proxy-url", "invalid URL %q, must be an http(s) or socks5 URL", a.ProxyURL)
+		} else {
+			a.proxyURL = u
+		}
+	}
+
+	if a.SigningKeyFile != "" {
+		if !httpguts.ValidHeaderFieldName(a.SignatureHeader) {
+			fail("signoz-signature-header", "invalid header name %q", a.SignatureHeader)
+		}
+		if key, err := signozprov.NewSecretFile(a.SigningKeyFile); err != nil {
+			fail("signoz-signing-key-file", "%v", err)
+		} else if signer, err := signozprov.NewRequestSigner(a.SigningAlgorithm, key, a.SigningHeaders, a.SignatureHeader); err != nil {
+			fail("signoz-signing-algorithm", "%v", err)
+		} else {
+			a.signer = signer
+		}
+	}
+
+	if len(a.EndpointAllowlist) > 0 {
+		allowlist, err := signozprov.ParseEndpointAllowlist(a.EndpointAllowlist)
+		if err != nil {
+			fail("signoz-endpoint-allowlist", "%v", err)
+		} else {
+			a.allowlist = allowlist
+			for _, e := range a.endpoints {
+				if u, _ := url.Parse(e); !allowlist.AllowsHost(u.Hostname()) {
+					fail("signoz-endpoint", "host of %q is not in the endpoint allowlist", e)
+				}
+			}
+			if a.proxyURL != nil && !allowlist.AllowsHost(a.proxyURL.Hostname()) {
+				fail("signoz-proxy-url", "host of the proxy is not in the endpoint allowlist")
+			}
+		}
+	}
+
+	for flag, d := range map[string]time.Duration{
+		"config-reload-interval":   a.ConfigReloadInterval,
+		"signoz-poll-interval":     a.SignozPollInterval,
+		"signoz-poll-idle-timeout": a.SignozPollIdleTimeout,
+		"query-cache-ttl":          a.QueryCacheTTL,
+		"query-batch-window":       a.QueryBatchWindow,
+		"max-stale-age":            a.MaxStaleAge,
+		"signoz-retry-base-delay":  a.RetryBaseDelay,
+		"signoz-dns-cache-ttl":     a.SignozDNSCacheTTL,
+		"signoz-dns-negative-ttl":  a.SignozDNSNegativeTTL,
+	} {
+		if d < 0 {
+			fail(flag, "must not be negative, got %s", d)
+		}
+	}
+	for _, pattern := range a.ExternalDenyNamespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fail("external-metrics-deny-namespaces", "invalid pattern %q: %v", pattern, err)
+		}
+	}
+	if a.RateLimitQPS < 0 {
+		fail("rate-limit-qps", "must not be negative, got %g", a.RateLimitQPS)
+	}
+	if a.RateLimitQPS > 0 && a.RateLimitBurst < 1 {
+		fail("rate-limit-burst", "must be at least 1, got %d", a.RateLimitBurst)
+	}
+	if a.RateLimitBy != "namespace" && a.RateLimitBy != "user" {
+		fail("rate-limit-by", "must be namespace or user, got %q", a.RateLimitBy)
+	}
+	if a.MaxInflight < 0 {
+		fail("max-inflight-requests", "must not be negative, got %d", a.MaxInflight)
+	}
+	if a.MaxInflight > 0 {
+		if a.MaxQueued < 0 {
+			fail("max-queued-requests", "must not be negative, got %d", a.MaxQueued)
+		}
+		if a.QueueTimeout <= 0 {
+			fail("inflight-queue-timeout", "must be positive, got %s", a.QueueTimeout)
+		}
+	}
+	if a.ShadowSampleRate < 0 || a.ShadowSampleRate > 1 {
+		fail("shadow-sample-rate", "must be between 0 and 1, got %g", a.ShadowSampleRate)
+	}
+	if a.ShadowTolerance < 0 {
+		fail("shadow-tolerance", "must not be negative, got %g", a.ShadowTolerance)
+	}
+	if a.RetryMaxAttempts < 1 || a.RetryMaxAttempts > signozprov.MaxRetryAttempts {
+		fail("signoz-retry-max-attempts", "must be between 1 and %d, got %d", signozprov.MaxRetryAttempts, a.RetryMaxAttempts)
+	}
+	for _, code := range a.RetryStatusCodes {
+		if code < 400 || code > 599 {
+			fail("signoz-retry-status-codes", "must be HTTP error status codes, got %d", code)
+		}
+	}
+	if a.BreakerFailures < 0 {
+		fail("circuit-breaker-failures", "must not be negative, got %d", a.BreakerFailures)
+	}
+	if a.BreakerFailures > 0 && a.BreakerOpenDuration <= 0 {
+		fail("circuit-breaker-open-duration", "must be positive, got %s", a.BreakerOpenDuration)
+	}
+	if a.BreakerServeStale && a.BreakerFailures == 0 {
+		fail("circuit-breaker-serve-stale", "requires --circuit-breaker-failures")
+	}
+	if a.QueryTimeout <= 0 {
+		fail("signoz-query-timeout", "must be positive, got %s", a.QueryTimeout)
+	}
+	if a.MetricTimeout < 0 {
+		fail("signoz-metric-timeout", "must not be negative, got %s", a.MetricTimeout)
+	}
+	if a.SignozPollJitter < 0 || a.SignozPollJitter >= 1 {
+		fail("signoz-poll-jitter", "must be at least 0 and below 1, got %g", a.SignozPollJitter)
+	}
+	if a.SignozPollWorkers < 1 {
+		fail("signoz-poll-workers", "must be at least 1, got %d", a.SignozPollWorkers)
+	}
+
+	if a.ExportConfigMap != "" {
+		namespace, name, ok := strings.Cut(a.ExportConfigMap, "/")
+		if !ok || namespace == "" || name == "" {
+			fail("export-configmap", "must be namespace/name, got %q", a.ExportConfigMap)
+		}
+	}
+
+	if a.ManageAPIServices {
+		if namespace, name, ok := strings.Cut(a.APIServiceService, "/"); !ok || namespace == "" || name == "" {
+			fail("apiservice-service", "must be namespace/name when APIServices are managed, got %q", a.APIServiceService)
+		}
+		if namespace, name, ok := strings.Cut(a.APIServiceCertSecret, "/"); !ok || namespace == "" || name == "" {
+			fail("apiservice-cert-secret", "must be namespace/name when APIServices are managed, got %q", a.APIServiceCertSecret)
+		}
+		if a.SecureServing.ServerCert.CertKey.CertFile != "" {
+			fail("manage-apiservices", "cannot be used with --tls-cert-file, the serving certificate is generated")
+		}
+	}
+
+	if a.VPAFeed {
+		if a.VPACPUMetric == "" {
+			fail("vpa-cpu-metric", "required when the VPA feed is enabled")
+		}
+		if a.VPAMemoryMetric == "" {
+			fail("vpa-memory-metric", "required when the VPA feed is enabled")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// completeQuery validates the settings of the queries and derives the query
+// windows, label filters and metrics from them. It runs again on every
+// config reload, see configReloader.
+func (a *SignozAdapter) completeQuery() error {
+	var errs []error
+	fail := func(flag string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", a.fieldPath(flag), fmt.Sprintf(format, args...)))
+	}
+
+	switch a.SignozWindow {
+	case "":
+		if a.SignozTimerangeMinutes <= 0 {
+			fail("signoz-timerange-minutes", "must be positive, got %d", a.SignozTimerangeMinutes)
+		}
+		a.window = time.Duration(a.SignozTimerangeMinutes) * time.Minute
+	case "auto":
+		if a.HPASyncPeriod <= 0 {
+			fail("hpa-sync-period", "must be positive, got %s", a.HPASyncPeriod)
+		}
+		if a.AutoWindowMultiplier < 1 {
+			fail("auto-window-multiplier", "must be at least 1, got %d", a.AutoWindowMultiplier)
+		}
+		a.window = autoWindow(a.HPASyncPeriod, a.AutoWindowMultiplier)
+	default:
+		window, err := time.ParseDuration(a.SignozWindow)
+		if err != nil || window <= 0 {
+			fail("signoz-window", "must be auto or a positive duration, got %q", a.SignozWindow)
+		}
+		a.window = window
+	}
+	if a.SignozStepSeconds < 0 {
+		fail("signoz-step-seconds", "must not be negative, got %d", a.SignozStepSeconds)
+	}
+	if a.ExternalStepSeconds < 0 {
+		fail("signoz-external-step-seconds", "must not be negative, got %d", a.ExternalStepSeconds)
+	}
+	if a.ExternalWindow < 0 {
+		fail("signoz-external-window", "must not be negative, got %s", a.ExternalWindow)
+	}
+
+	if a.labelFilters == nil {
+		filters, err := signozprov.ParseLabelFilters(a.SignozLabelFilters)
+		if err != nil {
+			fail("signoz-label-filters", "%v", err)
+		}
+		a.labelFilters = filters
+	}
+
+	if a.config != nil && len(a.config.Metrics) > 0 {
+		if a.SignozMetricsConfig != "" {
+			fail("signoz-metrics-config", "cannot be used when --config defines metrics")
+		}
+		a.metricConfigs = a.config.Metrics
+	} else if a.SignozMetricsConfig != "" {
+		config, err := signozprov.LoadMetricsConfig(a.SignozMetricsConfig)
+		if err != nil {
+			fail("signoz-metrics-config", "%v", err)
+		} else {
+			a.metricConfigs = config.Metrics
+		}
+	}
+
+	for _, name := range a.Presets {
+		metrics, ok := signozprov.PresetMetrics(strings.TrimSpace(name))
+		if !ok {
+			fail("preset", "unknown preset %q, must be one of %s", name, strings.Join(signozprov.PresetNames(), ", "))
+			continue
+		}
+		a.metricConfigs = signozprov.MergeMetrics(a.metricConfigs, metrics)
+	}
+
+	var names []string
+	for _, name := range strings.Split(a.SignozMetrics, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	a.metricConfigs = signozprov.MergeMetricNames(a.metricConfigs, names)
+	if err := signozprov.ValidateDerivedMetrics(a.metricConfigs); err != nil {
+		errs = append(errs, err)
+	}
+	if len(a.metricConfigs) == 0 {
+		fail("signoz-metrics", "no metrics configured, set --signoz-metrics, SIGNOZ_METRICS, --signoz-metrics-config, --preset or metrics in --config")
+	}
+
+	return errors.Join(errs...)
+}
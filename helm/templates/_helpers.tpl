@@ -39,9 +39,31 @@ app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
 
 {{- define "signoz-metrics-adapter.labelFilters" -}}
-{{- $pairs := list -}}
-{{- range $k, $v := .Values.signoz.labelFilters -}}
-{{- $pairs = append $pairs (printf "%s=%s" $k $v) -}}
+{{- join "," .Values.signoz.labelFilters -}}
 {{- end -}}
-{{- join "," $pairs -}}
+
+{{/*
+Static SigNoz request headers as a comma-separated list of "Name: value".
+*/}}
+{{- define "signoz-metrics-adapter.headers" -}}
+{{- $headers := list -}}
+{{- range $name, $value := .Values.signoz.headers -}}
+{{- $headers = append $headers (printf "%s: %s" $name $value) -}}
+{{- end -}}
+{{- join "," $headers -}}
+{{- end -}}
+
+{{/*
+SigNoz host aliases as comma-separated host=IP entries, from a list in the
+format of pod hostAliases.
+*/}}
+{{- define "signoz-metrics-adapter.hostAliases" -}}
+{{- $aliases := list -}}
+{{- range . -}}
+{{- $ip := .ip -}}
+{{- range .hostnames -}}
+{{- $aliases = append $aliases (printf "%s=%s" . $ip) -}}
+{{- end -}}
+{{- end -}}
+{{- join "," $aliases -}}
 {{- end -}}
@@ -32,6 +32,7 @@ import (
 	"github.com/brainpodnl/signoz-metrics-adapter/pkg/apiserver/metrics"
 	cm_rest "github.com/brainpodnl/signoz-metrics-adapter/pkg/apiserver/registry/rest"
 	"github.com/brainpodnl/signoz-metrics-adapter/pkg/provider"
+	"github.com/brainpodnl/signoz-metrics-adapter/pkg/registry/pagination"
 )
 
 type REST struct {
@@ -126,6 +127,17 @@ func (r *REST) List(ctx context.Context, options *metainternalversion.ListOption
 		return nil, err
 	}
 
+	start, end, next, err := pagination.Page(len(res.Items), options)
+	if err != nil {
+		return nil, err
+	}
+	if next != "" {
+		remaining := int64(len(res.Items) - end)
+		res.Continue = next
+		res.RemainingItemCount = &remaining
+	}
+	res.Items = res.Items[start:end]
+
 	for _, m := range res.Items {
 		r.freshnessObserver.Observe(m.Timestamp)
 	}
@@ -29,6 +29,7 @@ import (
 
 	"github.com/brainpodnl/signoz-metrics-adapter/pkg/apiserver/metrics"
 	"github.com/brainpodnl/signoz-metrics-adapter/pkg/provider"
+	"github.com/brainpodnl/signoz-metrics-adapter/pkg/registry/pagination"
 )
 
 // REST is a wrapper for CustomMetricsProvider that provides implementation for Storage and Lister
@@ -89,6 +90,17 @@ func (r *REST) List(ctx context.Context, options *metainternalversion.ListOption
 		return nil, err
 	}
 
+	start, end, next, err := pagination.Page(len(res.Items), options)
+	if err != nil {
+		return nil, err
+	}
+	if next != "" {
+		remaining := int64(len(res.Items) - end)
+		res.Continue = next
+		res.RemainingItemCount = &remaining
+	}
+	res.Items = res.Items[start:end]
+
 	for _, m := range res.Items {
 		r.freshnessObserver.Observe(m.Timestamp)
 	}
@@ -0,0 +1,61 @@
+// Package pagination implements limit/continue semantics for metric lists
+// that are built in full on every request.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+)
+
+type token struct {
+	Offset int `json:"offset"`
+}
+
+// Page returns the bounds of the requested page of a list of total items,
+// and the continue token of the next page, which is empty on the last page.
+// Providers return items in a stable order, so an offset identifies the
+// position in the list across requests.
+func Page(total int, options *metainternalversion.ListOptions) (start, end int, next string, err error) {
+	if options == nil {
+		return 0, total, "", nil
+	}
+
+	if options.Continue != "" {
+		start, err = decode(options.Continue)
+		if err != nil {
+			return 0, 0, "", errors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+		}
+	}
+	start = min(start, total)
+
+	end = total
+	if options.Limit > 0 && int64(total-start) > options.Limit {
+		end = start + int(options.Limit)
+		next = encode(end)
+	}
+	return start, end, next, nil
+}
+
+func encode(offset int) string {
+	data, _ := json.Marshal(token{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(continueToken string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(continueToken)
+	if err != nil {
+		return 0, err
+	}
+	var t token
+	if err := json.Unmarshal(data, &t); err != nil {
+		return 0, err
+	}
+	if t.Offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", t.Offset)
+	}
+	return t.Offset, nil
+}